@@ -1,23 +1,59 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"github.com/spf13/cobra"
 	"package-manager/internal/config"
+	"package-manager/internal/models"
 	"package-manager/internal/services"
 )
 
+// Коды завершения pm
+const (
+	exitError         = 1
+	exitChecksum      = 3
+	exitSignature     = 4
+	exitUnsafeArchive = 5
+	// exitInterrupted - работа прервана сигналом SIGINT или SIGTERM (128 + SIGINT, как у оболочки)
+	exitInterrupted = 130
+)
+
 var (
+	// Флаги команды "pm create"
+	createSign bool
+
+	// Флаги команды "pm update"
+	updateLocked bool
+	updatePrefix string
+	updateJobs   int
+
+	// Глобальный флаг --offline: архивы берутся только из локального кэша
+	offline bool
+
+	// Глобальный флаг --remote (--profile): хранилище из файла конфигурации
+	remoteName string
+
+	// Флаг --prefix команд "pm list", "pm remove" и "pm rollback"
+	installedPrefix string
+
 	// Корневая команда для CLI-инструмента
 	rootCmd = &cobra.Command{
 		Use:   "pm",
 		Short: "Пакетный менеджер",
 		Long: `Пакетный менеджер для архивации/распаковки и загрузки/скачивания файлов по SSH.
-	Конфигурация загружается из переменных окружения (PM_SSH_USER и т.д).
-	Команды pm create и pm update`,
+	Конфигурация загружается из переменных окружения (PM_REPOSITORY, PM_SSH_USER и т.д),
+	файла проекта .pm.yaml и файла ~/.config/pm/config.yaml.
+	Команды pm create, pm update, pm search, pm info, pm list, pm remove и pm rollback`,
 	}
 
 	// Команда "pm create"
@@ -26,19 +62,10 @@ var (
 		Short: "Упаковывает файлы и загружает на сервер",
 		Args:  cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			cfg, err := config.LoadConfig()
-			if err != nil {
-				log.Fatalf("Error loading configuration: %v", err)
-			}
-			sshClient := services.NewSSHClient(cfg)
-			defer func() {
-				if closeErr := sshClient.Close(); closeErr != nil {
-					log.Printf("error closing SSH client: %v", closeErr)
-				}
-			}()
-			pm := services.NewPackageManager(cfg, sshClient)
-			if err := pm.CreatePackage(args[0]); err != nil {
-				log.Fatalf("Error creating package: %v", err)
+			pm, closeFn := newPackageManager()
+			defer closeFn()
+			if err := pm.CreatePackage(cmd.Context(), args[0], services.CreateOptions{Sign: createSign}); err != nil {
+				fatal("Error creating package", err)
 			}
 		},
 	}
@@ -49,32 +76,247 @@ var (
 		Short: "Скачивает и распаковывает архивы",
 		Args:  cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			cfg, err := config.LoadConfig()
+			pm, closeFn := newPackageManager()
+			defer closeFn()
+			opts := services.UpdateOptions{Locked: updateLocked, Prefix: updatePrefix, Jobs: updateJobs}
+			if err := pm.UpdatePackages(cmd.Context(), args[0], opts); err != nil {
+				fatal("Error updating packages", err)
+			}
+		},
+	}
+
+	// Команда "pm search"
+	searchCmd = &cobra.Command{
+		Use:   "search [query]",
+		Short: "Ищет пакеты в каталоге на сервере",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			pm, closeFn := newPackageManager()
+			defer closeFn()
+			query := ""
+			if len(args) > 0 {
+				query = args[0]
+			}
+			packages, err := pm.SearchPackages(cmd.Context(), query)
+			if err != nil {
+				log.Fatalf("Error searching packages: %v", err)
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tLATEST")
+			for _, pkg := range packages {
+				fmt.Fprintf(w, "%s\t%s\n", pkg.Name, pkg.Latest)
+			}
+			w.Flush()
+		},
+	}
+
+	// Команда "pm info"
+	infoCmd = &cobra.Command{
+		Use:   "info [package_name]",
+		Short: "Показывает опубликованные версии пакета",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			pm, closeFn := newPackageManager()
+			defer closeFn()
+			index, err := pm.PackageInfo(cmd.Context(), args[0])
+			if err != nil {
+				log.Fatalf("Error reading package info: %v", err)
+			}
+			printPackageIndex(index)
+		},
+	}
+
+	// Команда "pm list"
+	listCmd = &cobra.Command{
+		Use:   "list",
+		Short: "Показывает установленные пакеты",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			packages, err := services.ListInstalled(installedPrefix)
+			if err != nil {
+				log.Fatalf("Error listing installed packages: %v", err)
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tVERSION\tFILES\tINSTALLED")
+			for _, pkg := range packages {
+				fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", pkg.Name, pkg.Ver, len(pkg.Files), pkg.Installed.Local().Format(time.DateTime))
+			}
+			w.Flush()
+		},
+	}
+
+	// Команда "pm remove"
+	removeCmd = &cobra.Command{
+		Use:   "remove [package_name]",
+		Short: "Удаляет файлы установленного пакета",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := services.RemovePackage(installedPrefix, args[0]); err != nil {
+				log.Fatalf("Error removing package: %v", err)
+			}
+		},
+	}
+
+	// Команда "pm cache"
+	cacheCmd = &cobra.Command{
+		Use:   "cache",
+		Short: "Управляет локальным кэшем архивов",
+	}
+
+	// Команда "pm cache list"
+	cacheListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "Показывает архивы в локальном кэше",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg, err := config.LoadCacheConfig()
 			if err != nil {
 				log.Fatalf("Error loading configuration: %v", err)
 			}
-			sshClient := services.NewSSHClient(cfg)
-			defer func() {
-				if closeErr := sshClient.Close(); closeErr != nil {
-					log.Printf("error closing SSH client: %v", closeErr)
-				}
-			}()
-			pm := services.NewPackageManager(cfg, sshClient)
-			if err := pm.UpdatePackages(args[0]); err != nil {
-				log.Fatalf("Error updating packages: %v", err)
+			entries, err := services.ListCache(cfg)
+			if err != nil {
+				log.Fatalf("Error listing cache: %v", err)
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tVERSION\tSIZE\tUSED\tCHECKSUM")
+			for _, entry := range entries {
+				fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", entry.Name, entry.Ver, entry.Size,
+					entry.Used.Local().Format(time.DateTime), entry.Checksum)
+			}
+			w.Flush()
+		},
+	}
+
+	// Команда "pm cache clean"
+	cacheCleanCmd = &cobra.Command{
+		Use:   "clean [package_name]",
+		Short: "Удаляет архивы из локального кэша (все или одного пакета)",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg, err := config.LoadCacheConfig()
+			if err != nil {
+				log.Fatalf("Error loading configuration: %v", err)
+			}
+			name := ""
+			if len(args) > 0 {
+				name = args[0]
+			}
+			removed, size, err := services.CleanCache(cfg, name)
+			if err != nil {
+				log.Fatalf("Error cleaning cache: %v", err)
+			}
+			log.Printf("Удалено архивов из кэша: %d (%d байт).", removed, size)
+		},
+	}
+
+	// Команда "pm rollback"
+	rollbackCmd = &cobra.Command{
+		Use:   "rollback [package_name]",
+		Short: "Возвращает предыдущую установленную версию пакета",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := services.RollbackPackage(installedPrefix, args[0]); err != nil {
+				log.Fatalf("Error rolling back package: %v", err)
 			}
 		},
 	}
 )
 
+// newPackageManager загружает конфигурацию и создает PM с хранилищем, выбранным по URL репозитория.
+// Возвращаемую функцию нужно вызвать для закрытия соединения
+func newPackageManager() (*services.PackageManager, func()) {
+	cfg, err := config.LoadConfig(remoteName)
+	if err != nil {
+		log.Fatalf("Error loading configuration: %v", err)
+	}
+	if offline {
+		cfg.Offline = true
+	}
+	backend, err := services.NewBackend(cfg)
+	if err != nil {
+		log.Fatalf("Error opening repository: %v", err)
+	}
+	closeFn := func() {
+		if closeErr := backend.Close(); closeErr != nil {
+			log.Printf("error closing repository backend: %v", closeErr)
+		}
+	}
+	return services.NewPackageManager(cfg, backend), closeFn
+}
+
+// fatal печатает ошибку и завершает процесс с кодом, соответствующим ее типу.
+// Несовпадение контрольной суммы, отклоненная подпись и небезопасный архив отличаются от прочих ошибок,
+// чтобы их можно было обработать в скриптах
+func fatal(msg string, err error) {
+	log.Printf("%s: %v", msg, err)
+	os.Exit(exitCode(err))
+}
+
+// exitCode возвращает код завершения для ошибки
+func exitCode(err error) int {
+	if errors.Is(err, context.Canceled) {
+		return exitInterrupted
+	}
+	var checksumErr *services.ChecksumError
+	if errors.As(err, &checksumErr) {
+		return exitChecksum
+	}
+	var signatureErr *services.SignatureError
+	if errors.As(err, &signatureErr) {
+		return exitSignature
+	}
+	var extractErr *services.ExtractError
+	if errors.As(err, &extractErr) {
+		return exitUnsafeArchive
+	}
+	return exitError
+}
+
+// printPackageIndex выводит версии пакета в виде таблицы
+func printPackageIndex(index *models.PackageIndex) {
+	fmt.Printf("Пакет: %s\n", index.Name)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tSIZE\tPUBLISHED\tCHECKSUM\tDEPENDENCIES")
+	for _, entry := range index.Versions {
+		deps := make([]string, len(entry.Packets))
+		for i, dep := range entry.Packets {
+			deps[i] = strings.TrimSpace(dep.Name + " " + dep.Ver)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", entry.Ver, entry.Size,
+			entry.Published.Local().Format(time.DateTime), entry.Checksum, strings.Join(deps, ", "))
+	}
+	w.Flush()
+}
+
 func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 	log.Println("Start package manager...")
 
-	rootCmd.AddCommand(createCmd, updateCmd)
+	createCmd.Flags().BoolVar(&createSign, "sign", false, "подписать пакет ключом PM_SIGNING_KEY (по умолчанию PM_SSH_KEY)")
+	updateCmd.Flags().BoolVar(&updateLocked, "locked", false, "установить версии строго по packages.lock")
+	updateCmd.Flags().BoolVar(&updateLocked, "frozen", false, "синоним --locked")
+	updateCmd.Flags().StringVar(&updatePrefix, "prefix", "", "корень установки, к которому добавляются директории dest")
+	updateCmd.Flags().IntVarP(&updateJobs, "jobs", "j", 4, "число одновременных скачиваний")
+	for _, cmd := range []*cobra.Command{listCmd, removeCmd, rollbackCmd} {
+		cmd.Flags().StringVar(&installedPrefix, "prefix", "", "корень установки, указанный в pm update --prefix")
+	}
+	rootCmd.PersistentFlags().StringVar(&remoteName, "remote", "", "хранилище из файла конфигурации (PM_REMOTE)")
+	rootCmd.PersistentFlags().StringVar(&remoteName, "profile", "", "синоним --remote")
+	rootCmd.PersistentFlags().BoolVar(&offline, "offline", false, "не обращаться к хранилищу, брать архивы только из кэша (PM_OFFLINE)")
+	cacheCmd.AddCommand(cacheListCmd, cacheCleanCmd)
+	rootCmd.AddCommand(createCmd, updateCmd, searchCmd, infoCmd, listCmd, removeCmd, rollbackCmd, cacheCmd)
+
+	// Первый SIGINT/SIGTERM отменяет контекст команды: передачи прерываются, временные файлы удаляются.
+	// Повторный сигнал завершает процесс сразу
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, func() {
+		stop()
+		log.Println("Получен сигнал прерывания, завершение работы...")
+	})
 
-	if err := rootCmd.Execute(); err != nil {
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		os.Exit(exitError)
 	}
 }
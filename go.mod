@@ -3,13 +3,18 @@ module package-manager
 go 1.24.2
 
 require (
+	github.com/bmatcuk/doublestar/v4 v4.9.1
+	github.com/klauspost/compress v1.18.0
+	github.com/pkg/sftp v1.13.9
 	github.com/spf13/cobra v1.10.1
 	golang.org/x/crypto v0.42.0
+	golang.org/x/term v0.35.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
+	github.com/kr/fs v0.1.0 // indirect
 	github.com/spf13/pflag v1.0.9 // indirect
 	golang.org/x/sys v0.36.0 // indirect
 )
@@ -2,8 +2,29 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultCacheMaxSize - размер кэша архивов по умолчанию, после которого удаляются давно не использованные архивы
+const defaultCacheMaxSize int64 = 2 << 30
+
+// SSHAuthMethods - поддерживаемые способы SSH-аутентификации в порядке попыток по умолчанию
+var SSHAuthMethods = []string{"agent", "key", "password", "keyboard-interactive"}
+
+// HostKeyPolicies - режимы проверки ключа SSH-сервера. tofu - синоним accept-new
+var HostKeyPolicies = []string{"strict", "accept-new", "tofu"}
+
+// Параметры сетевых передач по умолчанию
+const (
+	defaultConnectTimeout  = 30 * time.Second
+	defaultTransferTimeout = 2 * time.Minute
+	defaultRetries         = 3
 )
 
 type Config struct {
@@ -11,41 +32,371 @@ type Config struct {
 	SSHHost string
 	SSHPort int
 	SSHKey  string
+	// SSHAuth - способы SSH-аутентификации в порядке попыток (PM_SSH_AUTH): agent, key, password,
+	// keyboard-interactive. Пустой список - все способы в этом порядке
+	SSHAuth []string
+	// SSHKeyPassphrase - пароль зашифрованного ключа (PM_SSH_KEY_PASSPHRASE). Если не задан, запрашивается на терминале
+	SSHKeyPassphrase string
+	// SSHPassword - пароль для password и keyboard-interactive (PM_SSH_PASSWORD). Если не задан, запрашивается на терминале
+	SSHPassword string
+	// HostKeyPolicy - проверка ключа SSH-сервера (PM_SSH_HOST_KEY_POLICY): strict (по умолчанию), accept-new, tofu
+	HostKeyPolicy string
+	// HostKeyFingerprint - ожидаемый отпечаток ключа SSH-сервера SHA256:... (PM_SSH_HOST_KEY_FINGERPRINT).
+	// Если задан, known_hosts для основного хоста не используется; промежуточные хосты проверяются по known_hosts
+	HostKeyFingerprint string
+	// KnownHosts - файл известных ключей SSH-серверов (PM_SSH_KNOWN_HOSTS), пустое значение - ~/.ssh/known_hosts
+	KnownHosts string
+	// SSHJumps - промежуточные хосты (ProxyJump), через которые по порядку устанавливается SSH-соединение
+	SSHJumps []SSHJump
+	// Repository - URL репозитория пакетов: ssh://user@host:port/path, sftp://user@host:port/path,
+	// file:///srv/pm-repo, https://host/path.
+	// Пустое значение означает SSH-репозиторий из переменных PM_SSH_*
+	Repository string
+	// SigningKey - закрытый SSH-ключ для pm create --sign (PM_SIGNING_KEY, по умолчанию PM_SSH_KEY)
+	SigningKey string
+	// TrustedKeys - файл доверенных ключей для проверки подписей (PM_TRUSTED_KEYS)
+	TrustedKeys string
+	// CacheDir - локальный кэш скачанных архивов (PM_CACHE_DIR, по умолчанию ~/.cache/pm).
+	// Пустое значение отключает кэш
+	CacheDir string
+	// CacheMaxSize - допустимый размер кэша в байтах (PM_CACHE_MAX_SIZE), 0 - без ограничения
+	CacheMaxSize int64
+	// Offline запрещает обращения к хранилищу: архивы берутся только из кэша (PM_OFFLINE)
+	Offline bool
+	// ConnectTimeout - время на установку соединения с хранилищем (PM_CONNECT_TIMEOUT), 0 - без ограничения
+	ConnectTimeout time.Duration
+	// TransferTimeout - допустимое время без передачи данных (PM_TRANSFER_TIMEOUT), 0 - без ограничения
+	TransferTimeout time.Duration
+	// Retries - число повторов операции с хранилищем при временных ошибках сети (PM_RETRIES)
+	Retries int
+}
+
+// LoadConfig загружает конфигурацию хранилища remoteName (пустое имя - PM_REMOTE или хранилище
+// по умолчанию из файлов конфигурации). Переменные окружения имеют приоритет над файлом проекта
+// .pm.yaml, а он - над пользовательским ~/.config/pm/config.yaml
+func LoadConfig(remoteName string) (*Config, error) {
+	remote, err := selectRemote(remoteName)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{
+		Repository:  os.Getenv("PM_REPOSITORY"),
+		SigningKey:  os.Getenv("PM_SIGNING_KEY"),
+		TrustedKeys: os.Getenv("PM_TRUSTED_KEYS"),
+	}
+	if cfg.Repository == "" && remote != nil {
+		if cfg.Repository, err = remote.RepositoryURL(); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.SigningKey == "" {
+		cfg.SigningKey = sshKey(remote)
+	}
+	if cfg.TrustedKeys == "" {
+		if configDir, err := os.UserConfigDir(); err == nil {
+			cfg.TrustedKeys = filepath.Join(configDir, "pm", "trusted_keys")
+		}
+	}
+	if err := loadCacheConfig(cfg); err != nil {
+		return nil, err
+	}
+	if err := loadNetworkConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	var repoURL *url.URL
+	if cfg.Repository != "" {
+		u, err := url.Parse(cfg.Repository)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for PM_REPOSITORY: %w", err)
+		}
+		switch u.Scheme {
+		case "ssh", "sftp":
+			repoURL = u
+		case "file", "http", "https":
+			// SSH-настройки для этих хранилищ не нужны
+			return cfg, nil
+		default:
+			return nil, fmt.Errorf("unsupported PM_REPOSITORY scheme %q", u.Scheme)
+		}
+	}
+
+	if err := loadSSHConfig(cfg, repoURL, remote); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// LoadCacheConfig загружает только параметры локального кэша: командам работы с кэшем
+// не нужны настройки хранилища
+func LoadCacheConfig() (*Config, error) {
+	cfg := &Config{}
+	if err := loadCacheConfig(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// loadCacheConfig заполняет параметры локального кэша архивов и автономного режима
+func loadCacheConfig(cfg *Config) error {
+	cfg.CacheDir = os.Getenv("PM_CACHE_DIR")
+	if cfg.CacheDir == "" {
+		if cacheDir, err := os.UserCacheDir(); err == nil {
+			cfg.CacheDir = filepath.Join(cacheDir, "pm")
+		}
+	}
+
+	cfg.CacheMaxSize = defaultCacheMaxSize
+	if value := os.Getenv("PM_CACHE_MAX_SIZE"); value != "" {
+		size, err := parseSize(value)
+		if err != nil {
+			return fmt.Errorf("invalid value for PM_CACHE_MAX_SIZE: %w", err)
+		}
+		cfg.CacheMaxSize = size
+	}
+
+	if value := os.Getenv("PM_OFFLINE"); value != "" {
+		offline, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid value for PM_OFFLINE: %w", err)
+		}
+		cfg.Offline = offline
+	}
+	return nil
+}
+
+// loadNetworkConfig заполняет таймауты и число повторов сетевых операций
+func loadNetworkConfig(cfg *Config) error {
+	var err error
+	if cfg.ConnectTimeout, err = durationEnv("PM_CONNECT_TIMEOUT", defaultConnectTimeout); err != nil {
+		return err
+	}
+	if cfg.TransferTimeout, err = durationEnv("PM_TRANSFER_TIMEOUT", defaultTransferTimeout); err != nil {
+		return err
+	}
+
+	cfg.Retries = defaultRetries
+	if value := os.Getenv("PM_RETRIES"); value != "" {
+		retries, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid value for PM_RETRIES: %w", err)
+		}
+		if retries < 0 {
+			return fmt.Errorf("PM_RETRIES must not be negative")
+		}
+		cfg.Retries = retries
+	}
+	return nil
 }
 
-func LoadConfig() (*Config, error) {
+// durationEnv читает длительность из переменной окружения: "30s", "2m" или число секунд
+func durationEnv(name string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+	if _, err := strconv.Atoi(value); err == nil {
+		value += "s"
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value for %s: %w", name, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("%s must not be negative", name)
+	}
+	return d, nil
+}
+
+// parseSize разбирает размер в байтах с необязательным суффиксом K, M или G (степени 1024)
+func parseSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	value = strings.TrimSuffix(value, "B")
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(value, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(value, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(value, "G"):
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		value = value[:len(value)-1]
+	}
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if size < 0 || size > (1<<62)/multiplier {
+		return 0, fmt.Errorf("size out of range: %s", value)
+	}
+	return size * multiplier, nil
+}
+
+// loadSSHConfig заполняет параметры SSH. Пользователь, хост и порт из URL репозитория
+// имеют приоритет над переменными окружения, переменные - над хранилищем из файла конфигурации,
+// а оно - над ~/.ssh/config
+func loadSSHConfig(cfg *Config, repoURL *url.URL, remote *Remote) error {
 	sshUser := os.Getenv("PM_SSH_USER")
+	sshHost := os.Getenv("PM_SSH_HOST")
+	sshPortStr := os.Getenv("PM_SSH_PORT")
+	if remote != nil {
+		if sshUser == "" {
+			sshUser = remote.User
+		}
+		if sshHost == "" {
+			sshHost = remote.Host
+		}
+		if sshPortStr == "" && remote.Port != 0 {
+			sshPortStr = strconv.Itoa(remote.Port)
+		}
+	}
+	if repoURL != nil {
+		if repoURL.User != nil && repoURL.User.Username() != "" {
+			sshUser = repoURL.User.Username()
+		}
+		if repoURL.Hostname() != "" {
+			sshHost = repoURL.Hostname()
+		}
+		if repoURL.Port() != "" {
+			sshPortStr = repoURL.Port()
+		}
+	}
+
+	// Хост может быть псевдонимом из ~/.ssh/config: его параметры дополняют явно заданные
+	sshConfig, err := loadSSHClientConfig()
+	if err != nil {
+		return err
+	}
+	host, err := sshConfig.Lookup(sshHost)
+	if err != nil {
+		return fmt.Errorf("invalid ssh config: %w", err)
+	}
 	if sshUser == "" {
-		return nil, fmt.Errorf("environment variable PM_SSH_USER is not set")
+		sshUser = host.User
+	}
+	if sshPortStr == "" && host.Port != 0 {
+		sshPortStr = strconv.Itoa(host.Port)
+	}
+	sshHost = host.HostName
+
+	if sshUser == "" {
+		return missingSetting("PM_SSH_USER", "user", remote)
 	}
 
-	sshHost := os.Getenv("PM_SSH_HOST")
 	if sshHost == "" {
-		return nil, fmt.Errorf("environment variable PM_SSH_HOST is not set")
+		return missingSetting("PM_SSH_HOST", "host", remote)
 	}
 
-	sshPortStr := os.Getenv("PM_SSH_PORT")
 	if sshPortStr == "" {
 		sshPortStr = "22"
 	}
 	sshPort, err := strconv.Atoi(sshPortStr)
 	if err != nil {
-		return nil, fmt.Errorf("invalid value for PM_SSH_PORT: %w", err)
+		return fmt.Errorf("invalid value for PM_SSH_PORT: %w", err)
 	}
 
 	if sshPort < 1 || sshPort > 65535 {
-		return nil, fmt.Errorf("PM_SSH_PORT must be between 1 and 65535")
+		return fmt.Errorf("PM_SSH_PORT must be between 1 and 65535")
 	}
 
-	sshKey := os.Getenv("PM_SSH_KEY")
-	if sshKey == "" {
-		return nil, fmt.Errorf("environment variable PM_SSH_KEY is not set")
+	auth, err := sshAuth(remote)
+	if err != nil {
+		return err
 	}
 
-	return &Config{
-		SSHUser: sshUser,
-		SSHHost: sshHost,
-		SSHPort: sshPort,
-		SSHKey:  sshKey,
-	}, nil
+	key := sshKey(remote)
+	if key == "" {
+		key = identityFile(host.IdentityFiles)
+	}
+	proxyJump := os.Getenv("PM_SSH_PROXY_JUMP")
+	if proxyJump == "" && remote != nil {
+		proxyJump = remote.ProxyJump
+	}
+	if proxyJump == "" {
+		proxyJump = host.ProxyJump
+	}
+	jumps, err := resolveJumps(sshConfig, proxyJump, 0)
+	if err != nil {
+		return err
+	}
+
+	cfg.SSHUser = sshUser
+	cfg.SSHHost = sshHost
+	cfg.SSHPort = sshPort
+	cfg.SSHKey = key
+	cfg.SSHAuth = auth
+	cfg.SSHJumps = jumps
+	cfg.SSHKeyPassphrase = os.Getenv("PM_SSH_KEY_PASSPHRASE")
+	cfg.SSHPassword = os.Getenv("PM_SSH_PASSWORD")
+	return loadHostKeyConfig(cfg, remote)
+}
+
+// loadHostKeyConfig заполняет параметры проверки ключа SSH-сервера
+func loadHostKeyConfig(cfg *Config, remote *Remote) error {
+	var policy, fingerprint, knownHosts string
+	if remote != nil {
+		policy, fingerprint, knownHosts = remote.HostKeyPolicy, remote.HostKeyFingerprint, remote.KnownHosts
+	}
+	policy = envOr("PM_SSH_HOST_KEY_POLICY", policy)
+	if policy == "" {
+		policy = "strict"
+	}
+	if !slices.Contains(HostKeyPolicies, policy) {
+		return fmt.Errorf("unsupported host key policy %q (supported: %s)", policy, strings.Join(HostKeyPolicies, ", "))
+	}
+	fingerprint = envOr("PM_SSH_HOST_KEY_FINGERPRINT", fingerprint)
+	if fingerprint != "" && !strings.HasPrefix(fingerprint, "SHA256:") {
+		return fmt.Errorf("host key fingerprint must start with SHA256: (as printed by ssh-keygen -lf)")
+	}
+
+	cfg.HostKeyPolicy = policy
+	cfg.HostKeyFingerprint = fingerprint
+	cfg.KnownHosts = expandHome(envOr("PM_SSH_KNOWN_HOSTS", knownHosts))
+	return nil
+}
+
+// envOr возвращает значение переменной окружения или fallback, если переменная не задана
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// sshAuth возвращает способы аутентификации из PM_SSH_AUTH (через запятую) или из хранилища
+// в файле конфигурации
+func sshAuth(remote *Remote) ([]string, error) {
+	var auth []string
+	if value := os.Getenv("PM_SSH_AUTH"); value != "" {
+		auth = strings.Split(value, ",")
+	} else if remote != nil {
+		// Копия: нормализация не должна менять загруженное хранилище
+		auth = slices.Clone(remote.Auth)
+	}
+	for i, method := range auth {
+		auth[i] = strings.TrimSpace(method)
+		if !slices.Contains(SSHAuthMethods, auth[i]) {
+			return nil, fmt.Errorf("unsupported SSH auth method %q (supported: %s)", auth[i], strings.Join(SSHAuthMethods, ", "))
+		}
+	}
+	return auth, nil
+}
+
+// sshKey возвращает путь к SSH-ключу из PM_SSH_KEY или из хранилища в файле конфигурации
+func sshKey(remote *Remote) string {
+	if key := os.Getenv("PM_SSH_KEY"); key != "" || remote == nil {
+		return key
+	}
+	return expandHome(remote.Key)
+}
+
+// missingSetting возвращает ошибку для параметра, который не задан ни переменной окружения,
+// ни в выбранном хранилище
+func missingSetting(env, field string, remote *Remote) error {
+	if remote == nil {
+		return fmt.Errorf("environment variable %s is not set", env)
+	}
+	return fmt.Errorf("environment variable %s is not set and remote %q has no %s", env, remote.Name, field)
 }
@@ -0,0 +1,264 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// setupConfigFiles очищает переменные PM_* и создает пользовательский файл конфигурации
+// и файл проекта с указанным содержимым (пустое содержимое - файла нет)
+func setupConfigFiles(t *testing.T, user, project string) {
+	t.Helper()
+	for _, name := range []string{"PM_REPOSITORY", "PM_REMOTE", "PM_SSH_USER", "PM_SSH_HOST", "PM_SSH_PORT",
+		"PM_SSH_KEY", "PM_SSH_AUTH", "PM_SSH_HOST_KEY_POLICY", "PM_SSH_HOST_KEY_FINGERPRINT", "PM_SSH_KNOWN_HOSTS", "PM_SSH_CONFIG", "PM_SSH_PROXY_JUMP",
+		"PM_SIGNING_KEY", "PM_TRUSTED_KEYS", "PM_CACHE_DIR", "PM_OFFLINE"} {
+		t.Setenv(name, "")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	projectDir := t.TempDir()
+	t.Chdir(projectDir)
+
+	for path, data := range map[string]string{
+		filepath.Join(home, ".config", "pm", "config.yaml"): user,
+		filepath.Join(projectDir, ".pm.yaml"):               project,
+	} {
+		if data == "" {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Не удалось создать директорию: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatalf("Не удалось создать файл конфигурации: %v", err)
+		}
+	}
+}
+
+const testUserConfig = `
+default: staging
+remotes:
+  staging:
+    transport: sftp
+    host: staging.example.com
+    user: deploy
+    key: ~/.ssh/id_ed25519
+    root: /srv/pm-repo
+    auth: [agent, key]
+  production:
+    host: prod.example.com
+    host_key_policy: strict
+    known_hosts: ~/.ssh/pm_known_hosts
+    port: 2222
+    user: release
+    key: /keys/prod
+    root: srv/packages
+  mirror:
+    transport: https
+    host: mirror.example.com
+    root: pm
+`
+
+// TestLoadConfigRemotes проверяет выбор хранилища из файлов конфигурации и приоритет
+// переменных окружения над файлом проекта, а файла проекта - над пользовательским файлом
+func TestLoadConfigRemotes(t *testing.T) {
+	setupConfigFiles(t, testUserConfig, "remotes:\n  staging:\n    port: 2200\n")
+
+	cfg, err := LoadConfig("")
+	if err != nil {
+		t.Fatalf("Ошибка загрузки конфигурации: %v", err)
+	}
+	home, _ := os.UserHomeDir()
+	if cfg.Repository != "sftp:///srv/pm-repo" || cfg.SSHHost != "staging.example.com" || cfg.SSHPort != 2200 ||
+		cfg.SSHUser != "deploy" || cfg.SSHKey != filepath.Join(home, ".ssh", "id_ed25519") || cfg.SigningKey != cfg.SSHKey ||
+		strings.Join(cfg.SSHAuth, ",") != "agent,key" || cfg.HostKeyPolicy != "strict" {
+		t.Errorf("Неожиданная конфигурация хранилища по умолчанию: %+v", cfg)
+	}
+
+	cfg, err = LoadConfig("production")
+	if err != nil {
+		t.Fatalf("Ошибка загрузки конфигурации: %v", err)
+	}
+	if cfg.Repository != "ssh:///srv/packages" || cfg.SSHHost != "prod.example.com" || cfg.SSHPort != 2222 || cfg.SSHUser != "release" ||
+		cfg.HostKeyPolicy != "strict" || cfg.KnownHosts != filepath.Join(home, ".ssh", "pm_known_hosts") {
+		t.Errorf("Неожиданная конфигурация хранилища production: %+v", cfg)
+	}
+
+	cfg, err = LoadConfig("mirror")
+	if err != nil || cfg.Repository != "https://mirror.example.com/pm" {
+		t.Errorf("Ожидался HTTPS-репозиторий, получено %+v (%v)", cfg, err)
+	}
+
+	// Переменные окружения имеют приоритет над файлами конфигурации
+	t.Setenv("PM_REMOTE", "production")
+	t.Setenv("PM_SSH_USER", "ci")
+	t.Setenv("PM_SSH_KEY", "/keys/ci")
+	t.Setenv("PM_SSH_AUTH", "key, password")
+	cfg, err = LoadConfig("")
+	if err != nil {
+		t.Fatalf("Ошибка загрузки конфигурации: %v", err)
+	}
+	if cfg.SSHHost != "prod.example.com" || cfg.SSHUser != "ci" || cfg.SSHKey != "/keys/ci" ||
+		strings.Join(cfg.SSHAuth, ",") != "key,password" {
+		t.Errorf("Переменные окружения должны заменять значения из файла: %+v", cfg)
+	}
+	t.Setenv("PM_REPOSITORY", "file:///srv/local")
+	if cfg, err = LoadConfig(""); err != nil || cfg.Repository != "file:///srv/local" {
+		t.Errorf("PM_REPOSITORY должен заменять хранилище из файла, получено %+v (%v)", cfg, err)
+	}
+
+	if _, err := LoadConfig("missing"); err == nil || !strings.Contains(err.Error(), "mirror, production, staging") {
+		t.Errorf("Ожидалась ошибка с перечнем хранилищ, получено: %v", err)
+	}
+}
+
+// TestLoadConfigFileErrors проверяет ошибки в файлах конфигурации и работу без них
+func TestLoadConfigFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		project string
+		wantErr string
+	}{
+		{name: "неизвестное поле", project: "remotes:\n  a:\n    hots: example.com\n", wantErr: "hots"},
+		{name: "неизвестный транспорт", project: "default: a\nremotes:\n  a:\n    transport: ftp\n", wantErr: "ftp"},
+		{name: "file без корня", project: "default: a\nremotes:\n  a:\n    transport: file\n", wantErr: "root is required"},
+		{name: "неизвестный способ аутентификации", project: "default: a\nremotes:\n  a:\n    host: h\n    user: u\n    auth: [agent, gssapi]\n", wantErr: "gssapi"},
+		{name: "неизвестная политика ключа сервера", project: "default: a\nremotes:\n  a:\n    host: h\n    user: u\n    host_key_policy: ask\n", wantErr: "ask"},
+		{name: "отпечаток не SHA256", project: "default: a\nremotes:\n  a:\n    host: h\n    user: u\n    host_key_fingerprint: MD5:00\n", wantErr: "SHA256:"},
+		{name: "хранилище без хоста", project: "default: a\nremotes:\n  a:\n    user: u\n    key: k\n", wantErr: "remote \"a\" has no host"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupConfigFiles(t, "", tt.project)
+			if _, err := LoadConfig(""); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Ожидалась ошибка с %q, получено: %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	// Без файлов конфигурация берется только из переменных окружения
+	setupConfigFiles(t, "", "")
+	if _, err := LoadConfig(""); err == nil || err.Error() != "environment variable PM_SSH_USER is not set" {
+		t.Errorf("Ожидалась ошибка незаданной PM_SSH_USER, получено: %v", err)
+	}
+	t.Setenv("PM_REPOSITORY", "file:///srv/local")
+	if cfg, err := LoadConfig(""); err != nil || cfg.Repository != "file:///srv/local" {
+		t.Errorf("Ожидалась конфигурация из переменных окружения, получено %+v (%v)", cfg, err)
+	}
+}
+
+const testSSHConfig = `
+Host repo
+    HostName repo.internal
+    Port 2022
+    IdentityFile ~/.ssh/repo_key
+    ProxyJump bastion
+
+Host bastion
+    HostName bastion.example.com
+    User jump
+    ProxyJump gate:2200
+
+Host *
+    User deploy
+    IdentityFile ~/.ssh/default_key
+`
+
+// TestLoadConfigJumpDefaults проверяет, что промежуточные хосты, как и в ssh, не наследуют пользователя
+// и ключ основного хоста, а используют локального пользователя и ключ по умолчанию
+func TestLoadConfigJumpDefaults(t *testing.T) {
+	setupConfigFiles(t, "", "")
+	home, _ := os.UserHomeDir()
+	if err := os.MkdirAll(filepath.Join(home, ".ssh"), 0700); err != nil {
+		t.Fatalf("Не удалось создать директорию .ssh: %v", err)
+	}
+	sshConfig := "Host repo\n    HostName repo.internal\n    User deploy\n    IdentityFile ~/.ssh/repo_key\n" +
+		"    ProxyJump ops@edge,bastion\n\nHost bastion\n    HostName bastion.example.com\n"
+	for name, data := range map[string]string{"config": sshConfig, "repo_key": "key", "id_ed25519": "key"} {
+		if err := os.WriteFile(filepath.Join(home, ".ssh", name), []byte(data), 0600); err != nil {
+			t.Fatalf("Не удалось создать файл %s: %v", name, err)
+		}
+	}
+	t.Setenv("PM_SSH_HOST", "repo")
+	t.Setenv("PM_SSH_KEY", filepath.Join(home, ".ssh", "repo_key"))
+
+	cfg, err := LoadConfig("")
+	if err != nil {
+		t.Fatalf("Ошибка загрузки конфигурации: %v", err)
+	}
+	defaultKey := filepath.Join(home, ".ssh", "id_ed25519")
+	wantJumps := []SSHJump{
+		{Host: "edge", Port: 22, User: "ops", Key: defaultKey},
+		{Host: "bastion.example.com", Port: 22, User: localUser(), Key: defaultKey},
+	}
+	if cfg.SSHUser != "deploy" || !slices.Equal(cfg.SSHJumps, wantJumps) {
+		t.Errorf("Ожидались промежуточные хосты %+v, получено %+v (пользователь %s)", wantJumps, cfg.SSHJumps, cfg.SSHUser)
+	}
+}
+
+// TestLoadConfigSSHConfig проверяет подстановку псевдонима, ключа и цепочки ProxyJump из ~/.ssh/config
+func TestLoadConfigSSHConfig(t *testing.T) {
+	setupConfigFiles(t, "", "")
+	home, _ := os.UserHomeDir()
+	if err := os.MkdirAll(filepath.Join(home, ".ssh"), 0700); err != nil {
+		t.Fatalf("Не удалось создать директорию .ssh: %v", err)
+	}
+	for _, name := range []string{"config", "repo_key", "default_key"} {
+		data := testSSHConfig
+		if name != "config" {
+			data = "key"
+		}
+		if err := os.WriteFile(filepath.Join(home, ".ssh", name), []byte(data), 0600); err != nil {
+			t.Fatalf("Не удалось создать файл %s: %v", name, err)
+		}
+	}
+	t.Setenv("PM_SSH_HOST", "repo")
+
+	cfg, err := LoadConfig("")
+	if err != nil {
+		t.Fatalf("Ошибка загрузки конфигурации: %v", err)
+	}
+	repoKey := filepath.Join(home, ".ssh", "repo_key")
+	if cfg.SSHHost != "repo.internal" || cfg.SSHPort != 2022 || cfg.SSHUser != "deploy" || cfg.SSHKey != repoKey {
+		t.Errorf("Неожиданные параметры хоста из ~/.ssh/config: %+v", cfg)
+	}
+	// ProxyJump первого промежуточного хоста добавляется перед ним, пользователь и ключ gate берутся из Host *
+	wantJumps := []SSHJump{
+		{Host: "gate", Port: 2200, User: "deploy", Key: filepath.Join(home, ".ssh", "default_key")},
+		{Host: "bastion.example.com", Port: 22, User: "jump", Key: filepath.Join(home, ".ssh", "default_key")},
+	}
+	if !slices.Equal(cfg.SSHJumps, wantJumps) {
+		t.Errorf("Неожиданная цепочка промежуточных хостов: %+v", cfg.SSHJumps)
+	}
+
+	// Явные значения имеют приоритет над ~/.ssh/config
+	t.Setenv("PM_SSH_PORT", "22")
+	t.Setenv("PM_SSH_USER", "ci")
+	t.Setenv("PM_SSH_PROXY_JUMP", "none")
+	if cfg, err = LoadConfig(""); err != nil || cfg.SSHPort != 22 || cfg.SSHUser != "ci" || cfg.SSHKey != repoKey || len(cfg.SSHJumps) != 0 {
+		t.Errorf("Переменные окружения должны заменять значения из ~/.ssh/config: %+v (%v)", cfg, err)
+	}
+
+	// PM_SSH_CONFIG=none отключает ~/.ssh/config
+	t.Setenv("PM_SSH_CONFIG", "none")
+	if cfg, err = LoadConfig(""); err != nil || cfg.SSHHost != "repo" || cfg.SSHKey != "" {
+		t.Errorf("Ожидалось подключение без ~/.ssh/config: %+v (%v)", cfg, err)
+	}
+}
+
+// TestSSHAuthKeepsRemote проверяет, что нормализация способов аутентификации не меняет хранилище
+func TestSSHAuthKeepsRemote(t *testing.T) {
+	t.Setenv("PM_SSH_AUTH", "")
+	remote := &Remote{Name: "staging", Auth: []string{" agent", "key "}}
+	auth, err := sshAuth(remote)
+	if err != nil || strings.Join(auth, ",") != "agent,key" {
+		t.Errorf("Ожидались способы agent,key, получено %q (%v)", auth, err)
+	}
+	if strings.Join(remote.Auth, ",") != " agent,key " {
+		t.Errorf("Способы аутентификации хранилища изменены: %q", remote.Auth)
+	}
+}
@@ -0,0 +1,244 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// projectConfigFile - файл конфигурации проекта в текущей директории, дополняет пользовательский
+const projectConfigFile = ".pm.yaml"
+
+// Remote - именованное хранилище пакетов из файла конфигурации
+type Remote struct {
+	Name string `yaml:"-"`
+	// Transport - способ доступа к хранилищу: ssh (по умолчанию), sftp, file, http, https
+	Transport string `yaml:"transport"`
+	Host      string `yaml:"host"`
+	Port      int    `yaml:"port"`
+	User      string `yaml:"user"`
+	Key       string `yaml:"key"`
+	// Root - корень репозитория на сервере (для file - локальная директория)
+	Root string `yaml:"root"`
+	// Auth - способы SSH-аутентификации в порядке попыток
+	Auth []string `yaml:"auth"`
+	// HostKeyPolicy, HostKeyFingerprint и KnownHosts - проверка ключа SSH-сервера
+	HostKeyPolicy      string `yaml:"host_key_policy"`
+	HostKeyFingerprint string `yaml:"host_key_fingerprint"`
+	KnownHosts         string `yaml:"known_hosts"`
+	// ProxyJump - промежуточные хосты через запятую, как в ~/.ssh/config
+	ProxyJump string `yaml:"proxy_jump"`
+}
+
+// fileConfig - содержимое файла конфигурации
+type fileConfig struct {
+	// Default - хранилище, которое используется без флага --remote
+	Default string             `yaml:"default"`
+	Remotes map[string]*Remote `yaml:"remotes"`
+}
+
+// userConfigPath возвращает путь к пользовательскому файлу конфигурации (~/.config/pm/config.yaml)
+func userConfigPath() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(configDir, "pm", "config.yaml")
+}
+
+// readConfigFile читает файл конфигурации. Отсутствующий файл считается пустым
+func readConfigFile(path string) (*fileConfig, error) {
+	fc := &fileConfig{}
+	if path == "" {
+		return fc, nil
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fc, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer f.Close()
+
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(fc); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	for name, remote := range fc.Remotes {
+		if remote == nil {
+			fc.Remotes[name] = &Remote{}
+		}
+	}
+	return fc, nil
+}
+
+// merge дополняет конфигурацию значениями из override: заданные в override поля хранилищ
+// заменяют одноименные поля, остальные сохраняются
+func (fc *fileConfig) merge(override *fileConfig) {
+	if override.Default != "" {
+		fc.Default = override.Default
+	}
+	if fc.Remotes == nil {
+		fc.Remotes = map[string]*Remote{}
+	}
+	for name, o := range override.Remotes {
+		r, ok := fc.Remotes[name]
+		if !ok {
+			r = &Remote{}
+			fc.Remotes[name] = r
+		}
+		if o.Transport != "" {
+			r.Transport = o.Transport
+		}
+		if o.Host != "" {
+			r.Host = o.Host
+		}
+		if o.Port != 0 {
+			r.Port = o.Port
+		}
+		if o.User != "" {
+			r.User = o.User
+		}
+		if o.Key != "" {
+			r.Key = o.Key
+		}
+		if o.Root != "" {
+			r.Root = o.Root
+		}
+		if len(o.Auth) > 0 {
+			r.Auth = o.Auth
+		}
+		if o.HostKeyPolicy != "" {
+			r.HostKeyPolicy = o.HostKeyPolicy
+		}
+		if o.HostKeyFingerprint != "" {
+			r.HostKeyFingerprint = o.HostKeyFingerprint
+		}
+		if o.KnownHosts != "" {
+			r.KnownHosts = o.KnownHosts
+		}
+		if o.ProxyJump != "" {
+			r.ProxyJump = o.ProxyJump
+		}
+	}
+}
+
+// loadRemotes читает пользовательский файл конфигурации и файл проекта и возвращает
+// хранилища по именам вместе с именем хранилища по умолчанию. Значения из файла проекта
+// имеют приоритет над пользовательскими
+func loadRemotes() (map[string]*Remote, string, error) {
+	fc, err := readConfigFile(userConfigPath())
+	if err != nil {
+		return nil, "", err
+	}
+	project, err := readConfigFile(projectConfigFile)
+	if err != nil {
+		return nil, "", err
+	}
+	fc.merge(project)
+	for name, remote := range fc.Remotes {
+		remote.Name = name
+	}
+	return fc.Remotes, fc.Default, nil
+}
+
+// selectRemote выбирает хранилище по имени из флага --remote, переменной PM_REMOTE
+// или по умолчанию из файлов конфигурации. Возвращает nil, если хранилище не выбрано
+func selectRemote(name string) (*Remote, error) {
+	remotes, defaultName, err := loadRemotes()
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = os.Getenv("PM_REMOTE")
+	}
+	if name == "" {
+		name = defaultName
+	}
+	if name == "" {
+		return nil, nil
+	}
+	remote, ok := remotes[name]
+	if !ok {
+		names := make([]string, 0, len(remotes))
+		for n := range remotes {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("remote %q is not defined (available: %s)", name, strings.Join(names, ", "))
+	}
+	if err := remote.validate(); err != nil {
+		return nil, err
+	}
+	return remote, nil
+}
+
+// validate проверяет транспорт и порт хранилища
+func (r *Remote) validate() error {
+	switch r.Transport {
+	case "", "ssh", "sftp", "file", "http", "https":
+	default:
+		return fmt.Errorf("remote %q: unsupported transport %q", r.Name, r.Transport)
+	}
+	if r.Port < 0 || r.Port > 65535 {
+		return fmt.Errorf("remote %q: port must be between 1 and 65535", r.Name)
+	}
+	if r.Transport == "file" && r.Root == "" {
+		return fmt.Errorf("remote %q: root is required for file transport", r.Name)
+	}
+	if (r.Transport == "http" || r.Transport == "https") && r.Host == "" {
+		return fmt.Errorf("remote %q: host is required for %s transport", r.Name, r.Transport)
+	}
+	return nil
+}
+
+// RepositoryURL формирует URL репозитория для хранилища. Для SSH и SFTP в URL попадают только
+// транспорт и корень: пользователь, хост и порт подставляются отдельно, чтобы переменные
+// PM_SSH_* имели приоритет над файлом конфигурации
+func (r *Remote) RepositoryURL() (string, error) {
+	transport := r.Transport
+	if transport == "" {
+		transport = "ssh"
+	}
+	u := url.URL{Scheme: transport, Path: r.Root}
+	switch transport {
+	case "file":
+		root, err := filepath.Abs(expandHome(r.Root))
+		if err != nil {
+			return "", fmt.Errorf("remote %q: invalid root: %w", r.Name, err)
+		}
+		u.Path = filepath.ToSlash(root)
+	case "http", "https":
+		u.Host = r.Host
+		if r.Port != 0 {
+			u.Host = r.Host + ":" + strconv.Itoa(r.Port)
+		}
+	}
+	if u.Path != "" && !strings.HasPrefix(u.Path, "/") {
+		u.Path = "/" + u.Path
+	}
+	return u.String(), nil
+}
+
+// expandHome раскрывает ~/ в начале пути в домашнюю директорию пользователя
+func expandHome(p string) string {
+	if p != "~" && !strings.HasPrefix(p, "~/") {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return p
+	}
+	return filepath.Join(home, p[1:])
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+
+	"package-manager/internal/sshconfig"
+)
+
+// maxJumpDepth ограничивает вложенность ProxyJump у промежуточных хостов
+const maxJumpDepth = 8
+
+// defaultIdentityFiles - ключи, которые пробует ssh, если IdentityFile не задан
+var defaultIdentityFiles = []string{"~/.ssh/id_ed25519", "~/.ssh/id_ecdsa", "~/.ssh/id_rsa"}
+
+// SSHJump - промежуточный хост, через который устанавливается SSH-соединение
+type SSHJump struct {
+	Host string
+	Port int
+	User string
+	// Key - ключ для промежуточного хоста: IdentityFile из ~/.ssh/config, по умолчанию ключ ssh по умолчанию
+	Key string
+}
+
+// loadSSHClientConfig читает настройки клиента OpenSSH из PM_SSH_CONFIG (по умолчанию ~/.ssh/config).
+// Значение none отключает их
+func loadSSHClientConfig() (*sshconfig.Config, error) {
+	path := envOr("PM_SSH_CONFIG", sshconfig.DefaultPath())
+	if path == "none" {
+		path = ""
+	}
+	sshConfig, err := sshconfig.Load(expandHome(path))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ssh config: %w", err)
+	}
+	return sshConfig, nil
+}
+
+// localUser возвращает имя локального пользователя: его ssh использует для хостов без User
+func localUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// identityFile возвращает первый существующий ключ из IdentityFile, а без них - из ключей ssh по умолчанию
+func identityFile(identities []string) string {
+	if len(identities) == 0 {
+		identities = defaultIdentityFiles
+	}
+	for _, identity := range identities {
+		identity = expandHome(identity)
+		if _, err := os.Stat(identity); err == nil {
+			return identity
+		}
+	}
+	return ""
+}
+
+// resolveJumps разбирает цепочку ProxyJump и подставляет параметры промежуточных хостов из ~/.ssh/config.
+// Как и в ssh, собственный ProxyJump учитывается только у первого хоста цепочки, а пользователь и ключ,
+// не заданные для промежуточного хоста, не наследуются от основного: используются локальный пользователь
+// и ключи ssh по умолчанию
+func resolveJumps(sshConfig *sshconfig.Config, spec string, depth int) ([]SSHJump, error) {
+	hops, err := sshconfig.ParseProxyJump(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ProxyJump: %w", err)
+	}
+	if len(hops) > 0 && depth >= maxJumpDepth {
+		return nil, fmt.Errorf("ProxyJump chain is too long (more than %d levels)", maxJumpDepth)
+	}
+
+	var jumps []SSHJump
+	for i, hop := range hops {
+		host, err := sshConfig.Lookup(hop.Host)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ssh config: %w", err)
+		}
+		jump := SSHJump{Host: host.HostName, Port: hop.Port, User: hop.User, Key: identityFile(host.IdentityFiles)}
+		if jump.Port == 0 {
+			jump.Port = host.Port
+		}
+		if jump.Port == 0 {
+			jump.Port = 22
+		}
+		if jump.User == "" {
+			jump.User = host.User
+		}
+		if jump.User == "" {
+			jump.User = localUser()
+		}
+		if i == 0 && host.ProxyJump != "" {
+			prefix, err := resolveJumps(sshConfig, host.ProxyJump, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			jumps = append(jumps, prefix...)
+		}
+		jumps = append(jumps, jump)
+	}
+	return jumps, nil
+}
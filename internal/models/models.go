@@ -1,25 +1,154 @@
 package models
 
+import (
+	"encoding/json"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
 // CreateConfig представляет структуру файла packet.json
 type CreateConfig struct {
-	Name    string         `json:"name" yaml:"name"`
-	Ver     string         `json:"ver" yaml:"ver"`
+	Name string `json:"name" yaml:"name"`
+	Ver  string `json:"ver" yaml:"ver"`
+	// Format - формат архива: zip (по умолчанию), tar.gz или tar.zst
+	Format  string         `json:"format,omitempty" yaml:"format,omitempty"`
 	Targets []TargetConfig `json:"targets" yaml:"targets"`
+	Packets []Package      `json:"packets,omitempty" yaml:"packets,omitempty"`
 }
 
 // TargetConfig представляет элемент в массиве `targets`
 type TargetConfig struct {
-	Path    string `json:"path" yaml:"path"`
-	Exclude string `json:"exclude,omitempty" yaml:"exclude,omitempty"`
+	// Path - маска файлов; поддерживается ** для любого числа директорий
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+	// Include - дополнительные маски файлов цели
+	Include []string `json:"include,omitempty" yaml:"include,omitempty"`
+	// Exclude - маски исключений: строка или список. Сравниваются с именем файла и с путем
+	Exclude Patterns `json:"exclude,omitempty" yaml:"exclude,omitempty"`
+	// UseIgnoreFiles учитывает файлы .gitignore и .pmignore в директориях цели
+	UseIgnoreFiles bool `json:"use_ignore_files,omitempty" yaml:"use_ignore_files,omitempty"`
+	// Layout - пути файлов в архиве: relative (относительно директории маски) или flatten
+	Layout string `json:"layout,omitempty" yaml:"layout,omitempty"`
+	// ArchivePath - путь в архиве: новое имя для пути без шаблонов, иначе директория для найденных файлов
+	ArchivePath string `json:"archive_path,omitempty" yaml:"archive_path,omitempty"`
+}
+
+// Patterns - список масок, который в файле можно записать одной строкой
+type Patterns []string
+
+func (p *Patterns) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*p = Patterns{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*p = list
+	return nil
+}
+
+func (p *Patterns) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*p = Patterns{node.Value}
+		return nil
+	}
+	var list []string
+	if err := node.Decode(&list); err != nil {
+		return err
+	}
+	*p = list
+	return nil
 }
 
 // UpdateConfig представляет структуру файла
 type UpdateConfig struct {
-	Packages []Package `json:"packages" yaml:"packages"`
+	// Signature - политика проверки подписей по умолчанию: required, optional или none
+	Signature string    `json:"signature,omitempty" yaml:"signature,omitempty"`
+	Packages  []Package `json:"packages" yaml:"packages"`
 }
 
 // Package представляет элемент в массиве `packages`
 type Package struct {
 	Name string `json:"name" yaml:"name"`
 	Ver  string `json:"ver,omitempty" yaml:"ver,omitempty"`
+	// Signature - политика проверки подписи пакета в файле пакетов, переопределяет общую
+	Signature string `json:"signature,omitempty" yaml:"signature,omitempty"`
+	// Dest - директория установки пакета (по умолчанию текущая)
+	Dest string `json:"dest,omitempty" yaml:"dest,omitempty"`
+	// StripPrefix - префикс путей в архиве, который отбрасывается при установке.
+	// Записи вне префикса не устанавливаются
+	StripPrefix string `json:"strip_prefix,omitempty" yaml:"strip_prefix,omitempty"`
+	// Paths - устанавливаемые части архива (пути после strip_prefix или шаблоны); пусто - весь архив
+	Paths []string `json:"paths,omitempty" yaml:"paths,omitempty"`
+}
+
+// PackageIndex представляет индекс пакета на сервере (файл <name>/index.json)
+type PackageIndex struct {
+	Name     string       `json:"name" yaml:"name"`
+	Versions []IndexEntry `json:"versions" yaml:"versions"`
+}
+
+// IndexEntry представляет опубликованную версию пакета в индексе
+type IndexEntry struct {
+	Ver      string `json:"ver" yaml:"ver"`
+	Checksum string `json:"checksum" yaml:"checksum"`
+	Size     int64  `json:"size" yaml:"size"`
+	// Format - формат архива: tar.gz или tar.zst; пусто - zip
+	Format    string    `json:"format,omitempty" yaml:"format,omitempty"`
+	Packets   []Package `json:"packets,omitempty" yaml:"packets,omitempty"`
+	Published time.Time `json:"published" yaml:"published"`
+	// Signature - SSH-подпись архива (формат ssh-keygen -Y sign, пространство имен pm)
+	Signature string `json:"signature,omitempty" yaml:"signature,omitempty"`
+}
+
+// RepositoryIndex представляет общий каталог пакетов на сервере (файл index.json)
+type RepositoryIndex struct {
+	Packages []IndexedPackage `json:"packages" yaml:"packages"`
+}
+
+// IndexedPackage представляет пакет в общем каталоге
+type IndexedPackage struct {
+	Name   string `json:"name" yaml:"name"`
+	Latest string `json:"latest" yaml:"latest"`
+}
+
+// LockFile представляет структуру файла packages.lock
+type LockFile struct {
+	// Requires - требования из файла пакетов, по которым построен lock-файл
+	Requires []Package       `json:"requires" yaml:"requires"`
+	Packages []LockedPackage `json:"packages" yaml:"packages"`
+}
+
+// LockedPackage представляет зафиксированную версию пакета в lock-файле
+type LockedPackage struct {
+	Name     string `json:"name" yaml:"name"`
+	Ver      string `json:"ver" yaml:"ver"`
+	Checksum string `json:"checksum" yaml:"checksum"`
+	// Format - формат архива из индекса пакета; пусто - zip
+	Format       string   `json:"format,omitempty" yaml:"format,omitempty"`
+	Signature    string   `json:"signature,omitempty" yaml:"signature,omitempty"`
+	Dependencies []string `json:"dependencies,omitempty" yaml:"dependencies,omitempty"`
+}
+
+// InstalledDB представляет базу установленных пакетов (файл .pm/installed.json в корне установки)
+type InstalledDB struct {
+	Packages []InstalledPackage `json:"packages"`
+}
+
+// InstalledPackage представляет установленный пакет и его файлы
+type InstalledPackage struct {
+	Name     string `json:"name"`
+	Ver      string `json:"ver"`
+	Checksum string `json:"checksum"`
+	// Dest - абсолютная директория установки вне корня установки (dest без --prefix); пусто - корень установки
+	Dest string `json:"dest,omitempty"`
+	// Files - пути относительно корня установки (или Dest); директории записываются с завершающим слешем
+	Files        []string  `json:"files"`
+	Dependencies []string  `json:"dependencies,omitempty"`
+	Installed    time.Time `json:"installed"`
+	// Previous - замененная версия пакета, файлы которой сохранены для pm rollback
+	Previous *InstalledPackage `json:"previous,omitempty"`
 }
@@ -0,0 +1,265 @@
+package resolver
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"package-manager/internal/models"
+	"package-manager/internal/semver"
+)
+
+// RootRequester - источник требований верхнего уровня (файл packages.json)
+const RootRequester = "packages.json"
+
+// Source предоставляет резолверу сведения о доступных версиях и зависимостях пакетов
+type Source interface {
+	// Versions возвращает версии пакета, доступные для установки
+	Versions(name string) ([]semver.Version, error)
+	// Dependencies возвращает зависимости конкретной версии пакета
+	Dependencies(name string, version semver.Version) ([]models.Package, error)
+}
+
+// Requirement - ограничение на версию пакета и его источник
+type Requirement struct {
+	Constraint semver.Constraint
+	// From - кто предъявил требование: RootRequester или "<имя> <версия>"
+	From string
+}
+
+func (r Requirement) String() string {
+	return fmt.Sprintf("%s (от %s)", r.Constraint, r.From)
+}
+
+// Resolved - выбранная версия пакета
+type Resolved struct {
+	Name         string
+	Version      semver.Version
+	Dependencies []string
+}
+
+// ConflictError сообщает, что ни одна версия пакета не удовлетворяет всем ограничениям
+type ConflictError struct {
+	Package      string
+	Requirements []Requirement
+	Available    []semver.Version
+}
+
+func (e *ConflictError) Error() string {
+	reqs := make([]string, len(e.Requirements))
+	for i, r := range e.Requirements {
+		reqs[i] = r.String()
+	}
+	available := make([]string, len(e.Available))
+	for i, v := range e.Available {
+		available[i] = v.Original()
+	}
+	if len(available) == 0 {
+		return fmt.Sprintf("пакет %s не найден (требуется: %s)", e.Package, strings.Join(reqs, "; "))
+	}
+	return fmt.Sprintf("нет версии пакета %s, удовлетворяющей всем ограничениям: %s (доступны: %s)",
+		e.Package, strings.Join(reqs, "; "), strings.Join(available, ", "))
+}
+
+// state - частичное решение: выбранные версии и накопленные ограничения
+type state struct {
+	selected     map[string]semver.Version
+	requirements map[string][]Requirement
+}
+
+func (s state) clone() state {
+	c := state{
+		selected:     make(map[string]semver.Version, len(s.selected)),
+		requirements: make(map[string][]Requirement, len(s.requirements)),
+	}
+	for k, v := range s.selected {
+		c.selected[k] = v
+	}
+	for k, v := range s.requirements {
+		c.requirements[k] = append([]Requirement(nil), v...)
+	}
+	return c
+}
+
+// satisfies проверяет версию пакета по всем накопленным ограничениям
+func (s state) satisfies(name string, v semver.Version) bool {
+	for _, r := range s.requirements[name] {
+		if !r.Constraint.Check(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// Resolver подбирает согласованный набор версий для дерева зависимостей
+type Resolver struct {
+	source   Source
+	versions map[string][]semver.Version
+	deps     map[string][]models.Package
+}
+
+// New создает резолвер поверх источника пакетов
+func New(source Source) *Resolver {
+	return &Resolver{
+		source:   source,
+		versions: make(map[string][]semver.Version),
+		deps:     make(map[string][]models.Package),
+	}
+}
+
+// Resolve подбирает версии для пакетов верхнего уровня и всех транзитивных зависимостей.
+// Возвращает пакеты в порядке установки: зависимости раньше зависящих от них пакетов
+func (r *Resolver) Resolve(roots []models.Package) ([]Resolved, error) {
+	initial := state{
+		selected:     make(map[string]semver.Version),
+		requirements: make(map[string][]Requirement),
+	}
+	var pending []string
+	for _, pkg := range roots {
+		constraint, err := semver.ParseConstraint(pkg.Ver)
+		if err != nil {
+			return nil, fmt.Errorf("пакет %s: %w", pkg.Name, err)
+		}
+		if _, seen := initial.requirements[pkg.Name]; !seen {
+			pending = append(pending, pkg.Name)
+		}
+		initial.requirements[pkg.Name] = append(initial.requirements[pkg.Name], Requirement{Constraint: constraint, From: RootRequester})
+	}
+
+	final, err := r.solve(initial, pending)
+	if err != nil {
+		return nil, err
+	}
+	return r.order(final, roots), nil
+}
+
+// solve выбирает версию для первого пакета из очереди и рекурсивно решает остаток,
+// откатываясь к следующей кандидатной версии при конфликте
+func (r *Resolver) solve(s state, pending []string) (state, error) {
+	if len(pending) == 0 {
+		return s, nil
+	}
+	name, rest := pending[0], pending[1:]
+	if _, ok := s.selected[name]; ok {
+		return r.solve(s, rest)
+	}
+
+	available, err := r.availableVersions(name)
+	if err != nil {
+		return state{}, err
+	}
+
+	var candidates []semver.Version
+	for _, v := range available {
+		if s.satisfies(name, v) {
+			candidates = append(candidates, v)
+		}
+	}
+	if len(candidates) == 0 {
+		return state{}, &ConflictError{Package: name, Requirements: s.requirements[name], Available: available}
+	}
+
+	var lastErr error
+	// Перебираем версии от новой к старой
+	for i := len(candidates) - 1; i >= 0; i-- {
+		candidate := candidates[i]
+		deps, err := r.dependencies(name, candidate)
+		if err != nil {
+			return state{}, err
+		}
+
+		next := s.clone()
+		next.selected[name] = candidate
+		nextPending := append([]string(nil), rest...)
+		from := fmt.Sprintf("%s %s", name, candidate.Original())
+
+		var conflict error
+		for _, dep := range deps {
+			constraint, err := semver.ParseConstraint(dep.Ver)
+			if err != nil {
+				return state{}, fmt.Errorf("зависимость %s пакета %s: %w", dep.Name, from, err)
+			}
+			next.requirements[dep.Name] = append(next.requirements[dep.Name], Requirement{Constraint: constraint, From: from})
+			if chosen, ok := next.selected[dep.Name]; ok {
+				// Зависимость уже выбрана ранее: новая версия должна быть с ней совместима
+				if !constraint.Check(chosen) {
+					depVersions, _ := r.availableVersions(dep.Name)
+					conflict = &ConflictError{Package: dep.Name, Requirements: next.requirements[dep.Name], Available: depVersions}
+					break
+				}
+				continue
+			}
+			nextPending = append(nextPending, dep.Name)
+		}
+		if conflict != nil {
+			lastErr = conflict
+			continue
+		}
+
+		final, err := r.solve(next, nextPending)
+		if err == nil {
+			return final, nil
+		}
+		if _, ok := err.(*ConflictError); !ok {
+			return state{}, err
+		}
+		lastErr = err
+	}
+	return state{}, lastErr
+}
+
+// order строит порядок установки обходом графа зависимостей в глубину
+func (r *Resolver) order(s state, roots []models.Package) []Resolved {
+	var result []Resolved
+	visited := make(map[string]bool)
+
+	var visit func(name string)
+	visit = func(name string) {
+		if visited[name] {
+			return
+		}
+		visited[name] = true
+		version := s.selected[name]
+		var depNames []string
+		for _, dep := range r.deps[depKey(name, version)] {
+			depNames = append(depNames, dep.Name)
+			visit(dep.Name)
+		}
+		result = append(result, Resolved{Name: name, Version: version, Dependencies: depNames})
+	}
+	for _, pkg := range roots {
+		visit(pkg.Name)
+	}
+	return result
+}
+
+func (r *Resolver) availableVersions(name string) ([]semver.Version, error) {
+	if versions, ok := r.versions[name]; ok {
+		return versions, nil
+	}
+	versions, err := r.source.Versions(name)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось получить версии пакета %s: %w", name, err)
+	}
+	versions = append([]semver.Version(nil), versions...)
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Compare(versions[j]) < 0 })
+	r.versions[name] = versions
+	return versions, nil
+}
+
+func (r *Resolver) dependencies(name string, v semver.Version) ([]models.Package, error) {
+	key := depKey(name, v)
+	if deps, ok := r.deps[key]; ok {
+		return deps, nil
+	}
+	deps, err := r.source.Dependencies(name, v)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось получить зависимости пакета %s %s: %w", name, v.Original(), err)
+	}
+	r.deps[key] = deps
+	return deps, nil
+}
+
+func depKey(name string, v semver.Version) string {
+	return name + "@" + v.String()
+}
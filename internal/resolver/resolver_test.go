@@ -0,0 +1,126 @@
+package resolver
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"package-manager/internal/models"
+	"package-manager/internal/semver"
+)
+
+// fakeSource - источник пакетов в памяти: имя -> версия -> зависимости
+type fakeSource map[string]map[string][]models.Package
+
+func (f fakeSource) Versions(name string) ([]semver.Version, error) {
+	var versions []semver.Version
+	for v := range f[name] {
+		versions = append(versions, semver.MustParse(v))
+	}
+	return versions, nil
+}
+
+func (f fakeSource) Dependencies(name string, v semver.Version) ([]models.Package, error) {
+	return f[name][v.Original()], nil
+}
+
+func resolvedString(resolved []Resolved) string {
+	parts := make([]string, len(resolved))
+	for i, r := range resolved {
+		parts[i] = r.Name + "@" + r.Version.Original()
+	}
+	return strings.Join(parts, " ")
+}
+
+// TestResolveTransitive проверяет выбор транзитивных зависимостей и порядок установки
+func TestResolveTransitive(t *testing.T) {
+	source := fakeSource{
+		"app": {
+			"1.0": {{Name: "lib", Ver: "^1.0"}},
+			"2.0": {{Name: "lib", Ver: "^2.0"}},
+		},
+		"lib": {
+			"1.0": nil,
+			"1.5": {{Name: "base", Ver: ">=0.2"}},
+			"2.0": nil,
+		},
+		"base": {"0.1": nil, "0.3": nil},
+	}
+
+	resolved, err := New(source).Resolve([]models.Package{{Name: "app", Ver: "<2.0"}})
+	if err != nil {
+		t.Fatalf("Ожидалось успешное разрешение, получена ошибка: %v", err)
+	}
+	if got, want := resolvedString(resolved), "base@0.3 lib@1.5 app@1.0"; got != want {
+		t.Errorf("Ожидалось %q, получено %q", want, got)
+	}
+}
+
+// TestResolveDiamondBacktracking проверяет откат к более старой версии при ромбовидном конфликте
+func TestResolveDiamondBacktracking(t *testing.T) {
+	source := fakeSource{
+		"a": {"1.0": {{Name: "c", Ver: "^1.0"}}},
+		"b": {
+			"1.0": {{Name: "c", Ver: "^1.0"}},
+			"2.0": {{Name: "c", Ver: "^2.0"}},
+		},
+		"c": {"1.2": nil, "2.1": nil},
+	}
+
+	resolved, err := New(source).Resolve([]models.Package{{Name: "a"}, {Name: "b"}})
+	if err != nil {
+		t.Fatalf("Ожидалось успешное разрешение, получена ошибка: %v", err)
+	}
+	if got, want := resolvedString(resolved), "c@1.2 a@1.0 b@1.0"; got != want {
+		t.Errorf("Ожидалось %q, получено %q", want, got)
+	}
+}
+
+// TestResolveConflict проверяет, что ошибка называет конфликтующие ограничения
+func TestResolveConflict(t *testing.T) {
+	source := fakeSource{
+		"a": {"1.0": {{Name: "c", Ver: "^1.0"}}},
+		"b": {"1.0": {{Name: "c", Ver: ">=2.0"}}},
+		"c": {"1.2": nil, "2.1": nil},
+	}
+
+	_, err := New(source).Resolve([]models.Package{{Name: "a"}, {Name: "b"}})
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("Ожидалась ошибка конфликта, получено: %v", err)
+	}
+	if conflict.Package != "c" {
+		t.Errorf("Ожидался конфликт по пакету c, получен %s", conflict.Package)
+	}
+	for _, want := range []string{"^1.0 (от a 1.0)", ">=2.0 (от b 1.0)"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Ожидалось упоминание %q в ошибке: %v", want, err)
+		}
+	}
+}
+
+// TestResolveMissingPackage проверяет ошибку для отсутствующего пакета
+func TestResolveMissingPackage(t *testing.T) {
+	source := fakeSource{"a": {"1.0": {{Name: "ghost"}}}}
+
+	_, err := New(source).Resolve([]models.Package{{Name: "a"}})
+	if err == nil || !strings.Contains(err.Error(), "ghost") {
+		t.Errorf("Ожидалась ошибка об отсутствующем пакете ghost, получено: %v", err)
+	}
+}
+
+// TestResolveCycle проверяет, что циклические зависимости не приводят к зацикливанию
+func TestResolveCycle(t *testing.T) {
+	source := fakeSource{
+		"a": {"1.0": {{Name: "b"}}},
+		"b": {"1.0": {{Name: "a", Ver: "1.0"}}},
+	}
+
+	resolved, err := New(source).Resolve([]models.Package{{Name: "a"}})
+	if err != nil {
+		t.Fatalf("Ожидалось успешное разрешение, получена ошибка: %v", err)
+	}
+	if len(resolved) != 2 {
+		t.Errorf("Ожидалось 2 пакета, получено %d", len(resolved))
+	}
+}
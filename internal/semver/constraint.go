@@ -0,0 +1,195 @@
+package semver
+
+import (
+	"fmt"
+	"strings"
+)
+
+// operator - оператор сравнения в ограничении версии
+type operator string
+
+const (
+	opEQ operator = "="
+	opGT operator = ">"
+	opGE operator = ">="
+	opLT operator = "<"
+	opLE operator = "<="
+)
+
+// comparator - элементарное условие вида ">=1.2.0"
+type comparator struct {
+	op      operator
+	version Version
+}
+
+func (c comparator) check(v Version) bool {
+	cmp := v.Compare(c.version)
+	switch c.op {
+	case opEQ:
+		return cmp == 0
+	case opGT:
+		return cmp > 0
+	case opGE:
+		return cmp >= 0
+	case opLT:
+		return cmp < 0
+	case opLE:
+		return cmp <= 0
+	}
+	return false
+}
+
+// Constraint представляет ограничение на версию пакета.
+// Поддерживаются операторы =, >, >=, <, <=, ^, ~, диапазоны через запятую
+// (">=1.2, <2.0") и альтернативы через "||". Пустое ограничение или "*" означает любую версию
+type Constraint struct {
+	// alternatives - наборы условий, объединенные через ИЛИ; условия внутри набора объединены через И
+	alternatives [][]comparator
+	original     string
+}
+
+// ParseConstraint разбирает строку ограничения версии
+func ParseConstraint(s string) (Constraint, error) {
+	c := Constraint{original: strings.TrimSpace(s)}
+	if c.original == "" || c.original == "*" {
+		c.alternatives = [][]comparator{{}}
+		return c, nil
+	}
+
+	for _, alt := range strings.Split(c.original, "||") {
+		var set []comparator
+		for _, term := range strings.Split(alt, ",") {
+			term = strings.TrimSpace(term)
+			if term == "" {
+				return Constraint{}, fmt.Errorf("некорректное ограничение версии %q: пустое условие", s)
+			}
+			cmps, err := parseTerm(term)
+			if err != nil {
+				return Constraint{}, fmt.Errorf("некорректное ограничение версии %q: %w", s, err)
+			}
+			set = append(set, cmps...)
+		}
+		c.alternatives = append(c.alternatives, set)
+	}
+	return c, nil
+}
+
+// MustParseConstraint разбирает ограничение и паникует при ошибке
+func MustParseConstraint(s string) Constraint {
+	c, err := ParseConstraint(s)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// parseTerm разбирает одно условие и раскрывает ^ и ~ в пару сравнений
+func parseTerm(term string) ([]comparator, error) {
+	if term == "*" {
+		return nil, nil
+	}
+
+	var op string
+	for _, candidate := range []string{">=", "<=", "==", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(term, candidate) {
+			op = candidate
+			break
+		}
+	}
+	v, err := Parse(strings.TrimSpace(strings.TrimPrefix(term, op)))
+	if err != nil {
+		return nil, err
+	}
+
+	switch op {
+	case "", "=", "==":
+		return []comparator{{opEQ, v}}, nil
+	case ">", ">=", "<", "<=":
+		return []comparator{{operator(op), v}}, nil
+	case "^":
+		return []comparator{{opGE, v}, {opLT, caretUpper(v)}}, nil
+	case "~":
+		return []comparator{{opGE, v}, {opLT, tildeUpper(v)}}, nil
+	}
+	return nil, fmt.Errorf("неизвестный оператор в условии %q", term)
+}
+
+// caretUpper возвращает верхнюю границу для ^: не меняется самая левая ненулевая компонента
+func caretUpper(v Version) Version {
+	switch {
+	case v.Major > 0 || v.parts == 1:
+		return Version{Major: v.Major + 1, Prerelease: "0"}
+	case v.Minor > 0 || v.parts == 2:
+		return Version{Minor: v.Minor + 1, Prerelease: "0"}
+	default:
+		return Version{Patch: v.Patch + 1, Prerelease: "0"}
+	}
+}
+
+// tildeUpper возвращает верхнюю границу для ~: допускаются изменения patch-версии
+// (или minor, если указан только major)
+func tildeUpper(v Version) Version {
+	if v.parts == 1 {
+		return Version{Major: v.Major + 1, Prerelease: "0"}
+	}
+	return Version{Major: v.Major, Minor: v.Minor + 1, Prerelease: "0"}
+}
+
+// Check сообщает, удовлетворяет ли версия ограничению.
+// Prerelease-версии подходят, только если в наборе условий явно упомянут prerelease той же версии
+func (c Constraint) Check(v Version) bool {
+	for _, set := range c.alternatives {
+		if matchSet(set, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchSet(set []comparator, v Version) bool {
+	for _, cmp := range set {
+		if !cmp.check(v) {
+			return false
+		}
+	}
+	if v.Prerelease == "" {
+		return true
+	}
+	for _, cmp := range set {
+		// Верхние границы ^ и ~ ("-0") не считаются явным упоминанием prerelease
+		if cmp.version.Prerelease != "" && cmp.version.original != "" && cmp.version.sameCore(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Best возвращает наибольшую из версий, удовлетворяющих ограничению
+func (c Constraint) Best(versions []Version) (Version, bool) {
+	var best Version
+	found := false
+	for _, v := range versions {
+		if c.Check(v) && (!found || v.Compare(best) > 0) {
+			best, found = v, true
+		}
+	}
+	return best, found
+}
+
+// IsAny сообщает, допускает ли ограничение любую версию
+func (c Constraint) IsAny() bool {
+	for _, set := range c.alternatives {
+		if len(set) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// String возвращает исходную запись ограничения
+func (c Constraint) String() string {
+	if c.original == "" {
+		return "*"
+	}
+	return c.original
+}
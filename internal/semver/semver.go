@@ -0,0 +1,153 @@
+package semver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version представляет семантическую версию пакета.
+// Допускаются сокращенные формы ("1", "1.10"), недостающие компоненты считаются нулевыми
+type Version struct {
+	Major      int
+	Minor      int
+	Patch      int
+	Prerelease string
+	// parts - количество явно указанных числовых компонент (1..3)
+	parts int
+	// original - строка, из которой была разобрана версия
+	original string
+}
+
+// Parse разбирает строку версии вида MAJOR[.MINOR[.PATCH]][-PRERELEASE][+BUILD]
+func Parse(s string) (Version, error) {
+	raw := strings.TrimSpace(s)
+	v := Version{original: raw}
+	str := strings.TrimPrefix(raw, "v")
+	if str == "" {
+		return Version{}, fmt.Errorf("пустая версия")
+	}
+
+	// Метаданные сборки не участвуют в сравнении
+	if i := strings.IndexByte(str, '+'); i >= 0 {
+		str = str[:i]
+	}
+	if i := strings.IndexByte(str, '-'); i >= 0 {
+		v.Prerelease = str[i+1:]
+		str = str[:i]
+		if v.Prerelease == "" {
+			return Version{}, fmt.Errorf("некорректная версия %q: пустой prerelease", raw)
+		}
+	}
+
+	parts := strings.Split(str, ".")
+	if len(parts) > 3 {
+		return Version{}, fmt.Errorf("некорректная версия %q: слишком много компонент", raw)
+	}
+	nums := make([]int, 3)
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 || p == "" {
+			return Version{}, fmt.Errorf("некорректная версия %q", raw)
+		}
+		nums[i] = n
+	}
+	v.Major, v.Minor, v.Patch = nums[0], nums[1], nums[2]
+	v.parts = len(parts)
+	return v, nil
+}
+
+// MustParse разбирает версию и паникует при ошибке (для констант и тестов)
+func MustParse(s string) Version {
+	v, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// Original возвращает исходную строку версии (используется в именах архивов)
+func (v Version) Original() string {
+	if v.original != "" {
+		return v.original
+	}
+	return v.String()
+}
+
+// String возвращает нормализованное представление версии
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Prerelease != "" {
+		s += "-" + v.Prerelease
+	}
+	return s
+}
+
+// Compare сравнивает версии: -1 если v < o, 0 если равны, 1 если v > o
+func (v Version) Compare(o Version) int {
+	if c := compareInt(v.Major, o.Major); c != 0 {
+		return c
+	}
+	if c := compareInt(v.Minor, o.Minor); c != 0 {
+		return c
+	}
+	if c := compareInt(v.Patch, o.Patch); c != 0 {
+		return c
+	}
+	return comparePrerelease(v.Prerelease, o.Prerelease)
+}
+
+// Equal сообщает, равны ли версии с точки зрения семантики
+func (v Version) Equal(o Version) bool {
+	return v.Compare(o) == 0
+}
+
+// sameCore сообщает, совпадают ли MAJOR.MINOR.PATCH у двух версий
+func (v Version) sameCore(o Version) bool {
+	return v.Major == o.Major && v.Minor == o.Minor && v.Patch == o.Patch
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// comparePrerelease сравнивает prerelease-части по правилам semver 2.0:
+// версия без prerelease старше версии с ним, числовые идентификаторы младше буквенных
+func comparePrerelease(a, b string) int {
+	if a == b {
+		return 0
+	}
+	if a == "" {
+		return 1
+	}
+	if b == "" {
+		return -1
+	}
+
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if c := compareInt(an, bn); c != 0 {
+				return c
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(as[i], bs[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return compareInt(len(as), len(bs))
+}
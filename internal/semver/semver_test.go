@@ -0,0 +1,115 @@
+package semver
+
+import "testing"
+
+// TestCompare проверяет порядок версий, включая сокращенные формы и prerelease
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.10", "1.9", 1},
+		{"1.10", "1.10.0", 0},
+		{"2", "1.99.99", 1},
+		{"1.0.0-alpha", "1.0.0", -1},
+		{"1.0.0-alpha.1", "1.0.0-alpha.beta", -1},
+		{"1.0.0-beta.11", "1.0.0-beta.2", 1},
+		{"1.0.0+build.5", "1.0.0", 0},
+		{"v1.2.3", "1.2.3", 0},
+	}
+
+	for _, tt := range tests {
+		got := MustParse(tt.a).Compare(MustParse(tt.b))
+		if got != tt.want {
+			t.Errorf("Compare(%s, %s) = %d, ожидалось %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+// TestParseInvalid проверяет отказ на некорректных версиях
+func TestParseInvalid(t *testing.T) {
+	for _, s := range []string{"", "1.2.3.4", "a.b", "1..2", "1.0-", "-1"} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("Ожидалась ошибка разбора версии %q", s)
+		}
+	}
+}
+
+// TestConstraintCheck проверяет операторы, диапазоны и альтернативы
+func TestConstraintCheck(t *testing.T) {
+	tests := []struct {
+		constraint string
+		version    string
+		want       bool
+	}{
+		{"", "3.1.4", true},
+		{"*", "0.0.1", true},
+		{"1.10", "1.10.0", true},
+		{"=1.10", "1.10.1", false},
+		{">=1.10", "1.10", true},
+		{">=1.10", "1.9", false},
+		{"<=1.10", "1.10", true},
+		{"<=1.10", "1.11", false},
+		{">1.0", "1.0.1", true},
+		{"<1.0", "1.0", false},
+		{"^1.2.3", "1.9.0", true},
+		{"^1.2.3", "2.0.0", false},
+		{"^1.2.3", "1.2.2", false},
+		{"^0.2.3", "0.2.9", true},
+		{"^0.2.3", "0.3.0", false},
+		{"^0.0.3", "0.0.4", false},
+		{"^1", "1.99", true},
+		{"~1.2.3", "1.2.9", true},
+		{"~1.2.3", "1.3.0", false},
+		{"~1", "1.9", true},
+		{"~1", "2.0", false},
+		{">=1.2, <2.0", "1.5", true},
+		{">=1.2, <2.0", "2.0", false},
+		{"<1.0 || >=2.0", "0.9", true},
+		{"<1.0 || >=2.0", "1.5", false},
+		{"<1.0 || >=2.0", "2.1", true},
+		{"^2.0", "3.0.0-rc.1", false},
+		{"^1.0", "2.0.0-rc.1", false},
+		{">=2.0.0-rc.1", "2.0.0-rc.2", true},
+		{">=2.0.0-rc.1", "2.1.0-rc.1", false},
+		{">= 1.0", "1.0", true},
+	}
+
+	for _, tt := range tests {
+		c, err := ParseConstraint(tt.constraint)
+		if err != nil {
+			t.Fatalf("Не удалось разобрать ограничение %q: %v", tt.constraint, err)
+		}
+		if got := c.Check(MustParse(tt.version)); got != tt.want {
+			t.Errorf("%q.Check(%s) = %v, ожидалось %v", tt.constraint, tt.version, got, tt.want)
+		}
+	}
+}
+
+// TestConstraintInvalid проверяет отказ на некорректных ограничениях
+func TestConstraintInvalid(t *testing.T) {
+	for _, s := range []string{">=", "1.0,", "|| 1.0", ">=x", "!1.0"} {
+		if _, err := ParseConstraint(s); err == nil {
+			t.Errorf("Ожидалась ошибка разбора ограничения %q", s)
+		}
+	}
+}
+
+// TestConstraintBest проверяет выбор наибольшей подходящей версии
+func TestConstraintBest(t *testing.T) {
+	versions := []Version{MustParse("1.2"), MustParse("1.10"), MustParse("2.0"), MustParse("2.1.0-beta")}
+
+	best, ok := MustParseConstraint("").Best(versions)
+	if !ok || best.Original() != "2.0" {
+		t.Errorf("Ожидалась последняя стабильная версия 2.0, получено %s (%v)", best.Original(), ok)
+	}
+
+	best, ok = MustParseConstraint("<=1.10").Best(versions)
+	if !ok || best.Original() != "1.10" {
+		t.Errorf("Ожидалась версия 1.10, получено %s (%v)", best.Original(), ok)
+	}
+
+	if _, ok := MustParseConstraint(">3").Best(versions); ok {
+		t.Error("Не ожидалось подходящих версий для >3")
+	}
+}
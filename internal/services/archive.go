@@ -0,0 +1,342 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"package-manager/internal/models"
+)
+
+// Политики путей файлов цели в архиве
+const (
+	// LayoutRelative сохраняет путь относительно базовой директории маски (по умолчанию)
+	LayoutRelative = "relative"
+	// LayoutFlatten кладет все файлы цели в одну директорию под своими именами
+	LayoutFlatten = "flatten"
+)
+
+// ErrDuplicateEntry сообщает, что два файла попадают в архив под одним именем
+var ErrDuplicateEntry = errors.New("повторяющееся имя в архиве")
+
+// archiveBuilder собирает архив пакета и следит за уникальностью имен записей
+type archiveBuilder struct {
+	// ctx прерывает сборку между файлами
+	ctx    context.Context
+	writer archiveWriter
+	// entries - имя записи без завершающего слеша -> исходный путь
+	entries map[string]string
+	dirs    map[string]bool
+}
+
+// newArchiveBuilder создает сборщик архива в формате format (zip, tar.gz или tar.zst)
+func newArchiveBuilder(ctx context.Context, w io.Writer, format string) (*archiveBuilder, error) {
+	writer, err := newArchiveWriter(w, format)
+	if err != nil {
+		return nil, err
+	}
+	return &archiveBuilder{ctx: ctx, writer: writer, entries: make(map[string]string), dirs: make(map[string]bool)}, nil
+}
+
+// Close дописывает служебные данные в конец архива
+func (b *archiveBuilder) Close() error {
+	return b.writer.Close()
+}
+
+// archiveTarget - одна маска цели из packet.json с разобранными настройками
+type archiveTarget struct {
+	models.TargetConfig
+	pattern string
+	// base - директория, относительно которой считаются пути (часть маски до первого шаблона)
+	base string
+	// literal - маска без шаблонов: archive_path переименовывает сам найденный файл или директорию
+	literal     bool
+	archivePath string
+	excludes    []string
+	ignore      *ignoreMatcher
+}
+
+// newArchiveTargets проверяет настройки цели и разбивает ее по маскам path и include
+func newArchiveTargets(target models.TargetConfig) ([]*archiveTarget, error) {
+	switch target.Layout {
+	case "", LayoutRelative, LayoutFlatten:
+	default:
+		return nil, fmt.Errorf("неизвестный layout %q цели %s (ожидалось %s или %s)", target.Layout, target.Path, LayoutRelative, LayoutFlatten)
+	}
+	var archivePath string
+	if target.ArchivePath != "" {
+		var err error
+		if archivePath, err = cleanLayoutPath(target.ArchivePath); err != nil {
+			return nil, fmt.Errorf("archive_path цели %s: %w", target.Path, err)
+		}
+	}
+	var excludes []string
+	for _, pattern := range target.Exclude {
+		pattern = strings.TrimSuffix(filepath.ToSlash(pattern), "/")
+		if pattern == "" {
+			continue
+		}
+		if !doublestar.ValidatePattern(pattern) {
+			return nil, fmt.Errorf("некорректная маска исключения %q", pattern)
+		}
+		excludes = append(excludes, pattern)
+	}
+
+	patterns := target.Include
+	if target.Path != "" {
+		patterns = append([]string{target.Path}, patterns...)
+	}
+	if len(patterns) == 0 {
+		return nil, errors.New("у цели не задан path или include")
+	}
+	targets := make([]*archiveTarget, 0, len(patterns))
+	for _, pattern := range patterns {
+		if !doublestar.ValidatePattern(filepath.ToSlash(pattern)) {
+			return nil, fmt.Errorf("некорректная маска %q", pattern)
+		}
+		t := &archiveTarget{TargetConfig: target, pattern: pattern, archivePath: archivePath, excludes: excludes}
+		t.base, t.literal = globBase(pattern)
+		if target.UseIgnoreFiles {
+			t.ignore = newIgnoreMatcher(t.base)
+		}
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+// globBase возвращает часть маски до первого компонента с шаблоном.
+// Для маски без шаблонов возвращается родительская директория и true
+func globBase(pattern string) (string, bool) {
+	cleaned := filepath.ToSlash(filepath.Clean(pattern))
+	parts := strings.Split(cleaned, "/")
+	for i, part := range parts {
+		if strings.ContainsAny(part, "*?[{") {
+			base := strings.Join(parts[:i], "/")
+			switch {
+			case base == "" && i > 0:
+				base = "/"
+			case base == "":
+				base = "."
+			}
+			return filepath.FromSlash(base), false
+		}
+	}
+	return filepath.Dir(filepath.FromSlash(cleaned)), true
+}
+
+// entryName возвращает имя записи в архиве для файла filePath, найденного по маске как match
+func (t *archiveTarget) entryName(match, filePath string) (string, error) {
+	if t.archivePath != "" && t.literal {
+		// Найденный файл или директория переименовывается в archive_path
+		if filePath == match {
+			return t.archivePath, nil
+		}
+		if t.Layout == LayoutFlatten {
+			return path.Join(t.archivePath, filepath.Base(filePath)), nil
+		}
+		rel, err := filepath.Rel(match, filePath)
+		if err != nil {
+			return "", err
+		}
+		return path.Join(t.archivePath, filepath.ToSlash(rel)), nil
+	}
+
+	name := filepath.Base(filePath)
+	if t.Layout != LayoutFlatten {
+		rel, err := filepath.Rel(t.base, filePath)
+		if err != nil {
+			return "", err
+		}
+		name = filepath.ToSlash(rel)
+	}
+	if t.archivePath != "" {
+		name = path.Join(t.archivePath, name)
+	}
+	if name == ".." || strings.HasPrefix(name, "../") {
+		return "", fmt.Errorf("путь %s выходит за базовую директорию %s", filePath, t.base)
+	}
+	return name, nil
+}
+
+// excluded проверяет файл или директорию по маскам исключения и файлам .gitignore/.pmignore.
+// Маски сравниваются с именем, с путем относительно директории маски и с путем как он найден
+func (t *archiveTarget) excluded(filePath string, isDir bool) (bool, error) {
+	// Файл, найденный маской вида src/**, исключается и вместе с исключенной директорией:
+	// имена проверяются для директорий внутри директории маски, пути - для всех родителей
+	names := []string{filepath.Base(filePath)}
+	if rel, err := filepath.Rel(t.base, filePath); err == nil && !strings.HasPrefix(rel, "..") {
+		for dir := filepath.ToSlash(rel); dir != "."; dir = path.Dir(dir) {
+			names = append(names, dir, path.Base(dir))
+		}
+	}
+	for dir := filepath.ToSlash(filepath.Clean(filePath)); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		names = append(names, dir)
+	}
+	for _, pattern := range t.excludes {
+		for _, name := range names {
+			if ok, _ := doublestar.Match(pattern, name); ok {
+				return true, nil
+			}
+		}
+	}
+
+	if t.ignore == nil {
+		return false, nil
+	}
+	if !isDir && isIgnoreFile(filePath) {
+		return true, nil
+	}
+	return t.ignore.ignored(filePath, isDir)
+}
+
+// addTarget добавляет в архив файлы и директории, найденные по маске цели.
+// Ошибки отдельных файлов записываются в лог, повторяющиеся имена прерывают сборку
+func (b *archiveBuilder) addTarget(target models.TargetConfig) error {
+	targets, err := newArchiveTargets(target)
+	if err != nil {
+		return err
+	}
+	for _, t := range targets {
+		if err := b.addPattern(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addPattern добавляет в архив файлы и директории, найденные по одной маске цели
+func (b *archiveBuilder) addPattern(t *archiveTarget) error {
+	matches, err := doublestar.FilepathGlob(t.pattern)
+	if err != nil {
+		log.Printf("Ошибка при поиске файлов по маске %s: %v", t.pattern, err)
+		return nil
+	}
+
+	for _, match := range matches {
+		info, err := os.Stat(match)
+		if err != nil {
+			log.Printf("Не удалось получить информацию о файле %s: %v", match, err)
+			continue
+		}
+		excluded, err := t.excluded(match, info.IsDir())
+		if err != nil {
+			return err
+		}
+		if excluded {
+			log.Printf("Исключение %s", match)
+			continue
+		}
+		if info.IsDir() {
+			// Рекурсивное добавление содержимого директории
+			err = b.addDir(t, match)
+		} else {
+			err = b.addFile(t, match, match, info)
+		}
+		if errors.Is(err, ErrDuplicateEntry) || b.ctx.Err() != nil {
+			return err
+		}
+		if err != nil {
+			log.Printf("Не удалось добавить %s в архив: %v", match, err)
+		}
+	}
+	return nil
+}
+
+// addDir рекурсивно добавляет директорию в архив
+func (b *archiveBuilder) addDir(t *archiveTarget, dirPath string) error {
+	return filepath.Walk(dirPath, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		excluded, err := t.excluded(filePath, info.IsDir())
+		if err != nil {
+			return err
+		}
+		if excluded {
+			log.Printf("Исключение %s", filePath)
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if info.IsDir() {
+			if t.Layout == LayoutFlatten {
+				return nil
+			}
+			name, err := t.entryName(dirPath, filePath)
+			if err != nil {
+				return err
+			}
+			return b.addDirEntry(name, filePath, info)
+		}
+		return b.addFile(t, dirPath, filePath, info)
+	})
+}
+
+// addDirEntry добавляет запись директории. Одна и та же директория из разных целей добавляется один раз
+func (b *archiveBuilder) addDirEntry(name, filePath string, info os.FileInfo) error {
+	if name == "." || b.dirs[name] {
+		return nil
+	}
+	if first, ok := b.entries[name]; ok {
+		return fmt.Errorf("%w: %s (%s и %s)", ErrDuplicateEntry, name, first, filePath)
+	}
+	if err := b.writer.writeDir(name, info); err != nil {
+		return fmt.Errorf("не удалось создать запись в архиве для %s: %w", filePath, err)
+	}
+	b.entries[name] = filePath
+	b.dirs[name] = true
+	return nil
+}
+
+// addFile добавляет файл или символическую ссылку. Исключения проверяются до вызова
+func (b *archiveBuilder) addFile(t *archiveTarget, match, filePath string, info os.FileInfo) error {
+	if err := b.ctx.Err(); err != nil {
+		return err
+	}
+	name, err := t.entryName(match, filePath)
+	if err != nil {
+		return err
+	}
+	if first, ok := b.entries[name]; ok {
+		if first == filePath {
+			// Файл уже добавлен по другой маске, например src/** находит и директорию, и ее файлы
+			return nil
+		}
+		return fmt.Errorf("%w: %s (%s и %s)", ErrDuplicateEntry, name, first, filePath)
+	}
+	b.entries[name] = filePath
+
+	if info.Mode()&fs.ModeSymlink != 0 {
+		// Для ссылки в архив записывается ее цель, а не содержимое файла, на который она указывает
+		target, err := os.Readlink(filePath)
+		if err != nil {
+			return fmt.Errorf("не удалось прочитать ссылку %s: %w", filePath, err)
+		}
+		if err := b.writer.writeSymlink(name, filepath.ToSlash(target), info); err != nil {
+			return fmt.Errorf("не удалось создать запись в архиве для %s: %w", filePath, err)
+		}
+		return nil
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("не удалось открыть файл %s: %w", filePath, err)
+	}
+	// Файл закрывается по выходу из addFile, а не по завершении обхода: директория может содержать тысячи файлов
+	defer file.Close()
+
+	if err := b.writer.writeFile(name, info, file); err != nil {
+		return fmt.Errorf("не удалось скопировать данные в архив из файла %s: %w", filePath, err)
+	}
+	return nil
+}
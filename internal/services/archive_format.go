@@ -0,0 +1,408 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Форматы архивов пакетов (поле format в packet.json)
+const (
+	// FormatZip - ZIP-архив (по умолчанию)
+	FormatZip = "zip"
+	// FormatTarGz - tar, сжатый gzip: сохраняет права, владельца и символические ссылки
+	FormatTarGz = "tar.gz"
+	// FormatTarZst - tar, сжатый zstd
+	FormatTarZst = "tar.zst"
+)
+
+// ArchiveFormats - поддерживаемые форматы архивов
+var ArchiveFormats = []string{FormatZip, FormatTarGz, FormatTarZst}
+
+// Сигнатуры в начале файлов поддерживаемых форматов
+var (
+	zipMagic      = []byte("PK\x03\x04")
+	zipEmptyMagic = []byte("PK\x05\x06")
+	gzipMagic     = []byte{0x1f, 0x8b}
+	zstdMagic     = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// checkArchiveFormat проверяет формат из packet.json. Пустой формат означает zip
+func checkArchiveFormat(format string) (string, error) {
+	switch format {
+	case "":
+		return FormatZip, nil
+	case FormatZip, FormatTarGz, FormatTarZst:
+		return format, nil
+	}
+	return "", fmt.Errorf("неизвестный формат архива %q (ожидалось %s)", format, strings.Join(ArchiveFormats, ", "))
+}
+
+// archiveExt возвращает расширение файла архива. Пустой формат (индексы и lock-файлы
+// до появления форматов) означает zip
+func archiveExt(format string) string {
+	if format == "" {
+		return FormatZip
+	}
+	return format
+}
+
+// formatByName определяет формат архива по расширению имени файла
+func formatByName(name string) (string, bool) {
+	for _, format := range ArchiveFormats {
+		if strings.HasSuffix(name, "."+format) {
+			return format, true
+		}
+	}
+	if strings.HasSuffix(name, ".tgz") {
+		return FormatTarGz, true
+	}
+	return "", false
+}
+
+// detectArchiveFormat определяет формат архива по сигнатуре в начале файла,
+// а если она не распознана - по расширению имени
+func detectArchiveFormat(name string, r io.ReaderAt) (string, error) {
+	header := make([]byte, 4)
+	n, err := r.ReadAt(header, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("ошибка чтения архива %s: %w", name, err)
+	}
+	header = header[:n]
+	switch {
+	case bytes.HasPrefix(header, zipMagic), bytes.HasPrefix(header, zipEmptyMagic):
+		return FormatZip, nil
+	case bytes.HasPrefix(header, gzipMagic):
+		return FormatTarGz, nil
+	case bytes.HasPrefix(header, zstdMagic):
+		return FormatTarZst, nil
+	}
+	if format, ok := formatByName(name); ok {
+		return format, nil
+	}
+	return "", fmt.Errorf("не удалось определить формат архива %s", name)
+}
+
+// archiveWriter записывает записи архива в одном из форматов
+type archiveWriter interface {
+	writeDir(name string, info fs.FileInfo) error
+	writeSymlink(name, target string, info fs.FileInfo) error
+	writeFile(name string, info fs.FileInfo, data io.Reader) error
+	// Close дописывает служебные данные формата (оглавление ZIP, конец tar и сжатого потока)
+	Close() error
+}
+
+// newArchiveWriter создает запись архива в формате format
+func newArchiveWriter(w io.Writer, format string) (archiveWriter, error) {
+	switch format {
+	case FormatZip:
+		return &zipArchiveWriter{writer: zip.NewWriter(w)}, nil
+	case FormatTarGz:
+		gz := gzip.NewWriter(w)
+		return &tarArchiveWriter{writer: tar.NewWriter(gz), compressor: gz}, nil
+	case FormatTarZst:
+		zw, err := zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
+		if err != nil {
+			return nil, fmt.Errorf("ошибка создания zstd-кодировщика: %w", err)
+		}
+		return &tarArchiveWriter{writer: tar.NewWriter(zw), compressor: zw}, nil
+	}
+	_, err := checkArchiveFormat(format)
+	return nil, err
+}
+
+// zipArchiveWriter записывает ZIP-архив. Цель символической ссылки хранится как содержимое записи
+type zipArchiveWriter struct {
+	writer *zip.Writer
+}
+
+func (w *zipArchiveWriter) header(name string, info fs.FileInfo) (*zip.FileHeader, error) {
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return nil, err
+	}
+	header.Name = name
+	return header, nil
+}
+
+func (w *zipArchiveWriter) writeDir(name string, info fs.FileInfo) error {
+	header, err := w.header(name+"/", info)
+	if err != nil {
+		return err
+	}
+	_, err = w.writer.CreateHeader(header)
+	return err
+}
+
+func (w *zipArchiveWriter) writeSymlink(name, target string, info fs.FileInfo) error {
+	header, err := w.header(name, info)
+	if err != nil {
+		return err
+	}
+	entry, err := w.writer.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(entry, target)
+	return err
+}
+
+func (w *zipArchiveWriter) writeFile(name string, info fs.FileInfo, data io.Reader) error {
+	header, err := w.header(name, info)
+	if err != nil {
+		return err
+	}
+	header.Method = zip.Deflate
+	entry, err := w.writer.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, data)
+	return err
+}
+
+func (w *zipArchiveWriter) Close() error {
+	return w.writer.Close()
+}
+
+// tarArchiveWriter записывает сжатый tar-архив. Заголовки tar сохраняют права, владельца
+// (uid/gid и имена) и цели символических ссылок
+type tarArchiveWriter struct {
+	writer     *tar.Writer
+	compressor io.WriteCloser
+}
+
+func (w *tarArchiveWriter) header(name, link string, info fs.FileInfo) (*tar.Header, error) {
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return nil, err
+	}
+	header.Name = name
+	return header, nil
+}
+
+func (w *tarArchiveWriter) writeDir(name string, info fs.FileInfo) error {
+	header, err := w.header(name+"/", "", info)
+	if err != nil {
+		return err
+	}
+	return w.writer.WriteHeader(header)
+}
+
+func (w *tarArchiveWriter) writeSymlink(name, target string, info fs.FileInfo) error {
+	header, err := w.header(name, target, info)
+	if err != nil {
+		return err
+	}
+	return w.writer.WriteHeader(header)
+}
+
+func (w *tarArchiveWriter) writeFile(name string, info fs.FileInfo, data io.Reader) error {
+	header, err := w.header(name, "", info)
+	if err != nil {
+		return err
+	}
+	if err := w.writer.WriteHeader(header); err != nil {
+		return err
+	}
+	// Файл мог измениться после Stat: в tar записывается ровно размер из заголовка
+	written, err := io.Copy(w.writer, io.LimitReader(data, header.Size))
+	if err == nil && written < header.Size {
+		err = fmt.Errorf("файл уменьшился во время упаковки (%d из %d байт)", written, header.Size)
+	}
+	return err
+}
+
+func (w *tarArchiveWriter) Close() error {
+	if err := w.writer.Close(); err != nil {
+		w.compressor.Close()
+		return err
+	}
+	return w.compressor.Close()
+}
+
+// archiveFile - заголовок записи архива любого формата
+type archiveFile struct {
+	// name - имя записи в архиве как есть
+	name string
+	mode fs.FileMode
+	size uint64
+	// link - цель символической ссылки
+	link string
+	// hardlink - жесткая ссылка tar (не поддерживается при распаковке)
+	hardlink bool
+	// unix - права и владелец записаны как в Unix (tar): права применяются без umask,
+	// а владелец - при запуске от root
+	unix     bool
+	uid, gid int
+}
+
+// packageArchive - архив пакета, открытый для чтения
+type packageArchive interface {
+	// files возвращает заголовки записей по порядку, но не больше limit+1: этого достаточно,
+	// чтобы отклонить архив со слишком большим числом записей, не читая его целиком
+	files(limit int) ([]archiveFile, error)
+	// read вызывает fn для записей по порядку; open открывает содержимое i-й записи
+	read(fn func(i int, open func() (io.ReadCloser, error)) error) error
+}
+
+// openPackageArchive открывает архив из spool, определяя формат по сигнатуре или по имени
+func openPackageArchive(archiveName string, spool *spoolFile) (packageArchive, error) {
+	format, err := detectArchiveFormat(archiveName, spool)
+	if err != nil {
+		return nil, err
+	}
+	if format == FormatZip {
+		zr, err := zip.NewReader(spool, spool.Size())
+		if err != nil {
+			return nil, fmt.Errorf("ошибка создания ZIP-ридера для %s: %w", archiveName, err)
+		}
+		return zipArchive{zr}, nil
+	}
+	return &tarArchive{format: format, open: spool.Reader}, nil
+}
+
+// zipArchive читает ZIP-архив
+type zipArchive struct {
+	reader *zip.Reader
+}
+
+func (a zipArchive) files(limit int) ([]archiveFile, error) {
+	if len(a.reader.File) > limit {
+		return make([]archiveFile, len(a.reader.File)), nil
+	}
+	files := make([]archiveFile, 0, len(a.reader.File))
+	for _, f := range a.reader.File {
+		file := archiveFile{name: f.Name, mode: f.Mode(), size: f.UncompressedSize64}
+		if file.mode&fs.ModeSymlink != 0 {
+			target, err := readZipLink(f)
+			if err != nil {
+				return nil, fmt.Errorf("не удалось прочитать цель ссылки %s: %w", f.Name, err)
+			}
+			file.link = target
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// readZipLink читает цель символической ссылки из содержимого записи. Цель длиннее допустимой
+// читается не целиком и отклоняется при проверке
+func readZipLink(f *zip.File) (string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, maxSymlinkTarget+1))
+	return string(data), err
+}
+
+func (a zipArchive) read(fn func(i int, open func() (io.ReadCloser, error)) error) error {
+	for i, f := range a.reader.File {
+		if err := fn(i, f.Open); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tarArchive читает сжатый tar-архив. Сжатый поток читается только последовательно,
+// поэтому каждый проход по записям распаковывает его заново
+type tarArchive struct {
+	format string
+	open   func() io.Reader
+}
+
+// walk проходит по заголовкам архива и вызывает fn для каждой записи
+func (a *tarArchive) walk(fn func(i int, header *tar.Header, data io.Reader) error) error {
+	var stream io.Reader
+	switch a.format {
+	case FormatTarGz:
+		gz, err := gzip.NewReader(a.open())
+		if err != nil {
+			return fmt.Errorf("ошибка чтения gzip: %w", err)
+		}
+		defer gz.Close()
+		stream = gz
+	case FormatTarZst:
+		zr, err := zstd.NewReader(a.open(), zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return fmt.Errorf("ошибка чтения zstd: %w", err)
+		}
+		defer zr.Close()
+		stream = zr
+	default:
+		return fmt.Errorf("неизвестный формат архива %q", a.format)
+	}
+
+	tr := tar.NewReader(stream)
+	for i := 0; ; {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("ошибка чтения tar: %w", err)
+		}
+		if header.Typeflag == tar.TypeXGlobalHeader {
+			// Общий заголовок PAX не описывает файл
+			continue
+		}
+		if err := fn(i, header, tr); err != nil {
+			return err
+		}
+		i++
+	}
+}
+
+// errEnoughEntries останавливает чтение заголовков tar после limit+1 записей
+var errEnoughEntries = errors.New("прочитано достаточно записей")
+
+func (a *tarArchive) files(limit int) ([]archiveFile, error) {
+	var files []archiveFile
+	err := a.walk(func(i int, header *tar.Header, _ io.Reader) error {
+		if i > limit {
+			return errEnoughEntries
+		}
+		file := archiveFile{
+			name: header.Name,
+			mode: header.FileInfo().Mode(),
+			unix: true,
+			uid:  header.Uid,
+			gid:  header.Gid,
+		}
+		switch header.Typeflag {
+		case tar.TypeReg, tar.TypeChar, tar.TypeBlock, tar.TypeDir, tar.TypeFifo:
+		case tar.TypeSymlink:
+			file.link = header.Linkname
+		case tar.TypeLink:
+			file.hardlink = true
+		default:
+			file.mode |= fs.ModeIrregular
+		}
+		if header.Typeflag == tar.TypeReg && header.Size > 0 {
+			file.size = uint64(header.Size)
+		}
+		files = append(files, file)
+		return nil
+	})
+	if errors.Is(err, errEnoughEntries) {
+		err = nil
+	}
+	return files, err
+}
+
+func (a *tarArchive) read(fn func(i int, open func() (io.ReadCloser, error)) error) error {
+	return a.walk(func(i int, _ *tar.Header, data io.Reader) error {
+		return fn(i, func() (io.ReadCloser, error) { return io.NopCloser(data), nil })
+	})
+}
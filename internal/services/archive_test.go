@@ -0,0 +1,210 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"package-manager/internal/models"
+)
+
+// writeTestTree создает файлы с указанным содержимым в директории dir
+func writeTestTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		filePath := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			t.Fatalf("Не удалось создать директорию: %v", err)
+		}
+		if err := os.WriteFile(filePath, []byte(data), 0644); err != nil {
+			t.Fatalf("Не удалось создать файл: %v", err)
+		}
+	}
+}
+
+// archiveEntryNames собирает архив из целей и возвращает имена его записей через запятую
+func archiveEntryNames(t *testing.T, targets []models.TargetConfig) (string, error) {
+	t.Helper()
+	var buf bytes.Buffer
+	builder, err := newArchiveBuilder(t.Context(), &buf, FormatZip)
+	if err != nil {
+		t.Fatalf("Ошибка создания архива: %v", err)
+	}
+	for _, target := range targets {
+		if err := builder.addTarget(target); err != nil {
+			return "", err
+		}
+	}
+	if err := builder.Close(); err != nil {
+		t.Fatalf("Ошибка закрытия архива: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Не удалось открыть архив: %v", err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	return strings.Join(names, ","), nil
+}
+
+// TestArchiveBuilderLayouts проверяет имена записей архива для разных политик путей
+func TestArchiveBuilderLayouts(t *testing.T) {
+	dir := t.TempDir()
+	writeTestTree(t, dir, map[string]string{"configs/a/app.yaml": "a", "configs/b/app.yaml": "b", "bin/tool": "tool"})
+	t.Chdir(dir)
+
+	tests := []struct {
+		name    string
+		targets []models.TargetConfig
+		want    string
+		wantErr error
+	}{
+		{
+			name:    "маска сохраняет пути относительно своей директории",
+			targets: []models.TargetConfig{{Path: "./configs/*/app.yaml"}},
+			want:    "a/app.yaml,b/app.yaml",
+		},
+		{
+			name:    "archive_path для маски задает директорию",
+			targets: []models.TargetConfig{{Path: "configs/*/app.yaml", ArchivePath: "etc"}},
+			want:    "etc/a/app.yaml,etc/b/app.yaml",
+		},
+		{
+			name:    "одиночный файл кладется под своим именем",
+			targets: []models.TargetConfig{{Path: "./bin/tool"}},
+			want:    "tool",
+		},
+		{
+			name:    "archive_path переименовывает одиночный файл",
+			targets: []models.TargetConfig{{Path: "bin/tool", ArchivePath: "usr/bin/pm-tool"}},
+			want:    "usr/bin/pm-tool",
+		},
+		{
+			name:    "директория сохраняет свое имя и структуру",
+			targets: []models.TargetConfig{{Path: "configs", Exclude: models.Patterns{"b"}}},
+			want:    "configs/,configs/a/,configs/a/app.yaml",
+		},
+		{
+			name:    "archive_path переименовывает директорию",
+			targets: []models.TargetConfig{{Path: "configs", ArchivePath: "etc/app/"}},
+			want:    "etc/app/,etc/app/a/,etc/app/a/app.yaml,etc/app/b/,etc/app/b/app.yaml",
+		},
+		{
+			name:    "flatten кладет файлы без директорий",
+			targets: []models.TargetConfig{{Path: "bin"}, {Path: "configs/a", Layout: LayoutFlatten, ArchivePath: "etc"}},
+			want:    "bin/,bin/tool,etc/app.yaml",
+		},
+		{
+			name:    "flatten с одинаковыми именами файлов",
+			targets: []models.TargetConfig{{Path: "configs", Layout: LayoutFlatten}},
+			wantErr: ErrDuplicateEntry,
+		},
+		{
+			name:    "одинаковые имена из разных целей",
+			targets: []models.TargetConfig{{Path: "configs/a/app.yaml"}, {Path: "configs/b/app.yaml"}},
+			wantErr: ErrDuplicateEntry,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := archiveEntryNames(t, tt.targets)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Ожидалась ошибка %v, получено: %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Ошибка сборки архива: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Ожидались записи %s, получено %s", tt.want, got)
+			}
+		})
+	}
+
+	builder, err := newArchiveBuilder(t.Context(), &bytes.Buffer{}, FormatZip)
+	if err != nil {
+		t.Fatalf("Ошибка создания архива: %v", err)
+	}
+	if err := builder.addTarget(models.TargetConfig{Path: "bin", Layout: "tree"}); err == nil {
+		t.Error("Ожидалась ошибка для неизвестного layout")
+	}
+}
+
+// TestArchiveBuilderPatterns проверяет маски **, списки включений и исключений и файлы .gitignore/.pmignore
+func TestArchiveBuilderPatterns(t *testing.T) {
+	dir := t.TempDir()
+	writeTestTree(t, dir, map[string]string{
+		"src/main.go":          "main",
+		"src/main_test.go":     "test",
+		"src/pkg/util.go":      "util",
+		"src/pkg/util_test.go": "test",
+		"src/pkg/.gitignore":   "util.go\n",
+		"src/vendor/dep.go":    "dep",
+		"src/build/out.bin":    "bin",
+		"src/debug.log":        "log",
+		"src/keep.log":         "log",
+		"src/.gitignore":       "# сборка\nbuild/\n*.log\n",
+		"src/.pmignore":        "!keep.log\n",
+	})
+	t.Chdir(dir)
+
+	tests := []struct {
+		name   string
+		target models.TargetConfig
+		want   string
+	}{
+		{
+			name:   "** с исключениями по имени, пути и директории",
+			target: models.TargetConfig{Path: "src/**/*.go", Exclude: models.Patterns{"*_test.go", "vendor", "pkg/util.go"}},
+			want:   "main.go",
+		},
+		{
+			name:   "несколько масок include",
+			target: models.TargetConfig{Include: []string{"src/*.go", "src/pkg/*.go"}, Exclude: models.Patterns{"**/*_test.go"}},
+			want:   "main.go,util.go",
+		},
+		{
+			name:   "директория и ее содержимое по маске ** добавляются один раз",
+			target: models.TargetConfig{Path: "src/**", Exclude: models.Patterns{"src/*.*", "src/build", "src/vendor", ".*"}},
+			want:   "pkg/,pkg/util.go,pkg/util_test.go",
+		},
+		{
+			name:   "файлы .gitignore и .pmignore",
+			target: models.TargetConfig{Path: "src", UseIgnoreFiles: true},
+			want: "src/,src/.gitignore,src/keep.log,src/main.go,src/main_test.go," +
+				"src/pkg/,src/pkg/.gitignore,src/pkg/util_test.go,src/vendor/,src/vendor/dep.go",
+		},
+		{
+			name:   "файлы исключений учитываются и для масок",
+			target: models.TargetConfig{Path: "src/**/*.go", UseIgnoreFiles: true, Exclude: models.Patterns{"vendor/"}},
+			want:   "main.go,main_test.go,pkg/util_test.go",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := archiveEntryNames(t, []models.TargetConfig{tt.target})
+			if err != nil {
+				t.Fatalf("Ошибка сборки архива: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Ожидались записи %s, получено %s", tt.want, got)
+			}
+		})
+	}
+
+	if _, err := archiveEntryNames(t, []models.TargetConfig{{Path: "src/[", Exclude: models.Patterns{"*"}}}); err == nil {
+		t.Error("Ожидалась ошибка для некорректной маски")
+	}
+	if _, err := archiveEntryNames(t, []models.TargetConfig{{Exclude: models.Patterns{"*"}}}); err == nil {
+		t.Error("Ожидалась ошибка для цели без масок")
+	}
+}
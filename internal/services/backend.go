@@ -0,0 +1,70 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"time"
+
+	"package-manager/internal/config"
+)
+
+// cleanupTimeout ограничивает удаление следов прерванной операции (временных файлов в хранилище)
+const cleanupTimeout = 30 * time.Second
+
+// NewBackend создает хранилище пакетов по URL репозитория из конфигурации:
+// ssh:// (или пустой URL) - SSH-сервер (SCP), sftp:// - SSH-сервер (SFTP), file:// - локальная директория,
+// http(s):// - HTTP только для чтения. В автономном режиме хранилище не открывается
+func NewBackend(cfg *config.Config) (Backend, error) {
+	if cfg.Offline {
+		return OfflineBackend{}, nil
+	}
+	if cfg.Repository == "" {
+		return NewSSHClient(cfg), nil
+	}
+
+	u, err := url.Parse(cfg.Repository)
+	if err != nil {
+		return nil, fmt.Errorf("некорректный URL репозитория %s: %w", cfg.Repository, err)
+	}
+	switch u.Scheme {
+	case "ssh":
+		return NewSSHClient(cfg), nil
+	case "sftp":
+		return NewSFTPClient(cfg), nil
+	case "file":
+		if u.Path == "" {
+			return nil, fmt.Errorf("в URL репозитория %s не указан путь", cfg.Repository)
+		}
+		return NewLocalBackend(u.Path), nil
+	case "http", "https":
+		return NewHTTPBackend(cfg), nil
+	default:
+		return nil, fmt.Errorf("неподдерживаемая схема URL репозитория: %s", u.Scheme)
+	}
+}
+
+// cleanRemotePath нормализует путь внутри репозитория и не дает ему выйти за пределы корня
+func cleanRemotePath(name string) string {
+	cleaned := path.Clean("/" + name)
+	if cleaned == "/" {
+		return "."
+	}
+	return cleaned[1:]
+}
+
+// contextError заменяет ошибку операции, прерванной отменой ctx, ошибкой контекста:
+// закрытое при отмене соединение сообщает о себе невнятными ошибками вроде EOF
+func contextError(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return fmt.Errorf("%w (%v)", ctx.Err(), err)
+	}
+	return err
+}
+
+// cleanupContext возвращает контекст для удаления следов операции, прерванной отменой ctx.
+// Он не отменяется вместе с ctx, но ограничен cleanupTimeout
+func cleanupContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+}
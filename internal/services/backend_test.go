@@ -0,0 +1,124 @@
+package services
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"package-manager/internal/config"
+)
+
+// TestLocalBackendRoundTrip проверяет публикацию и установку пакета через file:// репозиторий без SSH
+func TestLocalBackendRoundTrip(t *testing.T) {
+	repoDir := t.TempDir()
+	workDir := t.TempDir()
+
+	// Пакет публикуется с подписью и устанавливается с проверкой по списку доверенных ключей
+	keyPath, trustedKeys := writeTestSigningKey(t, t.TempDir(), "app")
+	cfg := &config.Config{Repository: "file://" + repoDir, SigningKey: keyPath, TrustedKeys: trustedKeys}
+	backend, err := NewBackend(cfg)
+	if err != nil {
+		t.Fatalf("Не удалось создать хранилище: %v", err)
+	}
+	if _, ok := backend.(*LocalBackend); !ok {
+		t.Fatalf("Ожидалось локальное хранилище, получено %T", backend)
+	}
+	pm := NewPackageManager(cfg, backend)
+
+	if err := os.WriteFile(filepath.Join(workDir, "app.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatalf("Не удалось создать тестовый файл: %v", err)
+	}
+	packetFile := filepath.Join(workDir, "packet.json")
+	packetData := []byte(`{"name": "app", "ver": "1.0", "targets": [{"path": "` + filepath.ToSlash(filepath.Join(workDir, "app.txt")) + `"}]}`)
+	if err := os.WriteFile(packetFile, packetData, 0644); err != nil {
+		t.Fatalf("Не удалось создать файл пакета: %v", err)
+	}
+	if err := pm.CreatePackage(t.Context(), packetFile, CreateOptions{Sign: true}); err != nil {
+		t.Fatalf("Ожидалась успешная упаковка, но получена ошибка: %v", err)
+	}
+
+	for _, name := range []string{"index.json", "app/index.json", "app/1.0/app-1.0.zip"} {
+		if _, err := os.Stat(filepath.Join(repoDir, filepath.FromSlash(name))); err != nil {
+			t.Errorf("Ожидался файл %s в репозитории: %v", name, err)
+		}
+	}
+
+	files, err := backend.List(t.Context(), "app")
+	if err != nil || len(files) != 2 {
+		t.Errorf("Ожидалось 2 файла в директории пакета, получено %+v (%v)", files, err)
+	}
+
+	installDir := t.TempDir()
+	currentDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Не удалось получить текущую рабочую директорию: %v", err)
+	}
+	if err := os.Chdir(installDir); err != nil {
+		t.Fatalf("Не удалось изменить рабочую директорию: %v", err)
+	}
+	defer os.Chdir(currentDir)
+
+	configFile := filepath.Join(installDir, "packages.json")
+	if err := os.WriteFile(configFile, []byte(`{"packages": [{"name": "app"}]}`), 0644); err != nil {
+		t.Fatalf("Не удалось создать файл конфигурации: %v", err)
+	}
+	if err := pm.UpdatePackages(t.Context(), configFile, UpdateOptions{}); err != nil {
+		t.Fatalf("Ожидалось успешное обновление, но получена ошибка: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(installDir, "app.txt")); err != nil || string(data) != "hello" {
+		t.Errorf("Ожидался распакованный файл app.txt, получено %q (%v)", data, err)
+	}
+}
+
+// TestLocalBackendStaysInsideRoot проверяет, что пути с ".." не выходят за корень репозитория
+func TestLocalBackendStaysInsideRoot(t *testing.T) {
+	root := t.TempDir()
+	backend := NewLocalBackend(filepath.Join(root, "repo"))
+
+	if err := uploadBytes(backend, "../../escape.txt", []byte("x")); err != nil {
+		t.Fatalf("Ошибка загрузки: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "repo", "escape.txt")); err != nil {
+		t.Errorf("Ожидалось, что файл останется внутри репозитория: %v", err)
+	}
+	if _, err := backend.Stat(t.Context(), "missing.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Ожидалась ошибка fs.ErrNotExist, получено: %v", err)
+	}
+}
+
+// TestHTTPBackendReadOnly проверяет чтение через HTTP и отказ в записи
+func TestHTTPBackendReadOnly(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "app"), 0755); err != nil {
+		t.Fatalf("Не удалось создать директорию: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "app", "index.json"), []byte(`{"name": "app"}`), 0644); err != nil {
+		t.Fatalf("Не удалось создать файл: %v", err)
+	}
+	server := httptest.NewServer(http.FileServer(http.Dir(root)))
+	defer server.Close()
+
+	backend, err := NewBackend(&config.Config{Repository: server.URL + "/"})
+	if err != nil {
+		t.Fatalf("Не удалось создать хранилище: %v", err)
+	}
+
+	buf, err := downloadBytes(backend, "app/index.json")
+	if err != nil || string(buf) != `{"name": "app"}` {
+		t.Errorf("Неожиданный результат скачивания: %q (%v)", buf, err)
+	}
+	info, err := backend.Stat(t.Context(), "app/index.json")
+	if err != nil || info.Size != int64(len(`{"name": "app"}`)) {
+		t.Errorf("Неожиданный результат Stat: %+v (%v)", info, err)
+	}
+	if _, err := backend.Stat(t.Context(), "app/missing.json"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Ожидалась ошибка fs.ErrNotExist, получено: %v", err)
+	}
+	if err := uploadBytes(backend, "app/new.zip", []byte("x")); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Ожидалась ошибка ErrReadOnly, получено: %v", err)
+	}
+}
@@ -0,0 +1,254 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"package-manager/internal/config"
+)
+
+// CacheEntry - архив пакета в локальном кэше
+type CacheEntry struct {
+	Name     string
+	Ver      string
+	Checksum string
+	Size     int64
+	// Used - время последнего использования архива (время изменения файла)
+	Used time.Time
+	path string
+}
+
+// archiveCache - локальный кэш скачанных архивов, общий для всех проектов пользователя.
+// Архив хранится по пути <dir>/<name>/<ver>/<sha256>.<format>: разные архивы с одной версией
+// (например, из разных репозиториев) не подменяют друг друга
+type archiveCache struct {
+	dir     string
+	maxSize int64
+}
+
+// newArchiveCache создает кэш по настройкам. Если директория кэша не задана, возвращается nil:
+// методы nil-кэша ничего не находят и ничего не сохраняют
+func newArchiveCache(cfg *config.Config) *archiveCache {
+	if cfg.CacheDir == "" {
+		return nil
+	}
+	return &archiveCache{dir: cfg.CacheDir, maxSize: cfg.CacheMaxSize}
+}
+
+// path возвращает путь к архиву в кэше. Для контрольной суммы не в формате sha256:<hex> возвращается false
+func (c *archiveCache) path(name, ver, checksum, format string) (string, bool) {
+	sum, ok := strings.CutPrefix(checksum, "sha256:")
+	if !ok || len(sum) != 64 || strings.Trim(sum, "0123456789abcdef") != "" {
+		return "", false
+	}
+	for _, part := range []string{name, ver} {
+		if part == "" || part == "." || part == ".." || strings.ContainsAny(part, `/\`) {
+			return "", false
+		}
+	}
+	return filepath.Join(c.dir, name, ver, sum+"."+archiveExt(format)), true
+}
+
+// open возвращает архив из кэша, если он есть и его контрольная сумма совпадает с ожидаемой.
+// Поврежденный архив удаляется из кэша
+func (c *archiveCache) open(name, ver, checksum, format string) (*spoolFile, bool) {
+	if c == nil {
+		return nil, false
+	}
+	filePath, ok := c.path(name, ver, checksum, format)
+	if !ok {
+		return nil, false
+	}
+	spool, err := openSpoolFile(filePath)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Не удалось прочитать архив из кэша %s: %v", filePath, err)
+		}
+		return nil, false
+	}
+	if spool.Checksum() != checksum {
+		spool.Close()
+		log.Printf("Архив в кэше %s поврежден и будет скачан заново.", filePath)
+		c.remove(CacheEntry{path: filePath})
+		return nil, false
+	}
+	// Время изменения файла - время последнего использования для вытеснения
+	now := time.Now()
+	os.Chtimes(filePath, now, now)
+	return spool, true
+}
+
+// store сохраняет проверенный архив в кэш и вытесняет давно не использованные архивы,
+// если кэш превысил допустимый размер
+func (c *archiveCache) store(name, ver, format string, spool *spoolFile) error {
+	if c == nil {
+		return nil
+	}
+	filePath, ok := c.path(name, ver, spool.Checksum(), format)
+	if !ok {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return fmt.Errorf("ошибка создания директории кэша: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("ошибка записи в кэш: %w", err)
+	}
+	_, err = io.Copy(tmp, spool.Reader())
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filePath)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("ошибка записи в кэш: %w", err)
+	}
+	return c.evict(filePath)
+}
+
+// entries возвращает архивы в кэше
+func (c *archiveCache) entries() ([]CacheEntry, error) {
+	var entries []CacheEntry
+	err := filepath.WalkDir(c.dir, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && filePath == c.dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		sum, ext, _ := strings.Cut(d.Name(), ".")
+		if len(sum) != 64 || !slices.Contains(ArchiveFormats, ext) {
+			return nil
+		}
+		rel, err := filepath.Rel(c.dir, filePath)
+		if err != nil {
+			return err
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		if len(parts) != 3 {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entries = append(entries, CacheEntry{
+			Name:     parts[0],
+			Ver:      parts[1],
+			Checksum: "sha256:" + sum,
+			Size:     info.Size(),
+			Used:     info.ModTime(),
+			path:     filePath,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения кэша %s: %w", c.dir, err)
+	}
+	return entries, nil
+}
+
+// evict удаляет давно не использованные архивы, пока размер кэша больше допустимого.
+// Архив keep, только что сохраненный в кэш, не удаляется
+func (c *archiveCache) evict(keep string) error {
+	if c.maxSize <= 0 {
+		return nil
+	}
+	entries, err := c.entries()
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, entry := range entries {
+		total += entry.Size
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Used.Before(entries[j].Used) })
+	for _, entry := range entries {
+		if total <= c.maxSize {
+			break
+		}
+		if entry.path == keep {
+			continue
+		}
+		if err := c.remove(entry); err != nil {
+			return err
+		}
+		log.Printf("Архив %s %s удален из кэша: превышен размер кэша.", entry.Name, entry.Ver)
+		total -= entry.Size
+	}
+	return nil
+}
+
+// remove удаляет архив из кэша и ставшие пустыми директории версии и пакета
+func (c *archiveCache) remove(entry CacheEntry) error {
+	if err := os.Remove(entry.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("ошибка удаления %s из кэша: %w", entry.path, err)
+	}
+	versionDir := filepath.Dir(entry.path)
+	if os.Remove(versionDir) == nil {
+		os.Remove(filepath.Dir(versionDir))
+	}
+	return nil
+}
+
+// ListCache возвращает архивы в локальном кэше, отсортированные по имени и версии
+func ListCache(cfg *config.Config) ([]CacheEntry, error) {
+	c := newArchiveCache(cfg)
+	if c == nil {
+		return nil, nil
+	}
+	entries, err := c.entries()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Name != entries[j].Name {
+			return entries[i].Name < entries[j].Name
+		}
+		return entries[i].Ver < entries[j].Ver
+	})
+	return entries, nil
+}
+
+// CleanCache удаляет из кэша архивы пакета name или все архивы, если name пустое.
+// Возвращает число удаленных архивов и их общий размер
+func CleanCache(cfg *config.Config, name string) (int, int64, error) {
+	c := newArchiveCache(cfg)
+	if c == nil {
+		return 0, 0, nil
+	}
+	entries, err := c.entries()
+	if err != nil {
+		return 0, 0, err
+	}
+	var (
+		removed int
+		size    int64
+	)
+	for _, entry := range entries {
+		if name != "" && entry.Name != name {
+			continue
+		}
+		if err := c.remove(entry); err != nil {
+			return removed, size, err
+		}
+		removed++
+		size += entry.Size
+	}
+	return removed, size, nil
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"package-manager/internal/config"
+	"package-manager/internal/models"
+)
+
+// writeTestSpool создает временный файл архива с данными data
+func writeTestSpool(t *testing.T, data []byte) *spoolFile {
+	t.Helper()
+	spool, err := newSpoolFile()
+	if err != nil {
+		t.Fatalf("Не удалось создать временный файл: %v", err)
+	}
+	t.Cleanup(func() { spool.Close() })
+	if _, err := io.Copy(spool, bytes.NewReader(data)); err != nil {
+		t.Fatalf("Ошибка записи: %v", err)
+	}
+	return spool
+}
+
+// TestArchiveCache проверяет поиск по контрольной сумме, удаление поврежденных архивов и вытеснение
+func TestArchiveCache(t *testing.T) {
+	cfg := &config.Config{CacheDir: t.TempDir(), CacheMaxSize: 25}
+	cache := newArchiveCache(cfg)
+
+	first := writeTestSpool(t, bytes.Repeat([]byte("a"), 10))
+	if err := cache.store("lib", "1.0", "", first); err != nil {
+		t.Fatalf("Ошибка сохранения в кэш: %v", err)
+	}
+	spool, ok := cache.open("lib", "1.0", first.Checksum(), "")
+	if !ok || spool.Size() != 10 {
+		t.Fatalf("Ожидался архив из кэша")
+	}
+	spool.Close()
+	if _, err := os.Stat(filepath.Join(cfg.CacheDir, "lib", "1.0")); err != nil {
+		t.Errorf("Архив из кэша не должен удаляться при закрытии: %v", err)
+	}
+	if _, ok := cache.open("lib", "1.0", archiveChecksum([]byte("other")), ""); ok {
+		t.Error("Архив с другой контрольной суммой не должен находиться")
+	}
+	if _, ok := cache.open("..", "1.0", first.Checksum(), ""); ok {
+		t.Error("Недопустимое имя пакета не должно находиться в кэше")
+	}
+
+	// Давно не использованный архив вытесняется, когда кэш превышает допустимый размер
+	old := time.Now().Add(-time.Hour)
+	filePath, _ := cache.path("lib", "1.0", first.Checksum(), "")
+	os.Chtimes(filePath, old, old)
+	second := writeTestSpool(t, bytes.Repeat([]byte("b"), 10))
+	third := writeTestSpool(t, bytes.Repeat([]byte("c"), 10))
+	for ver, spool := range map[string]*spoolFile{"1.1": second, "1.2": third} {
+		if err := cache.store("lib", ver, "", spool); err != nil {
+			t.Fatalf("Ошибка сохранения в кэш: %v", err)
+		}
+	}
+	entries, err := ListCache(cfg)
+	if err != nil {
+		t.Fatalf("Ошибка чтения кэша: %v", err)
+	}
+	var versions []string
+	for _, entry := range entries {
+		versions = append(versions, entry.Ver)
+	}
+	if strings.Join(versions, ",") != "1.1,1.2" {
+		t.Errorf("Ожидалось вытеснение версии 1.0, в кэше %v", versions)
+	}
+
+	// Поврежденный архив удаляется из кэша
+	filePath, _ = cache.path("lib", "1.1", second.Checksum(), "")
+	if err := os.WriteFile(filePath, []byte("corrupted"), 0644); err != nil {
+		t.Fatalf("Не удалось повредить архив: %v", err)
+	}
+	if _, ok := cache.open("lib", "1.1", second.Checksum(), ""); ok {
+		t.Error("Поврежденный архив не должен использоваться")
+	}
+	if _, err := os.Stat(filePath); !os.IsNotExist(err) {
+		t.Errorf("Поврежденный архив должен удаляться из кэша: %v", err)
+	}
+
+	removed, size, err := CleanCache(cfg, "")
+	if err != nil || removed != 1 || size != 10 {
+		t.Errorf("Ожидалось удаление одного архива, получено %d (%d байт, %v)", removed, size, err)
+	}
+	if files, _ := os.ReadDir(cfg.CacheDir); len(files) != 0 {
+		t.Errorf("После очистки кэш должен быть пустым, найдено %d файлов", len(files))
+	}
+}
+
+// TestUpdatePackagesFromCache проверяет повторную установку из кэша и автономный режим
+func TestUpdatePackagesFromCache(t *testing.T) {
+	tempDir := t.TempDir()
+	cfg := &config.Config{CacheDir: filepath.Join(tempDir, "cache")}
+
+	remote := map[string][]byte{}
+	publishTestPackage(t, remote, "lib", map[string][]models.Package{"1.0": nil})
+	downloads := 0
+	mockBackend := newMemoryRemote(remote)
+	download := mockBackend.DownloadFileFunc
+	mockBackend.DownloadFileFunc = func(fileName string, w io.Writer) error {
+		if strings.HasSuffix(fileName, ".zip") {
+			downloads++
+		}
+		return download(fileName, w)
+	}
+
+	configFile := filepath.Join(tempDir, "packages.json")
+	if err := os.WriteFile(configFile, []byte(`{"signature": "none", "packages": [{"name": "lib"}]}`), 0644); err != nil {
+		t.Fatalf("Не удалось создать файл конфигурации: %v", err)
+	}
+	update := func(backend Backend, prefix string, opts UpdateOptions) error {
+		opts.Prefix = filepath.Join(tempDir, prefix)
+		return NewPackageManager(cfg, backend).UpdatePackages(t.Context(), configFile, opts)
+	}
+
+	// Второй проект с тем же пакетом использует архив из кэша
+	if err := update(mockBackend, "project-1", UpdateOptions{}); err != nil {
+		t.Fatalf("Ожидалось успешное обновление, но получена ошибка: %v", err)
+	}
+	if err := update(mockBackend, "project-2", UpdateOptions{}); err != nil {
+		t.Fatalf("Ожидалось успешное обновление, но получена ошибка: %v", err)
+	}
+	if downloads != 1 {
+		t.Errorf("Ожидалось одно скачивание архива, получено %d", downloads)
+	}
+
+	// В автономном режиме установка по lock-файлу идет из кэша, без кэша - ошибка
+	if err := update(OfflineBackend{}, "project-3", UpdateOptions{Locked: true}); err != nil {
+		t.Fatalf("Ожидалась установка из кэша, но получена ошибка: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(tempDir, "project-3", "lib.txt")); err != nil || string(data) != "lib-1.0" {
+		t.Errorf("Ожидался файл lib.txt, получено %q (%v)", data, err)
+	}
+	if _, _, err := CleanCache(cfg, "lib"); err != nil {
+		t.Fatalf("Ошибка очистки кэша: %v", err)
+	}
+	if err := update(OfflineBackend{}, "project-4", UpdateOptions{Locked: true}); !errors.Is(err, ErrOffline) {
+		t.Errorf("Ожидалась ошибка ErrOffline, получено: %v", err)
+	}
+}
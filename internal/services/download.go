@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"package-manager/internal/models"
+)
+
+// downloadResult - архив пакета, скачиваемый в фоне. done закрывается по завершении скачивания
+type downloadResult struct {
+	spool  *spoolFile
+	cached bool
+	err    error
+	done   chan struct{}
+}
+
+// downloadPool скачивает архивы пакетов параллельно, не более jobs одновременно.
+// Через SSH каждое скачивание идет в своей сессии поверх общего соединения.
+// Результаты забираются методом wait в порядке пакетов, поэтому распаковка идет в порядке зависимостей
+type downloadPool struct {
+	results []*downloadResult
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// startDownloads запускает скачивание архивов пакетов. Пул нужно закрыть вызовом Close
+func (pm *PackageManager) startDownloads(ctx context.Context, packages []models.LockedPackage, jobs int) *downloadPool {
+	ctx, cancel := context.WithCancel(ctx)
+	p := &downloadPool{results: make([]*downloadResult, len(packages)), cancel: cancel}
+	for i := range p.results {
+		p.results[i] = &downloadResult{done: make(chan struct{})}
+	}
+	jobs = max(1, min(jobs, len(packages)))
+
+	queue := make(chan int)
+	go func() {
+		defer close(queue)
+		for i := range packages {
+			select {
+			case queue <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var completed atomic.Int32
+	for range jobs {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for i := range queue {
+				pkg := &packages[i]
+				r := p.results[i]
+				archiveName := archivePath(pkg.Name, pkg.Ver, pkg.Format)
+				r.spool, r.cached, r.err = pm.fetchArchive(ctx, archiveName, pkg)
+				n := completed.Add(1)
+				if r.err == nil {
+					log.Printf("[%d/%d] Архив %s получен (%d байт).", n, len(packages), archiveName, r.spool.Size())
+				} else {
+					log.Printf("[%d/%d] Архив %s не получен.", n, len(packages), archiveName)
+				}
+				close(r.done)
+			}
+		}()
+	}
+	return p
+}
+
+// wait дожидается скачивания архива i-го пакета. Полученный архив закрывает вызывающий.
+// Отмена ctx прерывает ожидание: после отмены оставшиеся архивы не ставятся в очередь и не скачиваются
+func (p *downloadPool) wait(ctx context.Context, i int) (*spoolFile, bool, error) {
+	r := p.results[i]
+	select {
+	case <-r.done:
+	case <-ctx.Done():
+		return nil, false, ctx.Err()
+	}
+	spool := r.spool
+	r.spool = nil
+	return spool, r.cached, r.err
+}
+
+// Close прерывает скачивание оставшихся архивов и удаляет скачанные, но не забранные архивы
+func (p *downloadPool) Close() {
+	p.cancel()
+	p.wg.Wait()
+	for _, r := range p.results {
+		select {
+		case <-r.done:
+			if r.spool != nil {
+				r.spool.Close()
+				r.spool = nil
+			}
+		default:
+		}
+	}
+}
@@ -0,0 +1,456 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// defaultMaxExtractSize - допустимый суммарный размер распакованных файлов одного архива
+	defaultMaxExtractSize int64 = 4 << 30
+	// defaultMaxExtractEntries - допустимое число записей в одном архиве
+	defaultMaxExtractEntries = 100000
+	// maxSymlinkTarget - допустимая длина цели символической ссылки
+	maxSymlinkTarget = 4096
+)
+
+var (
+	// ErrUnsafeEntry сообщает, что в архиве есть записи, которые нельзя безопасно распаковать
+	ErrUnsafeEntry = errors.New("небезопасные записи в архиве")
+	// ErrTooManyEntries сообщает о превышении допустимого числа записей
+	ErrTooManyEntries = errors.New("превышено допустимое число записей в архиве")
+	// ErrArchiveTooLarge сообщает о превышении допустимого размера распакованных данных
+	ErrArchiveTooLarge = errors.New("превышен допустимый размер распакованных данных")
+)
+
+// RejectedEntry - запись архива, отклоненная при распаковке, и причина отказа
+type RejectedEntry struct {
+	Name   string
+	Reason string
+}
+
+// ExtractError сообщает, что архив отклонен при распаковке.
+// Err - одна из ErrUnsafeEntry, ErrTooManyEntries, ErrArchiveTooLarge
+type ExtractError struct {
+	Archive string
+	Err     error
+	Entries []RejectedEntry
+}
+
+func (e *ExtractError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "архив %s отклонен: %v", e.Archive, e.Err)
+	for i, entry := range e.Entries {
+		if i == 0 {
+			b.WriteString(": ")
+		} else {
+			b.WriteString("; ")
+		}
+		fmt.Fprintf(&b, "%q (%s)", entry.Name, entry.Reason)
+	}
+	return b.String()
+}
+
+func (e *ExtractError) Unwrap() error {
+	return e.Err
+}
+
+// extractLimits ограничивает распаковку одного архива, защищая от zip-бомб
+type extractLimits struct {
+	maxSize    int64
+	maxEntries int
+}
+
+func defaultExtractLimits() extractLimits {
+	return extractLimits{maxSize: defaultMaxExtractSize, maxEntries: defaultMaxExtractEntries}
+}
+
+// extractEntry - проверенная запись архива
+type extractEntry struct {
+	file archiveFile
+	// index - номер записи в архиве
+	index int
+	// name - очищенный относительный путь со слешами
+	name   string
+	target string
+}
+
+// extractPackageArchive распаковывает архив в директорию установки пакета, отбирая записи по фильтрам target.
+// Сначала проверяются все записи: если хотя бы одна отклонена, ничего не распаковывается.
+// Символические ссылки создаются последними, чтобы через них нельзя было записать файлы.
+// Права директорий из tar применяются после распаковки их содержимого.
+// Возвращает пути распакованных записей относительно директории установки, директории - с завершающим слешем.
+// Отмена ctx прерывает распаковку между записями
+func extractPackageArchive(ctx context.Context, archiveName string, archive packageArchive, target installTarget, limits extractLimits) ([]string, error) {
+	files, err := archive.files(limits.maxEntries)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения архива %s: %w", archiveName, err)
+	}
+	entries, err := checkEntries(archiveName, files, target, limits)
+	if err != nil {
+		return nil, err
+	}
+	byIndex := make(map[int]extractEntry, len(entries))
+	for _, entry := range entries {
+		byIndex[entry.index] = entry
+	}
+
+	dest := target.dir
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return nil, fmt.Errorf("не удалось создать директорию установки %s: %w", dest, err)
+	}
+	root, err := os.OpenRoot(dest)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось открыть директорию установки %s: %w", dest, err)
+	}
+	defer root.Close()
+
+	remaining := limits.maxSize
+	var (
+		installed []string
+		symlinks  []extractEntry
+		dirs      []extractEntry
+	)
+	err = archive.read(func(i int, open func() (io.ReadCloser, error)) error {
+		entry, ok := byIndex[i]
+		if !ok {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		mode := entry.file.mode
+		switch {
+		case mode.IsDir():
+			if err := mkdirAllInRoot(root, entry.name, mode.Perm()|0700); err != nil {
+				return fmt.Errorf("ошибка создания директории %s: %w", entry.name, err)
+			}
+			dirs = append(dirs, entry)
+			installed = append(installed, entry.name+"/")
+		case mode&fs.ModeSymlink != 0:
+			symlinks = append(symlinks, entry)
+		default:
+			written, err := extractFile(archiveName, root, entry, open, remaining)
+			if err != nil {
+				return err
+			}
+			remaining -= written
+			installed = append(installed, entry.name)
+			log.Printf("Распакован файл: %s", entry.name)
+		}
+		return nil
+	})
+	if err != nil {
+		var extractErr *ExtractError
+		if errors.As(err, &extractErr) || ctx.Err() != nil {
+			return installed, err
+		}
+		return installed, fmt.Errorf("ошибка чтения архива %s: %w", archiveName, err)
+	}
+
+	for _, entry := range symlinks {
+		if err := createSymlink(archiveName, root, dest, entry); err != nil {
+			return installed, err
+		}
+		if err := setOwner(dest, entry); err != nil {
+			return installed, err
+		}
+		installed = append(installed, entry.name)
+		log.Printf("Создана ссылка: %s -> %s", entry.name, entry.target)
+	}
+
+	// Вложенные директории обрабатываются раньше родительских: права родительской
+	// директории без записи не мешают изменить вложенную
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := setDirMode(dest, dirs[i]); err != nil {
+			return installed, err
+		}
+	}
+	return installed, nil
+}
+
+// checkEntries проверяет имена, типы и размеры записей архива до распаковки.
+// Возвращаются только записи, которые нужно установить, с путями внутри директории установки
+func checkEntries(archiveName string, files []archiveFile, target installTarget, limits extractLimits) ([]extractEntry, error) {
+	if len(files) > limits.maxEntries {
+		return nil, &ExtractError{
+			Archive: archiveName,
+			Err:     ErrTooManyEntries,
+			Entries: []RejectedEntry{{Name: archiveName, Reason: fmt.Sprintf("%d записей, допустимо %d", len(files), limits.maxEntries)}},
+		}
+	}
+
+	var (
+		entries  []extractEntry
+		rejected []RejectedEntry
+		total    uint64
+	)
+	symlinks := make(map[string]bool)
+	for i, f := range files {
+		name, reason := cleanEntryName(f.name)
+		if reason == "" {
+			var install bool
+			if name, install = target.mapEntry(name); !install {
+				continue
+			}
+			mode := f.mode
+			switch {
+			case f.hardlink:
+				reason = "жесткие ссылки не поддерживаются"
+			case mode.IsDir():
+			case mode.IsRegular():
+				if name == "." {
+					reason = "пустое имя"
+				}
+			case mode&fs.ModeSymlink != 0:
+				reason = checkSymlinkEntry(name, f.link)
+				if reason == "" {
+					symlinks[name] = true
+					entries = append(entries, extractEntry{file: f, index: i, name: name, target: f.link})
+					continue
+				}
+			default:
+				reason = "неподдерживаемый тип файла " + mode.Type().String()
+			}
+		}
+		if reason != "" {
+			rejected = append(rejected, RejectedEntry{Name: f.name, Reason: reason})
+			continue
+		}
+		if name == "." {
+			// Запись "./" описывает саму директорию установки
+			continue
+		}
+		total += f.size
+		entries = append(entries, extractEntry{file: f, index: i, name: name})
+	}
+
+	// Запись не должна попадать на диск через символическую ссылку из того же архива
+	for _, entry := range entries {
+		for dir := path.Dir(entry.name); dir != "."; dir = path.Dir(dir) {
+			if symlinks[dir] {
+				rejected = append(rejected, RejectedEntry{Name: entry.file.name, Reason: "путь проходит через символическую ссылку " + dir})
+				break
+			}
+		}
+	}
+
+	if len(rejected) > 0 {
+		return nil, &ExtractError{Archive: archiveName, Err: ErrUnsafeEntry, Entries: rejected}
+	}
+	if total > uint64(limits.maxSize) {
+		return nil, &ExtractError{
+			Archive: archiveName,
+			Err:     ErrArchiveTooLarge,
+			Entries: []RejectedEntry{{Name: archiveName, Reason: fmt.Sprintf("%d байт, допустимо %d", total, limits.maxSize)}},
+		}
+	}
+	return entries, nil
+}
+
+// cleanEntryName приводит имя записи к относительному пути внутри директории установки.
+// Для недопустимого имени возвращается причина отказа
+func cleanEntryName(name string) (string, string) {
+	switch {
+	case name == "":
+		return "", "пустое имя"
+	case strings.ContainsRune(name, 0):
+		return "", "нулевой байт в имени"
+	case strings.Contains(name, `\`):
+		return "", "обратная косая черта в имени"
+	case path.IsAbs(name) || filepath.VolumeName(name) != "" || (len(name) > 1 && name[1] == ':'):
+		return "", "абсолютный путь"
+	}
+	cleaned := path.Clean(name)
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", "выход за пределы директории установки"
+	}
+	return cleaned, ""
+}
+
+// checkSymlinkEntry проверяет, что цель символической ссылки не выходит за пределы
+// директории установки. Возвращает причину отказа или пустую строку
+func checkSymlinkEntry(name, target string) string {
+	if name == "." {
+		return "символическая ссылка на месте директории установки"
+	}
+	if len(target) > maxSymlinkTarget {
+		return "слишком длинная цель ссылки"
+	}
+	switch {
+	case target == "" || strings.ContainsRune(target, 0) || strings.Contains(target, `\`):
+		return "недопустимая цель ссылки"
+	case path.IsAbs(target) || filepath.VolumeName(target) != "":
+		return "символическая ссылка на абсолютный путь " + target
+	}
+	// ".." допускается только в начале цели: после перехода в другую ссылку
+	// подъем вверх уже нельзя проверить по имени
+	descended := false
+	for _, part := range strings.Split(target, "/") {
+		switch part {
+		case "..":
+			if descended {
+				return "недопустимая цель ссылки " + target
+			}
+		case ".", "":
+		default:
+			descended = true
+		}
+	}
+	resolved := path.Join(path.Dir(name), target)
+	if resolved == ".." || strings.HasPrefix(resolved, "../") {
+		return "символическая ссылка за пределы директории установки: " + target
+	}
+	return ""
+}
+
+// extractFile распаковывает обычный файл, не позволяя записать больше remaining байт.
+// Возвращает число записанных байт
+func extractFile(archiveName string, root *os.Root, entry extractEntry, open func() (io.ReadCloser, error), remaining int64) (int64, error) {
+	if dir := path.Dir(entry.name); dir != "." {
+		if err := mkdirAllInRoot(root, dir, 0755); err != nil {
+			return 0, fmt.Errorf("ошибка создания директории %s: %w", dir, err)
+		}
+	}
+	// Существующая ссылка заменяется файлом, а не используется для записи
+	if info, err := root.Lstat(entry.name); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+		if err := root.Remove(entry.name); err != nil {
+			return 0, fmt.Errorf("ошибка удаления ссылки %s: %w", entry.name, err)
+		}
+	}
+
+	perm := entry.file.mode.Perm()
+	if perm == 0 && !entry.file.unix {
+		perm = 0644
+	}
+	outFile, err := root.OpenFile(entry.name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка создания файла %s: %w", entry.name, err)
+	}
+	defer outFile.Close()
+	rc, err := open()
+	if err != nil {
+		return 0, fmt.Errorf("ошибка открытия файла в архиве %s: %w", entry.file.name, err)
+	}
+	defer rc.Close()
+
+	// Размеры в заголовках проверены заранее, но фактический объем данных тоже ограничивается
+	written, err := io.Copy(outFile, io.LimitReader(rc, remaining+1))
+	if err != nil {
+		return written, fmt.Errorf("ошибка распаковки файла %s: %w", entry.file.name, err)
+	}
+	if written > remaining {
+		return written, &ExtractError{
+			Archive: archiveName,
+			Err:     ErrArchiveTooLarge,
+			Entries: []RejectedEntry{{Name: entry.file.name, Reason: "данные больше размера в заголовке"}},
+		}
+	}
+	if entry.file.unix {
+		// Права из tar применяются точно, без учета umask
+		if err := outFile.Chmod(perm); err != nil {
+			return written, fmt.Errorf("ошибка установки прав файла %s: %w", entry.name, err)
+		}
+		if canChown() {
+			if err := outFile.Chown(entry.file.uid, entry.file.gid); err != nil {
+				return written, fmt.Errorf("ошибка смены владельца файла %s: %w", entry.name, err)
+			}
+		}
+	}
+	return written, outFile.Close()
+}
+
+// canChown сообщает, что владельца файлов из tar можно восстановить: как и tar,
+// pm меняет владельца только при запуске от root
+func canChown() bool {
+	return os.Geteuid() == 0
+}
+
+// setOwner восстанавливает владельца символической ссылки из tar
+func setOwner(dest string, entry extractEntry) error {
+	if !entry.file.unix || !canChown() {
+		return nil
+	}
+	if err := os.Lchown(filepath.Join(dest, filepath.FromSlash(entry.name)), entry.file.uid, entry.file.gid); err != nil {
+		return fmt.Errorf("ошибка смены владельца %s: %w", entry.name, err)
+	}
+	return nil
+}
+
+// setDirMode применяет права и владельца директории из tar. Директория, замененная
+// ссылкой из того же архива, пропускается
+func setDirMode(dest string, entry extractEntry) error {
+	if !entry.file.unix {
+		return nil
+	}
+	dirPath := filepath.Join(dest, filepath.FromSlash(entry.name))
+	info, err := os.Lstat(dirPath)
+	if err != nil || !info.IsDir() {
+		return nil
+	}
+	if err := os.Chmod(dirPath, entry.file.mode.Perm()); err != nil {
+		return fmt.Errorf("ошибка установки прав директории %s: %w", entry.name, err)
+	}
+	if canChown() {
+		if err := os.Lchown(dirPath, entry.file.uid, entry.file.gid); err != nil {
+			return fmt.Errorf("ошибка смены владельца %s: %w", entry.name, err)
+		}
+	}
+	return nil
+}
+
+// mkdirAllInRoot создает директорию и ее родителей внутри root
+func mkdirAllInRoot(root *os.Root, dir string, perm fs.FileMode) error {
+	parts := strings.Split(dir, "/")
+	for i := range parts {
+		err := root.Mkdir(strings.Join(parts[:i+1], "/"), perm)
+		if err != nil && !errors.Is(err, fs.ErrExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// createSymlink создает символическую ссылку из архива. Родительские директории проверяются:
+// через уже существующую ссылку ссылка из архива могла бы оказаться вне директории установки
+func createSymlink(archiveName string, root *os.Root, dest string, entry extractEntry) error {
+	dir := path.Dir(entry.name)
+	if dir != "." {
+		if err := mkdirAllInRoot(root, dir, 0755); err != nil {
+			return fmt.Errorf("ошибка создания директории %s: %w", dir, err)
+		}
+		parts := strings.Split(dir, "/")
+		for i := range parts {
+			parent := strings.Join(parts[:i+1], "/")
+			info, err := root.Lstat(parent)
+			if err != nil {
+				return fmt.Errorf("ошибка проверки директории %s: %w", parent, err)
+			}
+			if !info.IsDir() {
+				return &ExtractError{
+					Archive: archiveName,
+					Err:     ErrUnsafeEntry,
+					Entries: []RejectedEntry{{Name: entry.file.name, Reason: "путь проходит через символическую ссылку " + parent}},
+				}
+			}
+		}
+	}
+
+	if _, err := root.Lstat(entry.name); err == nil {
+		if err := root.Remove(entry.name); err != nil {
+			return fmt.Errorf("ошибка замены %s ссылкой: %w", entry.name, err)
+		}
+	}
+	if err := os.Symlink(entry.target, filepath.Join(dest, filepath.FromSlash(entry.name))); err != nil {
+		return fmt.Errorf("ошибка создания ссылки %s: %w", entry.name, err)
+	}
+	return nil
+}
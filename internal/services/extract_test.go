@@ -0,0 +1,350 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"package-manager/internal/models"
+)
+
+// testZipEntry описывает запись тестового архива
+type testZipEntry struct {
+	name string
+	mode fs.FileMode
+	data string
+}
+
+// buildTestZipData собирает ZIP-архив из записей, включая ссылки и записи с опасными именами
+func buildTestZipData(t *testing.T, entries []testZipEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Deflate}
+		mode := entry.mode
+		if mode == 0 {
+			mode = 0644
+		}
+		header.SetMode(mode)
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			t.Fatalf("Не удалось добавить %s в архив: %v", entry.name, err)
+		}
+		if _, err := w.Write([]byte(entry.data)); err != nil {
+			t.Fatalf("Не удалось записать %s в архив: %v", entry.name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Не удалось закрыть архив: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// buildTestZip собирает ZIP-архив из записей и открывает его для чтения
+func buildTestZip(t *testing.T, entries []testZipEntry) *zip.Reader {
+	t.Helper()
+	data := buildTestZipData(t, entries)
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Не удалось открыть архив: %v", err)
+	}
+	return zr
+}
+
+// TestExtractZip проверяет распаковку файлов, директорий и ссылок внутри директории установки
+func TestExtractZip(t *testing.T) {
+	dest := t.TempDir()
+	zr := buildTestZip(t, []testZipEntry{
+		{name: "./"},
+		{name: "bin/", mode: fs.ModeDir | 0755},
+		{name: "bin/tool", mode: 0755, data: "#!/bin/sh\n"},
+		{name: "lib/current", mode: fs.ModeSymlink | 0777, data: "../share/v1"},
+		{name: "share/v1/data.txt", data: "data"},
+	})
+	installed, err := extractPackageArchive(t.Context(), "app.zip", zipArchive{zr}, installTarget{dir: dest}, defaultExtractLimits())
+	if err != nil {
+		t.Fatalf("Ожидалась успешная распаковка, получено: %v", err)
+	}
+	if got, want := strings.Join(installed, ","), "bin/,bin/tool,share/v1/data.txt,lib/current"; got != want {
+		t.Errorf("Ожидался список файлов %s, получено %s", want, got)
+	}
+
+	info, err := os.Stat(filepath.Join(dest, "bin", "tool"))
+	if err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("Ожидался исполняемый файл bin/tool, получено %v (%v)", info, err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dest, "lib", "current", "data.txt")); err != nil || string(data) != "data" {
+		t.Errorf("Ожидалось чтение через ссылку lib/current, получено %q (%v)", data, err)
+	}
+}
+
+// TestExtractZipMapping проверяет отбрасывание префикса и фильтры путей
+func TestExtractZipMapping(t *testing.T) {
+	dest := t.TempDir()
+	layout, err := newInstallLayout([]models.Package{{
+		Name:        "app",
+		Dest:        "plugins",
+		StripPrefix: "app-1.0/",
+		Paths:       []string{"bin", "lib/*.so"},
+	}}, dest)
+	if err != nil {
+		t.Fatalf("Ошибка настроек установки: %v", err)
+	}
+	zr := buildTestZip(t, []testZipEntry{
+		{name: "README", data: "outside prefix"},
+		{name: "app-1.0/", mode: fs.ModeDir | 0755},
+		{name: "app-1.0/bin/tool", data: "tool"},
+		{name: "app-1.0/lib/libapp.so", data: "so"},
+		{name: "app-1.0/lib/libapp.a", data: "static"},
+		{name: "app-1.0/docs/index.html", data: "docs"},
+	})
+	if _, err := extractPackageArchive(t.Context(), "app.zip", zipArchive{zr}, layout.forPackage("app"), defaultExtractLimits()); err != nil {
+		t.Fatalf("Ожидалась успешная распаковка, получено: %v", err)
+	}
+
+	var installed []string
+	filepath.WalkDir(dest, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			rel, _ := filepath.Rel(dest, p)
+			installed = append(installed, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	want := []string{"plugins/bin/tool", "plugins/lib/libapp.so"}
+	if strings.Join(installed, ",") != strings.Join(want, ",") {
+		t.Errorf("Ожидалась установка %v, получено %v", want, installed)
+	}
+
+	// Пакеты без настроек устанавливаются в корень установки целиком
+	if target := layout.forPackage("lib"); target.dir != dest || target.stripPrefix != "" || len(target.paths) != 0 {
+		t.Errorf("Неожиданные настройки по умолчанию: %+v", target)
+	}
+	if _, err := newInstallLayout([]models.Package{{Name: "app", StripPrefix: "../x"}}, ""); err == nil {
+		t.Error("Ожидалась ошибка для strip_prefix за пределами архива")
+	}
+	if _, err := newInstallLayout([]models.Package{{Name: "app", Dest: "../x"}}, dest); err == nil {
+		t.Error("Ожидалась ошибка для dest за пределами корня установки")
+	}
+}
+
+// TestExtractZipRejectsUnsafeEntries проверяет, что все опасные записи перечислены в ошибке
+// и ничего не распаковано
+func TestExtractZipRejectsUnsafeEntries(t *testing.T) {
+	dest := t.TempDir()
+	zr := buildTestZip(t, []testZipEntry{
+		{name: "ok.txt", data: "ok"},
+		{name: "../../etc/cron.d/x", data: "evil"},
+		{name: "/etc/passwd", data: "evil"},
+		{name: `..\evil.txt`, data: "evil"},
+		{name: "abs-link", mode: fs.ModeSymlink | 0777, data: "/etc"},
+		{name: "up-link", mode: fs.ModeSymlink | 0777, data: "../.."},
+		{name: "hop-link", mode: fs.ModeSymlink | 0777, data: "abs-link/../x"},
+		{name: "dir-link", mode: fs.ModeSymlink | 0777, data: "sub"},
+		{name: "dir-link/x", data: "through link"},
+		{name: "fifo", mode: fs.ModeNamedPipe | 0644},
+	})
+
+	_, err := extractPackageArchive(t.Context(), "evil.zip", zipArchive{zr}, installTarget{dir: dest}, defaultExtractLimits())
+	var extractErr *ExtractError
+	if !errors.As(err, &extractErr) || !errors.Is(err, ErrUnsafeEntry) {
+		t.Fatalf("Ожидалась ошибка ErrUnsafeEntry, получено: %v", err)
+	}
+	rejected := make(map[string]bool)
+	for _, entry := range extractErr.Entries {
+		rejected[entry.Name] = true
+	}
+	for _, name := range []string{"../../etc/cron.d/x", "/etc/passwd", `..\evil.txt`, "abs-link", "up-link", "hop-link", "dir-link/x", "fifo"} {
+		if !rejected[name] {
+			t.Errorf("Запись %s не отклонена: %+v", name, extractErr.Entries)
+		}
+	}
+	if rejected["ok.txt"] || rejected["dir-link"] {
+		t.Errorf("Отклонены безопасные записи: %+v", extractErr.Entries)
+	}
+
+	if files, _ := os.ReadDir(dest); len(files) != 0 {
+		t.Errorf("При отклоненном архиве ничего не должно распаковываться, найдено %d файлов", len(files))
+	}
+}
+
+// TestExtractZipLimits проверяет ограничения на число записей и размер распакованных данных
+func TestExtractZipLimits(t *testing.T) {
+	entries := []testZipEntry{{name: "a", data: "0123456789"}, {name: "b", data: "0123456789"}, {name: "c", data: "0123456789"}}
+
+	_, err := extractPackageArchive(t.Context(), "many.zip", zipArchive{buildTestZip(t, entries)}, installTarget{dir: t.TempDir()}, extractLimits{maxSize: 1 << 20, maxEntries: 2})
+	if !errors.Is(err, ErrTooManyEntries) {
+		t.Errorf("Ожидалась ошибка ErrTooManyEntries, получено: %v", err)
+	}
+
+	_, err = extractPackageArchive(t.Context(), "big.zip", zipArchive{buildTestZip(t, entries)}, installTarget{dir: t.TempDir()}, extractLimits{maxSize: 25, maxEntries: 10})
+	var extractErr *ExtractError
+	if !errors.As(err, &extractErr) || !errors.Is(err, ErrArchiveTooLarge) || extractErr.Archive != "big.zip" {
+		t.Errorf("Ожидалась ошибка ErrArchiveTooLarge, получено: %v", err)
+	}
+}
+
+// TestExtractZipExistingSymlinks проверяет, что ссылки, уже лежащие в директории установки,
+// не позволяют записать файлы за ее пределами
+func TestExtractZipExistingSymlinks(t *testing.T) {
+	dest := t.TempDir()
+	outside := t.TempDir()
+	outsideFile := filepath.Join(outside, "config")
+	if err := os.WriteFile(outsideFile, []byte("original"), 0644); err != nil {
+		t.Fatalf("Не удалось создать файл: %v", err)
+	}
+	if err := os.Symlink(outsideFile, filepath.Join(dest, "config")); err != nil {
+		t.Fatalf("Не удалось создать ссылку: %v", err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dest, "out")); err != nil {
+		t.Fatalf("Не удалось создать ссылку: %v", err)
+	}
+
+	// Файл заменяет ссылку, а не пишет по ней
+	zr := buildTestZip(t, []testZipEntry{{name: "config", data: "new"}})
+	if _, err := extractPackageArchive(t.Context(), "app.zip", zipArchive{zr}, installTarget{dir: dest}, defaultExtractLimits()); err != nil {
+		t.Fatalf("Ожидалась успешная распаковка, получено: %v", err)
+	}
+	if info, err := os.Lstat(filepath.Join(dest, "config")); err != nil || !info.Mode().IsRegular() {
+		t.Errorf("Ожидался обычный файл config на месте ссылки, получено %v (%v)", info, err)
+	}
+
+	// Запись через ссылку на внешнюю директорию отклоняется
+	zr = buildTestZip(t, []testZipEntry{{name: "out/config", data: "evil"}})
+	if _, err := extractPackageArchive(t.Context(), "app.zip", zipArchive{zr}, installTarget{dir: dest}, defaultExtractLimits()); err == nil {
+		t.Error("Ожидалась ошибка записи через ссылку за пределы директории установки")
+	}
+	zr = buildTestZip(t, []testZipEntry{{name: "out/link", mode: fs.ModeSymlink | 0777, data: "config"}})
+	if _, err := extractPackageArchive(t.Context(), "app.zip", zipArchive{zr}, installTarget{dir: dest}, defaultExtractLimits()); !errors.Is(err, ErrUnsafeEntry) {
+		t.Errorf("Ожидалась ошибка ErrUnsafeEntry для ссылки во внешней директории, получено: %v", err)
+	}
+
+	if data, err := os.ReadFile(outsideFile); err != nil || string(data) != "original" {
+		t.Errorf("Файл за пределами директории установки изменен: %q (%v)", data, err)
+	}
+	if _, err := os.Lstat(filepath.Join(outside, "link")); !os.IsNotExist(err) {
+		t.Errorf("Ссылка создана за пределами директории установки: %v", err)
+	}
+}
+
+// testTarEntry описывает запись тестового tar-архива
+type testTarEntry struct {
+	name     string
+	typeflag byte
+	mode     int64
+	link     string
+	data     string
+}
+
+// buildTestTar собирает tar-архив в формате format (tar.gz или tar.zst)
+func buildTestTar(t *testing.T, format string, entries []testTarEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var compressor io.WriteCloser
+	switch format {
+	case FormatTarGz:
+		compressor = gzip.NewWriter(&buf)
+	case FormatTarZst:
+		zw, err := zstd.NewWriter(&buf)
+		if err != nil {
+			t.Fatalf("Не удалось создать zstd-кодировщик: %v", err)
+		}
+		compressor = zw
+	}
+	tw := tar.NewWriter(compressor)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Typeflag: entry.typeflag, Mode: entry.mode, Linkname: entry.link, Size: int64(len(entry.data))}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatalf("Не удалось добавить %s в архив: %v", entry.name, err)
+		}
+		if _, err := tw.Write([]byte(entry.data)); err != nil {
+			t.Fatalf("Не удалось записать %s в архив: %v", entry.name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Не удалось закрыть архив: %v", err)
+	}
+	if err := compressor.Close(); err != nil {
+		t.Fatalf("Не удалось закрыть архив: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// TestExtractTar проверяет распаковку tar.gz и tar.zst с точными правами доступа и ссылками,
+// а также отклонение жестких ссылок и путей за пределами директории установки
+func TestExtractTar(t *testing.T) {
+	for _, format := range []string{FormatTarGz, FormatTarZst} {
+		t.Run(format, func(t *testing.T) {
+			data := buildTestTar(t, format, []testTarEntry{
+				{name: "bin/", typeflag: tar.TypeDir, mode: 0700},
+				{name: "bin/tool", typeflag: tar.TypeReg, mode: 0777, data: "#!/bin/sh\n"},
+				{name: "secret", typeflag: tar.TypeReg, mode: 0600, data: "secret"},
+				{name: "tool", typeflag: tar.TypeSymlink, mode: 0777, link: "bin/tool"},
+			})
+			archive := &tarArchive{format: format, open: func() io.Reader { return bytes.NewReader(data) }}
+			dest := t.TempDir()
+			if _, err := extractPackageArchive(t.Context(), "app."+format, archive, installTarget{dir: dest}, defaultExtractLimits()); err != nil {
+				t.Fatalf("Ожидалась успешная распаковка, получено: %v", err)
+			}
+			// Права применяются точно, без учета umask
+			for name, perm := range map[string]fs.FileMode{"bin": 0700, "bin/tool": 0777, "secret": 0600} {
+				if info, err := os.Stat(filepath.Join(dest, name)); err != nil || info.Mode().Perm() != perm {
+					t.Errorf("Ожидались права %v для %s, получено %v (%v)", perm, name, info, err)
+				}
+			}
+			if link, err := os.Readlink(filepath.Join(dest, "tool")); err != nil || link != "bin/tool" {
+				t.Errorf("Ожидалась ссылка на bin/tool, получено %q (%v)", link, err)
+			}
+
+			data = buildTestTar(t, format, []testTarEntry{
+				{name: "ok.txt", typeflag: tar.TypeReg, mode: 0644, data: "ok"},
+				{name: "hard", typeflag: tar.TypeLink, link: "ok.txt"},
+				{name: "../evil.txt", typeflag: tar.TypeReg, mode: 0644, data: "evil"},
+				{name: "null", typeflag: tar.TypeChar, mode: 0666},
+			})
+			archive = &tarArchive{format: format, open: func() io.Reader { return bytes.NewReader(data) }}
+			dest = t.TempDir()
+			_, err := extractPackageArchive(t.Context(), "evil."+format, archive, installTarget{dir: dest}, defaultExtractLimits())
+			var extractErr *ExtractError
+			if !errors.As(err, &extractErr) || !errors.Is(err, ErrUnsafeEntry) || len(extractErr.Entries) != 3 {
+				t.Fatalf("Ожидалась ошибка ErrUnsafeEntry для трех записей, получено: %v", err)
+			}
+			if files, _ := os.ReadDir(dest); len(files) != 0 {
+				t.Errorf("При отклоненном архиве ничего не должно распаковываться, найдено %d файлов", len(files))
+			}
+		})
+	}
+}
+
+// TestDetectArchiveFormat проверяет определение формата по сигнатуре и по расширению
+func TestDetectArchiveFormat(t *testing.T) {
+	zipData := buildTestZipData(t, []testZipEntry{{name: "a", data: "a"}})
+	zstData := buildTestTar(t, FormatTarZst, []testTarEntry{{name: "a", typeflag: tar.TypeReg, mode: 0644, data: "a"}})
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"app.zip", zipData, FormatZip},
+		{"app.zip", zstData, FormatTarZst}, // сигнатура важнее расширения
+		{"app.bin", buildTestTar(t, FormatTarGz, nil), FormatTarGz},
+		{"app.tgz", []byte("?"), FormatTarGz},
+		{"app.tar.zst", nil, FormatTarZst},
+		{"app.bin", []byte("unknown"), ""},
+	}
+	for _, tt := range tests {
+		got, err := detectArchiveFormat(tt.name, bytes.NewReader(tt.data))
+		if got != tt.want || (err != nil) != (tt.want == "") {
+			t.Errorf("detectArchiveFormat(%s, % x) = %q, %v; ожидалось %q", tt.name, tt.data[:min(4, len(tt.data))], got, err, tt.want)
+		}
+	}
+}
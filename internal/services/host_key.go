@@ -0,0 +1,163 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"package-manager/internal/config"
+)
+
+// HostKeyError возвращается, если ключ SSH-сервера неизвестен или не совпадает с известным.
+// Сообщение содержит отпечаток полученного ключа, чтобы его можно было сверить с сервером
+type HostKeyError struct {
+	Host        string
+	KeyType     string
+	Fingerprint string
+	// Changed - для сервера известен другой ключ (в Known указано, где он записан)
+	Changed bool
+	Known   string
+}
+
+func (e *HostKeyError) Error() string {
+	if e.Changed {
+		return fmt.Sprintf("ключ SSH-сервера %s изменился: получен %s %s, ожидался ключ из %s. "+
+			"Возможна атака посредника; если ключ сменился штатно, удалите старую запись",
+			e.Host, e.KeyType, e.Fingerprint, e.Known)
+	}
+	return fmt.Sprintf("ключ SSH-сервера %s неизвестен: %s %s. Добавьте его в %s "+
+		"или задайте отпечаток в PM_SSH_HOST_KEY_FINGERPRINT", e.Host, e.KeyType, e.Fingerprint, e.Known)
+}
+
+// hostKeyCheck проверяет ключ SSH-сервера по политике из конфигурации
+type hostKeyCheck struct {
+	policy      string
+	fingerprint string
+	knownHosts  string
+}
+
+// newHostKeyCheck создает проверку ключа сервера. Непустой fingerprint заменяет known_hosts.
+// Пустые политика и путь к known_hosts означают strict и ~/.ssh/known_hosts
+func newHostKeyCheck(cfg *config.Config, fingerprint string) (*hostKeyCheck, error) {
+	check := &hostKeyCheck{policy: cfg.HostKeyPolicy, fingerprint: fingerprint, knownHosts: cfg.KnownHosts}
+	if check.policy == "" {
+		check.policy = "strict"
+	}
+	if check.knownHosts == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("не удалось определить домашнюю директорию: %w", err)
+		}
+		check.knownHosts = filepath.Join(homeDir, ".ssh", "known_hosts")
+	}
+	return check, nil
+}
+
+// callback проверяет ключ сервера при рукопожатии (ssh.HostKeyCallback)
+func (h *hostKeyCheck) callback(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	fingerprint := ssh.FingerprintSHA256(key)
+	if h.fingerprint != "" {
+		if fingerprint != h.fingerprint {
+			return &HostKeyError{Host: hostname, KeyType: key.Type(), Fingerprint: fingerprint,
+				Changed: true, Known: "PM_SSH_HOST_KEY_FINGERPRINT (" + h.fingerprint + ")"}
+		}
+		return nil
+	}
+
+	checker, err := h.checker()
+	if err != nil {
+		return err
+	}
+	err = checker(hostname, remote, key)
+	var keyErr *knownhosts.KeyError
+	if !errors.As(err, &keyErr) {
+		return err
+	}
+	if len(keyErr.Want) > 0 {
+		want := keyErr.Want[0]
+		return &HostKeyError{Host: hostname, KeyType: key.Type(), Fingerprint: fingerprint,
+			Changed: true, Known: fmt.Sprintf("%s:%d", want.Filename, want.Line)}
+	}
+
+	// tofu (доверие при первом подключении) - то же, что accept-new: ключ запоминается,
+	// и следующие подключения проверяются по нему
+	switch h.policy {
+	case "accept-new", "tofu":
+		if err := h.add(hostname, key); err != nil {
+			return fmt.Errorf("не удалось записать ключ сервера в %s: %w", h.knownHosts, err)
+		}
+		log.Printf("Ключ SSH-сервера %s (%s %s) добавлен в %s", hostname, key.Type(), fingerprint, h.knownHosts)
+		return nil
+	}
+	return &HostKeyError{Host: hostname, KeyType: key.Type(), Fingerprint: fingerprint, Known: h.knownHosts}
+}
+
+// checker читает known_hosts. Отсутствующий файл считается пустым
+func (h *hostKeyCheck) checker() (ssh.HostKeyCallback, error) {
+	checker, err := knownhosts.New(h.knownHosts)
+	if errors.Is(err, fs.ErrNotExist) {
+		return knownhosts.New(os.DevNull)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения %s: %w", h.knownHosts, err)
+	}
+	return checker, nil
+}
+
+// add дописывает ключ сервера в known_hosts
+func (h *hostKeyCheck) add(hostname string, key ssh.PublicKey) error {
+	if err := os.MkdirAll(filepath.Dir(h.knownHosts), 0700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(h.knownHosts, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = fmt.Fprintln(file, knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key))
+	return err
+}
+
+// algorithms возвращает алгоритмы ключей, известных для сервера addr. Без этого сервер может
+// предъявить ключ другого типа, и проверка ошибочно сочтет его измененным.
+// Пустой список означает алгоритмы по умолчанию
+func (h *hostKeyCheck) algorithms(addr string) []string {
+	if h.fingerprint != "" {
+		return nil
+	}
+	checker, err := h.checker()
+	if err != nil {
+		return nil
+	}
+	// Проверка заведомо чужого ключа возвращает все известные ключи сервера
+	var keyErr *knownhosts.KeyError
+	if !errors.As(checker(addr, &net.TCPAddr{}, probeKey{}), &keyErr) {
+		return nil
+	}
+	var algorithms []string
+	for _, known := range keyErr.Want {
+		keyType := known.Key.Type()
+		if slices.Contains(algorithms, keyType) {
+			continue
+		}
+		if keyType == ssh.KeyAlgoRSA {
+			algorithms = append(algorithms, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256)
+		}
+		algorithms = append(algorithms, keyType)
+	}
+	return algorithms
+}
+
+// probeKey - ключ, который не совпадает ни с одним ключом из known_hosts
+type probeKey struct{}
+
+func (probeKey) Type() string                        { return "probe" }
+func (probeKey) Marshal() []byte                     { return []byte("probe") }
+func (probeKey) Verify([]byte, *ssh.Signature) error { return errors.New("probe") }
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// TestSSHClientHostKeyPolicy проверяет режимы проверки ключа сервера, закрепленный отпечаток
+// и сообщение об измененном ключе
+func TestSSHClientHostKeyPolicy(t *testing.T) {
+	cfg, _ := newTestSSHConfig(t, "ssh", "")
+	knownHostsPath := filepath.Join(t.TempDir(), "known_hosts")
+	cfg.KnownHosts = knownHostsPath
+	connect := func(policy, fingerprint string) error {
+		cfg.HostKeyPolicy = policy
+		cfg.HostKeyFingerprint = fingerprint
+		client := NewSSHClient(cfg)
+		defer client.Close()
+		_, err := client.connect(t.Context())
+		return err
+	}
+
+	// strict не доверяет неизвестному ключу и показывает его отпечаток
+	err := connect("strict", "")
+	var hostKeyErr *HostKeyError
+	if !errors.As(err, &hostKeyErr) || hostKeyErr.Changed || hostKeyErr.Fingerprint == "" {
+		t.Fatalf("Ожидалась ошибка неизвестного ключа с отпечатком, получено: %v", err)
+	}
+	fingerprint := hostKeyErr.Fingerprint
+
+	// Пустая политика означает strict
+	if err := connect("", ""); !errors.As(err, &hostKeyErr) || hostKeyErr.Changed {
+		t.Fatalf("Ожидалась ошибка неизвестного ключа по умолчанию, получено: %v", err)
+	}
+
+	// tofu и accept-new записывают ключ в known_hosts при первом подключении
+	for _, policy := range []string{"tofu", "accept-new"} {
+		if err := os.Remove(knownHostsPath); err != nil && !os.IsNotExist(err) {
+			t.Fatalf("Не удалось удалить known_hosts: %v", err)
+		}
+		if err := connect(policy, ""); err != nil {
+			t.Fatalf("Ожидалось подключение в режиме %s: %v", policy, err)
+		}
+		if err := connect("strict", ""); err != nil {
+			t.Fatalf("Ожидалось подключение к записанному в режиме %s серверу в режиме strict: %v", policy, err)
+		}
+	}
+
+	// Закрепленный отпечаток заменяет known_hosts
+	cfg.KnownHosts = filepath.Join(t.TempDir(), "missing")
+	if err := connect("strict", fingerprint); err != nil {
+		t.Errorf("Ожидалось подключение по закрепленному отпечатку: %v", err)
+	}
+	if err := connect("strict", "SHA256:AAAA"); !errors.As(err, &hostKeyErr) || !hostKeyErr.Changed {
+		t.Errorf("Ожидалась ошибка несовпадения отпечатка, получено: %v", err)
+	}
+
+	// Другой ключ для известного сервера отклоняется во всех режимах
+	data, err := os.ReadFile(knownHostsPath)
+	if err != nil {
+		t.Fatalf("Не удалось прочитать known_hosts: %v", err)
+	}
+	_, _, key, _, _, err := ssh.ParseKnownHosts(data)
+	if err != nil {
+		t.Fatalf("Не удалось разобрать known_hosts: %v", err)
+	}
+	other, _ := newTestSSHConfig(t, "ssh", "")
+	otherAddr := knownhosts.Normalize(other.SSHHost + ":" + strconv.Itoa(other.SSHPort))
+	if err := os.WriteFile(knownHostsPath, []byte(knownhosts.Line([]string{otherAddr}, key)+"\n"), 0600); err != nil {
+		t.Fatalf("Не удалось записать known_hosts: %v", err)
+	}
+	cfg.SSHPort = other.SSHPort
+	cfg.KnownHosts = knownHostsPath
+	for _, policy := range []string{"accept-new", "tofu"} {
+		err := connect(policy, "")
+		if !errors.As(err, &hostKeyErr) || !hostKeyErr.Changed || hostKeyErr.Known != knownHostsPath+":1" {
+			t.Errorf("Ожидалась ошибка измененного ключа в режиме %s, получено: %v", policy, err)
+		}
+	}
+}
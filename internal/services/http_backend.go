@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"package-manager/internal/config"
+)
+
+// HTTPBackend читает пакеты с HTTP(S)-сервера (например, статической раздачи репозитория).
+// Запись, удаление и листинг не поддерживаются. Реализует интерфейс Backend
+type HTTPBackend struct {
+	baseURL         string
+	client          *http.Client
+	transferTimeout time.Duration
+}
+
+// NewHTTPBackend создает хранилище с корнем из URL репозитория
+func NewHTTPBackend(cfg *config.Config) *HTTPBackend {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: cfg.ConnectTimeout, KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = cfg.ConnectTimeout
+	return &HTTPBackend{
+		baseURL:         strings.TrimSuffix(cfg.Repository, "/"),
+		client:          &http.Client{Transport: transport},
+		transferTimeout: cfg.TransferTimeout,
+	}
+}
+
+// httpStatusError - ответ сервера с неожиданным кодом
+type httpStatusError struct {
+	name   string
+	code   int
+	status string
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("ошибка HTTP-запроса %s: %s", e.name, e.status)
+}
+
+func (b *HTTPBackend) url(name string) string {
+	return b.baseURL + "/" + cleanRemotePath(name)
+}
+
+// do выполняет запрос и переводит 404 в fs.ErrNotExist. Ненулевой offset запрашивает
+// данные с этого байта (заголовок Range)
+func (b *HTTPBackend) do(ctx context.Context, method, name string, offset int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, b.url(name), nil)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка HTTP-запроса %s: %w", name, err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %w", name, fs.ErrNotExist)
+	case resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent:
+		resp.Body.Close()
+		return nil, &httpStatusError{name: name, code: resp.StatusCode, status: resp.Status}
+	}
+	return resp, nil
+}
+
+// UploadFile не поддерживается
+func (b *HTTPBackend) UploadFile(ctx context.Context, fileName string, data io.Reader, size int64) error {
+	return ErrReadOnly
+}
+
+// DownloadFile скачивает файл GET-запросом
+func (b *HTTPBackend) DownloadFile(ctx context.Context, fileName string, w io.Writer) error {
+	return b.DownloadFileFrom(ctx, fileName, 0, w)
+}
+
+// DownloadFileFrom скачивает файл начиная с байта offset. Если сервер не поддерживает
+// запросы диапазона и присылает файл целиком, первые offset байт пропускаются
+func (b *HTTPBackend) DownloadFileFrom(ctx context.Context, fileName string, offset int64, w io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	timer := startIdleTimer(b.transferTimeout, cancel)
+
+	resp, err := b.do(ctx, http.MethodGet, fileName, offset)
+	if err != nil {
+		return timer.stop(err)
+	}
+	defer resp.Body.Close()
+
+	dst := timer.writer(w)
+	if offset > 0 && resp.StatusCode == http.StatusOK {
+		dst = &skipWriter{w: dst, skip: offset}
+	}
+	if _, err := io.Copy(dst, resp.Body); err != nil {
+		return fmt.Errorf("ошибка чтения ответа для %s: %w", fileName, timer.stop(err))
+	}
+	timer.stop(nil)
+	return nil
+}
+
+// List не поддерживается: HTTP не дает переносимого способа получить содержимое директории
+func (b *HTTPBackend) List(ctx context.Context, dir string) ([]FileInfo, error) {
+	return nil, fmt.Errorf("листинг не поддерживается HTTP-хранилищем")
+}
+
+// Stat получает размер и время изменения файла HEAD-запросом
+func (b *HTTPBackend) Stat(ctx context.Context, fileName string) (*FileInfo, error) {
+	resp, err := b.do(ctx, http.MethodHead, fileName, 0)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	info := &FileInfo{Name: path.Base(fileName), Size: resp.ContentLength}
+	if modTime, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.ModTime = modTime
+	}
+	return info, nil
+}
+
+// Delete не поддерживается
+func (b *HTTPBackend) Delete(ctx context.Context, fileName string) error {
+	return ErrReadOnly
+}
+
+// Rename не поддерживается
+func (b *HTTPBackend) Rename(ctx context.Context, oldName, newName string) error {
+	return ErrReadOnly
+}
+
+// Close ничего не делает
+func (b *HTTPBackend) Close() error {
+	return nil
+}
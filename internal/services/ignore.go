@@ -0,0 +1,158 @@
+package services
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// ignoreFileNames - файлы с правилами исключения в формате .gitignore
+var ignoreFileNames = []string{".gitignore", ".pmignore"}
+
+// ignoreRule - одно правило файла исключений
+type ignoreRule struct {
+	pattern string
+	negate  bool
+	dirOnly bool
+}
+
+// ignoreMatcher проверяет пути по файлам .gitignore и .pmignore в директориях цели.
+// Правила файла действуют на его директорию и вложенные в нее,
+// правила ближайшей к пути директории имеют приоритет
+type ignoreMatcher struct {
+	root  string
+	rules map[string][]ignoreRule
+}
+
+func newIgnoreMatcher(root string) *ignoreMatcher {
+	return &ignoreMatcher{root: filepath.Clean(root), rules: make(map[string][]ignoreRule)}
+}
+
+// ignored сообщает, исключен ли путь правилами или находится ли он в исключенной директории
+func (m *ignoreMatcher) ignored(filePath string, isDir bool) (bool, error) {
+	filePath = filepath.Clean(filePath)
+	rel, err := filepath.Rel(m.root, filePath)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false, nil
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for i := range parts {
+		current := filepath.Join(m.root, filepath.FromSlash(strings.Join(parts[:i+1], "/")))
+		ignored, err := m.matchSelf(current, isDir || i < len(parts)-1)
+		if err != nil || ignored {
+			return ignored, err
+		}
+	}
+	return false, nil
+}
+
+// matchSelf применяет правила директорий от родителя пути до корня цели.
+// Решает ближайший к пути файл исключений, в котором нашлось подходящее правило
+func (m *ignoreMatcher) matchSelf(filePath string, isDir bool) (bool, error) {
+	for dir := filepath.Dir(filePath); ; dir = filepath.Dir(dir) {
+		rules, err := m.load(dir)
+		if err != nil {
+			return false, err
+		}
+		rel, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return false, err
+		}
+		if matched, negate := matchIgnoreRules(rules, filepath.ToSlash(rel), isDir); matched {
+			return !negate, nil
+		}
+		if dir == m.root || dir == filepath.Dir(dir) {
+			return false, nil
+		}
+	}
+}
+
+// matchIgnoreRules возвращает результат последнего подходящего правила
+func matchIgnoreRules(rules []ignoreRule, rel string, isDir bool) (matched bool, negate bool) {
+	for _, rule := range rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if ok, _ := doublestar.Match(rule.pattern, rel); ok {
+			matched, negate = true, rule.negate
+		}
+	}
+	return matched, negate
+}
+
+// load читает и кэширует правила файлов исключений директории
+func (m *ignoreMatcher) load(dir string) ([]ignoreRule, error) {
+	if rules, ok := m.rules[dir]; ok {
+		return rules, nil
+	}
+	var rules []ignoreRule
+	for _, name := range ignoreFileNames {
+		fileRules, err := readIgnoreFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, fileRules...)
+	}
+	m.rules[dir] = rules
+	return rules, nil
+}
+
+// readIgnoreFile разбирает файл в формате .gitignore. Отсутствующий файл не является ошибкой
+func readIgnoreFile(filePath string) ([]ignoreRule, error) {
+	file, err := os.Open(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать %s: %w", filePath, err)
+	}
+	defer file.Close()
+
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var rule ignoreRule
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		line = strings.TrimPrefix(line, `\`)
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		// Шаблон без слеша действует на любой глубине, со слешем - от директории файла
+		if strings.Contains(line, "/") {
+			rule.pattern = strings.TrimPrefix(line, "/")
+		} else {
+			rule.pattern = "**/" + line
+		}
+		if !doublestar.ValidatePattern(rule.pattern) {
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("не удалось прочитать %s: %w", filePath, err)
+	}
+	return rules, nil
+}
+
+// isIgnoreFile сообщает, является ли путь файлом исключений pm, который не попадает в архив
+func isIgnoreFile(filePath string) bool {
+	return path.Base(filepath.ToSlash(filePath)) == ".pmignore"
+}
@@ -0,0 +1,326 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"package-manager/internal/models"
+	"package-manager/internal/semver"
+)
+
+// repositoryIndexFile - общий каталог пакетов в корне репозитория на сервере
+const repositoryIndexFile = "index.json"
+
+// ErrPackageNotFound возвращается, если у пакета нет индекса на сервере
+var ErrPackageNotFound = errors.New("пакет не найден")
+
+// ErrVersionExists возвращается при повторной публикации уже опубликованной версии
+var ErrVersionExists = errors.New("версия уже опубликована")
+
+// ErrConcurrentPublish возвращается, если запись в индексе раз за разом теряется из-за одновременной публикации
+var ErrConcurrentPublish = errors.New("индекс изменен одновременной публикацией")
+
+// publishAttempts - число попыток записать версию в индекс, если запись потеряна из-за одновременной публикации
+const publishAttempts = 3
+
+// checkPackageName проверяет, что имя пакета можно использовать как директорию в репозитории:
+// пустое имя указывало бы на общий каталог, а имена с разделителями или .. выходили бы за <name>/<ver>/
+func checkPackageName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("недопустимое имя пакета %q", name)
+	}
+	return nil
+}
+
+// archiveFileName формирует имя архива пакета с расширением по формату (пустой формат - zip)
+func archiveFileName(name, ver, format string) string {
+	return fmt.Sprintf("%s-%s.%s", name, ver, archiveExt(format))
+}
+
+// archivePath возвращает путь к архиву пакета в репозитории: <name>/<ver>/<name>-<ver>.<format>
+func archivePath(name, ver, format string) string {
+	return path.Join(name, ver, archiveFileName(name, ver, format))
+}
+
+// packageIndexPath возвращает путь к индексу пакета на сервере: <name>/index.json
+func packageIndexPath(name string) string {
+	return path.Join(name, "index.json")
+}
+
+// readRemoteJSON читает JSON-файл из хранилища. Возвращает false, если файла нет
+func (pm *PackageManager) readRemoteJSON(ctx context.Context, remotePath string, v any) (bool, error) {
+	if _, err := pm.backend.Stat(ctx, remotePath); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("ошибка проверки файла %s в хранилище: %w", remotePath, err)
+	}
+
+	var buf bytes.Buffer
+	if err := pm.backend.DownloadFile(ctx, remotePath, &buf); err != nil {
+		return false, fmt.Errorf("ошибка скачивания %s: %w", remotePath, err)
+	}
+	if err := json.Unmarshal(buf.Bytes(), v); err != nil {
+		return false, fmt.Errorf("ошибка разбора %s: %w", remotePath, err)
+	}
+	return true, nil
+}
+
+// uploadAtomic загружает файл под временным именем и переименовывает его на место,
+// чтобы читатели никогда не видели частично записанный файл
+func (pm *PackageManager) uploadAtomic(ctx context.Context, remotePath string, data io.Reader, size int64) error {
+	tmpPath := path.Join(path.Dir(remotePath), fmt.Sprintf(".%s.tmp-%d", path.Base(remotePath), time.Now().UnixNano()))
+	if err := pm.backend.UploadFile(ctx, tmpPath, data, size); err != nil {
+		pm.removeRemote(ctx, tmpPath)
+		return err
+	}
+	if err := pm.backend.Rename(ctx, tmpPath, remotePath); err != nil {
+		pm.removeRemote(ctx, tmpPath)
+		return fmt.Errorf("ошибка переименования %s в %s: %w", tmpPath, remotePath, err)
+	}
+	return nil
+}
+
+// removeRemote удаляет файл незавершенной публикации. Удаление выполняется и после отмены ctx,
+// отсутствующий файл не считается ошибкой
+func (pm *PackageManager) removeRemote(ctx context.Context, remotePath string) {
+	ctx, cancel := cleanupContext(ctx)
+	defer cancel()
+	if err := pm.backend.Delete(ctx, remotePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("Не удалось удалить %s из хранилища: %v", remotePath, err)
+	}
+}
+
+// writeRemoteJSON атомарно записывает JSON-файл в хранилище
+func (pm *PackageManager) writeRemoteJSON(ctx context.Context, remotePath string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("ошибка формирования %s: %w", remotePath, err)
+	}
+	return pm.uploadAtomic(ctx, remotePath, bytes.NewReader(data), int64(len(data)))
+}
+
+// readPackageIndex читает индекс пакета с сервера
+func (pm *PackageManager) readPackageIndex(ctx context.Context, name string) (*models.PackageIndex, error) {
+	if err := checkPackageName(name); err != nil {
+		return nil, err
+	}
+	var index models.PackageIndex
+	found, err := pm.readRemoteJSON(ctx, packageIndexPath(name), &index)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: %s", ErrPackageNotFound, name)
+	}
+	return &index, nil
+}
+
+// readRepositoryIndex читает общий каталог пакетов. Отсутствующий каталог считается пустым
+func (pm *PackageManager) readRepositoryIndex(ctx context.Context) (*models.RepositoryIndex, error) {
+	var index models.RepositoryIndex
+	if _, err := pm.readRemoteJSON(ctx, repositoryIndexFile, &index); err != nil {
+		return nil, err
+	}
+	return &index, nil
+}
+
+// checkVersionUnpublished проверяет, что версия пакета еще не опубликована
+func (pm *PackageManager) checkVersionUnpublished(ctx context.Context, name, ver string) error {
+	index, err := pm.readPackageIndex(ctx, name)
+	if errors.Is(err, ErrPackageNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	version, err := semver.Parse(ver)
+	if err != nil {
+		return fmt.Errorf("некорректная версия пакета %s: %w", name, err)
+	}
+	if indexEntry(index, version) != nil {
+		return fmt.Errorf("%w: %s %s", ErrVersionExists, name, ver)
+	}
+	return nil
+}
+
+// publishToIndex добавляет версию в индекс пакета и обновляет общий каталог.
+// Публикация рассчитана на одного писателя: блокировок в хранилище нет. Чтобы одновременная публикация
+// не теряла версии молча, после записи индекс перечитывается, и потерянная запись добавляется заново
+func (pm *PackageManager) publishToIndex(ctx context.Context, name string, entry models.IndexEntry) error {
+	version, err := semver.Parse(entry.Ver)
+	if err != nil {
+		return fmt.Errorf("некорректная версия пакета %s: %w", name, err)
+	}
+	var index *models.PackageIndex
+	err = retryLostUpdate(func() error {
+		var err error
+		index, err = pm.readPackageIndex(ctx, name)
+		if errors.Is(err, ErrPackageNotFound) {
+			index, err = &models.PackageIndex{Name: name}, nil
+		}
+		if err != nil {
+			return err
+		}
+		if indexEntry(index, version) != nil {
+			return fmt.Errorf("%w: %s %s", ErrVersionExists, name, entry.Ver)
+		}
+		index.Versions = append(index.Versions, entry)
+		sortIndexVersions(index)
+		if err := pm.writeRemoteJSON(ctx, packageIndexPath(name), index); err != nil {
+			return fmt.Errorf("ошибка обновления индекса пакета %s: %w", name, err)
+		}
+		return nil
+	}, func() (bool, error) {
+		written, err := pm.readPackageIndex(ctx, name)
+		if errors.Is(err, ErrPackageNotFound) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		found := indexEntry(written, version)
+		return found != nil && found.Checksum == entry.Checksum, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	latest := latestVersion(index)
+	return retryLostUpdate(func() error {
+		repo, err := pm.readRepositoryIndex(ctx)
+		if err != nil {
+			return err
+		}
+		updated := false
+		for i := range repo.Packages {
+			if repo.Packages[i].Name == name {
+				repo.Packages[i].Latest = latest
+				updated = true
+			}
+		}
+		if !updated {
+			repo.Packages = append(repo.Packages, models.IndexedPackage{Name: name, Latest: latest})
+			sort.Slice(repo.Packages, func(i, j int) bool { return repo.Packages[i].Name < repo.Packages[j].Name })
+		}
+		if err := pm.writeRemoteJSON(ctx, repositoryIndexFile, repo); err != nil {
+			return fmt.Errorf("ошибка обновления каталога пакетов: %w", err)
+		}
+		return nil
+	}, func() (bool, error) {
+		repo, err := pm.readRepositoryIndex(ctx)
+		if err != nil {
+			return false, err
+		}
+		return slices.ContainsFunc(repo.Packages, func(pkg models.IndexedPackage) bool { return pkg.Name == name }), nil
+	})
+}
+
+// retryLostUpdate выполняет update и проверяет повторным чтением (published), что записанное сохранилось.
+// Запись, перезаписанная одновременной публикацией, повторяется не более publishAttempts раз
+func retryLostUpdate(update func() error, published func() (bool, error)) error {
+	for attempt := 1; ; attempt++ {
+		if err := update(); err != nil {
+			return err
+		}
+		ok, err := published()
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		if attempt == publishAttempts {
+			return ErrConcurrentPublish
+		}
+		log.Printf("Индекс изменен одновременной публикацией, запись повторяется (попытка %d из %d).", attempt+1, publishAttempts)
+	}
+}
+
+// sortIndexVersions упорядочивает версии индекса по возрастанию. Записи с некорректной версией
+// не сравниваются: они остаются в конце индекса в прежнем порядке, чтобы не потерять чужие данные
+func sortIndexVersions(index *models.PackageIndex) {
+	type parsedEntry struct {
+		entry   models.IndexEntry
+		version semver.Version
+	}
+	var valid []parsedEntry
+	var invalid []models.IndexEntry
+	for _, entry := range index.Versions {
+		v, err := semver.Parse(entry.Ver)
+		if err != nil {
+			log.Printf("Некорректная версия %q в индексе пакета %s пропущена при сортировке: %v", entry.Ver, index.Name, err)
+			invalid = append(invalid, entry)
+			continue
+		}
+		valid = append(valid, parsedEntry{entry: entry, version: v})
+	}
+	slices.SortStableFunc(valid, func(a, b parsedEntry) int {
+		return a.version.Compare(b.version)
+	})
+	index.Versions = index.Versions[:0]
+	for _, p := range valid {
+		index.Versions = append(index.Versions, p.entry)
+	}
+	index.Versions = append(index.Versions, invalid...)
+}
+
+// indexEntry ищет версию в индексе пакета
+func indexEntry(index *models.PackageIndex, version semver.Version) *models.IndexEntry {
+	for i := range index.Versions {
+		v, err := semver.Parse(index.Versions[i].Ver)
+		if err == nil && v.Equal(version) {
+			return &index.Versions[i]
+		}
+	}
+	return nil
+}
+
+// latestVersion возвращает последнюю стабильную версию из индекса (или последнюю prerelease, если стабильных нет)
+func latestVersion(index *models.PackageIndex) string {
+	var versions []semver.Version
+	for _, entry := range index.Versions {
+		if v, err := semver.Parse(entry.Ver); err == nil {
+			versions = append(versions, v)
+		}
+	}
+	if best, ok := semver.MustParseConstraint("").Best(versions); ok {
+		return best.Original()
+	}
+	if len(versions) > 0 {
+		return index.Versions[len(index.Versions)-1].Ver
+	}
+	return ""
+}
+
+// SearchPackages ищет пакеты в каталоге по подстроке в имени
+func (pm *PackageManager) SearchPackages(ctx context.Context, query string) ([]models.IndexedPackage, error) {
+	repo, err := pm.readRepositoryIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	query = strings.ToLower(query)
+	var found []models.IndexedPackage
+	for _, pkg := range repo.Packages {
+		if strings.Contains(strings.ToLower(pkg.Name), query) {
+			found = append(found, pkg)
+		}
+	}
+	return found, nil
+}
+
+// PackageInfo возвращает индекс пакета со всеми опубликованными версиями
+func (pm *PackageManager) PackageInfo(ctx context.Context, name string) (*models.PackageIndex, error) {
+	return pm.readPackageIndex(ctx, name)
+}
@@ -0,0 +1,229 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"package-manager/internal/models"
+)
+
+const (
+	// stateDirName - директория с состоянием pm в корне установки
+	stateDirName = ".pm"
+	// installedFileName - база установленных пакетов в директории состояния
+	installedFileName = "installed.json"
+)
+
+// installedDBPath возвращает путь к базе установленных пакетов для корня установки
+func installedDBPath(root string) string {
+	return filepath.Join(root, stateDirName, installedFileName)
+}
+
+// installRoot возвращает корень установки для --prefix
+func installRoot(prefix string) string {
+	if prefix == "" {
+		return "."
+	}
+	return filepath.Clean(prefix)
+}
+
+// installedBase возвращает директорию, относительно которой записаны файлы пакета
+func installedBase(root string, pkg *models.InstalledPackage) string {
+	if pkg.Dest != "" {
+		return pkg.Dest
+	}
+	return root
+}
+
+// readInstalledDB читает базу установленных пакетов. Отсутствующая база считается пустой
+func readInstalledDB(root string) (*models.InstalledDB, error) {
+	dbPath := installedDBPath(root)
+	data, err := os.ReadFile(dbPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &models.InstalledDB{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения базы установленных пакетов: %w", err)
+	}
+	var db models.InstalledDB
+	if err := json.Unmarshal(data, &db); err != nil {
+		return nil, fmt.Errorf("ошибка парсинга базы установленных пакетов %s: %w", dbPath, err)
+	}
+	return &db, nil
+}
+
+// writeInstalledDB записывает базу установленных пакетов через временный файл
+func writeInstalledDB(root string, db *models.InstalledDB) error {
+	sort.Slice(db.Packages, func(i, j int) bool { return db.Packages[i].Name < db.Packages[j].Name })
+	data, err := json.MarshalIndent(db, "", "  ")
+	if err != nil {
+		return fmt.Errorf("ошибка формирования базы установленных пакетов: %w", err)
+	}
+	dbPath := installedDBPath(root)
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		return fmt.Errorf("ошибка записи базы установленных пакетов: %w", err)
+	}
+	tmpPath := dbPath + ".tmp"
+	if err := os.WriteFile(tmpPath, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("ошибка записи базы установленных пакетов: %w", err)
+	}
+	if err := os.Rename(tmpPath, dbPath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("ошибка записи базы установленных пакетов: %w", err)
+	}
+	return nil
+}
+
+// findInstalled возвращает индекс пакета в базе или -1
+func findInstalled(db *models.InstalledDB, name string) int {
+	for i, pkg := range db.Packages {
+		if pkg.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// ownedByOthers возвращает пути, принадлежащие пакетам, кроме name, установленным в ту же директорию dest
+func ownedByOthers(db *models.InstalledDB, name, dest string) map[string]bool {
+	owned := make(map[string]bool)
+	for _, pkg := range db.Packages {
+		if pkg.Name == name || pkg.Dest != dest {
+			continue
+		}
+		for _, file := range pkg.Files {
+			owned[file] = true
+		}
+	}
+	return owned
+}
+
+// ListInstalled возвращает пакеты, установленные в корень установки prefix
+func ListInstalled(prefix string) ([]models.InstalledPackage, error) {
+	db, err := readInstalledDB(installRoot(prefix))
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(db.Packages, func(i, j int) bool { return db.Packages[i].Name < db.Packages[j].Name })
+	return db.Packages, nil
+}
+
+// RemovePackage удаляет файлы установленного пакета и ставшие пустыми директории.
+// Файлы, которые принадлежат и другим пакетам, остаются на месте
+func RemovePackage(prefix, name string) error {
+	root := installRoot(prefix)
+	db, err := readInstalledDB(root)
+	if err != nil {
+		return err
+	}
+	i := findInstalled(db, name)
+	if i < 0 {
+		return fmt.Errorf("пакет %s не установлен", name)
+	}
+	pkg := db.Packages[i]
+
+	var dependents []string
+	for _, other := range db.Packages {
+		for _, dep := range other.Dependencies {
+			if dep == name {
+				dependents = append(dependents, other.Name)
+			}
+		}
+	}
+	if len(dependents) > 0 {
+		log.Printf("Пакет %s нужен пакетам: %s", name, strings.Join(dependents, ", "))
+	}
+
+	owned := ownedByOthers(db, name, pkg.Dest)
+	var files []string
+	for _, file := range pkg.Files {
+		if owned[file] {
+			log.Printf("Файл %s принадлежит и другому пакету, оставлен", file)
+			continue
+		}
+		files = append(files, file)
+	}
+	log.Printf("Удаление пакета %s версии %s...", pkg.Name, pkg.Ver)
+	base := installedBase(root, &pkg)
+	removeInstalledFiles(base, files)
+
+	db.Packages = append(db.Packages[:i], db.Packages[i+1:]...)
+	if err := writeInstalledDB(root, db); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(backupPath(base, name)); err != nil {
+		log.Printf("Не удалось удалить копию предыдущей версии пакета %s: %v", name, err)
+	}
+	log.Printf("Пакет %s удален.", name)
+	return nil
+}
+
+// removeInstalledFiles удаляет файлы внутри корня установки (или dest пакета), затем ставшие пустыми директории.
+// Ошибки отдельных файлов записываются в лог
+func removeInstalledFiles(root string, files []string) {
+	r, err := os.OpenRoot(root)
+	if err != nil {
+		log.Printf("Не удалось открыть корень установки %s: %v", root, err)
+		return
+	}
+	defer r.Close()
+
+	for _, file := range files {
+		if strings.HasSuffix(file, "/") {
+			continue
+		}
+		if err := r.Remove(file); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Не удалось удалить %s: %v", file, err)
+		}
+	}
+	removeEmptyDirs(r, files)
+}
+
+// removeEmptyDirs удаляет ставшие пустыми директории из списка файлов пакета
+// и родительские директории файлов
+func removeEmptyDirs(r *os.Root, files []string) {
+	dirs := make(map[string]bool)
+	for _, file := range files {
+		name := strings.TrimSuffix(file, "/")
+		if name != file {
+			dirs[name] = true
+		}
+		for dir := path.Dir(name); dir != "." && dir != "/"; dir = path.Dir(dir) {
+			dirs[dir] = true
+		}
+	}
+
+	// Вложенные директории удаляются раньше родительских; непустые остаются
+	sorted := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		if dir != stateDirName {
+			sorted = append(sorted, dir)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] > sorted[j] })
+	for _, dir := range sorted {
+		if entries, err := readDirInRoot(r, dir); err == nil && len(entries) == 0 {
+			if err := r.Remove(dir); err != nil {
+				log.Printf("Не удалось удалить директорию %s: %v", dir, err)
+			}
+		}
+	}
+}
+
+// readDirInRoot читает содержимое директории внутри root
+func readDirInRoot(r *os.Root, dir string) ([]fs.DirEntry, error) {
+	f, err := r.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.ReadDir(-1)
+}
@@ -1,11 +1,36 @@
 package services
 
 import (
-	"bytes"
+	"context"
+	"errors"
+	"io"
+	"time"
 )
 
-// SSHClientInterface определяет контракт для работы с SSH-клиентом для тестов
-type SSHClientInterface interface {
-	UploadFile(fileName string, data *bytes.Buffer) error
-	DownloadFile(fileName string) (*bytes.Buffer, error)
+// ErrReadOnly возвращается хранилищами, которые не поддерживают запись (например, HTTP)
+var ErrReadOnly = errors.New("хранилище доступно только для чтения")
+
+// FileInfo описывает файл или директорию в хранилище пакетов
+type FileInfo struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+	IsDir   bool
+}
+
+// Backend определяет контракт хранилища пакетов (SSH, локальная директория, HTTP).
+// Пути задаются относительно корня репозитория через "/".
+// Данные передаются потоком, без буферизации файла целиком в памяти.
+// Отсутствующие файлы сообщаются ошибкой, совместимой с errors.Is(err, fs.ErrNotExist).
+// Отмена ctx прерывает операцию, в том числе передачу данных
+type Backend interface {
+	// UploadFile записывает size байт из data в файл хранилища
+	UploadFile(ctx context.Context, fileName string, data io.Reader, size int64) error
+	// DownloadFile записывает содержимое файла хранилища в w
+	DownloadFile(ctx context.Context, fileName string, w io.Writer) error
+	List(ctx context.Context, dir string) ([]FileInfo, error)
+	Stat(ctx context.Context, fileName string) (*FileInfo, error)
+	Delete(ctx context.Context, fileName string) error
+	Rename(ctx context.Context, oldName, newName string) error
+	Close() error
 }
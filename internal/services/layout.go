@@ -0,0 +1,134 @@
+package services
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"package-manager/internal/models"
+)
+
+// installTarget задает, куда и какую часть архива пакета устанавливать
+type installTarget struct {
+	dir string
+	// outside - абсолютный dest вне корня установки: файлы пакета переносятся в dir
+	// и записываются в базу относительно dir
+	outside bool
+	// subdir - директория установки относительно корня установки со слешами ("." для корня)
+	subdir      string
+	stripPrefix string
+	paths       []string
+}
+
+// installLayout хранит директории установки и фильтры путей из файла пакетов.
+// Транзитивные зависимости устанавливаются в корень установки целиком
+type installLayout struct {
+	root    string
+	targets map[string]installTarget
+}
+
+// newInstallLayout читает настройки установки пакетов. prefix задает корень установки:
+// к нему добавляются и относительные, и абсолютные dest. Без prefix абсолютный dest используется как есть
+func newInstallLayout(packages []models.Package, prefix string) (*installLayout, error) {
+	root := installRoot(prefix)
+	layout := &installLayout{root: root, targets: make(map[string]installTarget)}
+
+	for _, pkg := range packages {
+		target := installTarget{dir: root, subdir: "."}
+		if pkg.Dest != "" && prefix == "" && filepath.IsAbs(pkg.Dest) {
+			target.dir = filepath.Clean(pkg.Dest)
+			target.outside = true
+		} else if pkg.Dest != "" {
+			target.dir = filepath.Join(root, pkg.Dest)
+			target.subdir = path.Clean("./" + filepath.ToSlash(pkg.Dest))
+			if target.subdir == ".." || strings.HasPrefix(target.subdir, "../") {
+				return nil, fmt.Errorf("пакет %s: dest %q выходит за корень установки", pkg.Name, pkg.Dest)
+			}
+		}
+		if pkg.StripPrefix != "" {
+			prefix, err := cleanLayoutPath(pkg.StripPrefix)
+			if err != nil {
+				return nil, fmt.Errorf("пакет %s: strip_prefix: %w", pkg.Name, err)
+			}
+			target.stripPrefix = prefix
+		}
+		for _, p := range pkg.Paths {
+			cleaned, err := cleanLayoutPath(p)
+			if err != nil {
+				return nil, fmt.Errorf("пакет %s: paths: %w", pkg.Name, err)
+			}
+			if _, err := path.Match(cleaned, ""); err != nil {
+				return nil, fmt.Errorf("пакет %s: некорректный шаблон %q: %w", pkg.Name, p, err)
+			}
+			target.paths = append(target.paths, cleaned)
+		}
+		layout.targets[pkg.Name] = target
+	}
+	return layout, nil
+}
+
+// cleanLayoutPath проверяет путь внутри архива из файла пакетов
+func cleanLayoutPath(p string) (string, error) {
+	cleaned := path.Clean(strings.Trim(filepath.ToSlash(p), "/"))
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("недопустимый путь %q", p)
+	}
+	return cleaned, nil
+}
+
+// forPackage возвращает настройки установки пакета
+func (l *installLayout) forPackage(name string) installTarget {
+	if target, ok := l.targets[name]; ok {
+		return target
+	}
+	return installTarget{dir: l.root, subdir: "."}
+}
+
+// base возвращает директорию, относительно которой файлы пакета записываются в базу: корень установки
+// или dest вне его
+func (t installTarget) base(root string) string {
+	if t.outside {
+		return t.dir
+	}
+	return root
+}
+
+// rootPaths переводит пути, распакованные в директорию установки, в пути относительно корня установки
+func (t installTarget) rootPaths(names []string) []string {
+	paths := make([]string, len(names))
+	for i, name := range names {
+		paths[i] = path.Join(t.subdir, name)
+		if strings.HasSuffix(name, "/") {
+			paths[i] += "/"
+		}
+	}
+	return paths
+}
+
+// mapEntry переводит путь записи архива в путь внутри директории установки.
+// Для записей, которые не нужно устанавливать, возвращается false
+func (t installTarget) mapEntry(name string) (string, bool) {
+	if t.stripPrefix != "" {
+		if name == t.stripPrefix {
+			return ".", true
+		}
+		rest, ok := strings.CutPrefix(name, t.stripPrefix+"/")
+		if !ok {
+			return "", false
+		}
+		name = rest
+	}
+	if len(t.paths) == 0 || name == "." {
+		return name, true
+	}
+	// Путь устанавливается, если он сам или одна из его директорий указаны в paths
+	for dir := name; dir != "."; dir = path.Dir(dir) {
+		for _, p := range t.paths {
+			if ok, _ := path.Match(p, dir); ok {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// LocalBackend хранит пакеты в локальной директории (URL вида file:///srv/pm-repo).
+// Реализует интерфейс Backend
+type LocalBackend struct {
+	root string
+}
+
+// NewLocalBackend создает хранилище в директории root
+func NewLocalBackend(root string) *LocalBackend {
+	return &LocalBackend{root: root}
+}
+
+// path переводит путь внутри репозитория в путь в файловой системе
+func (b *LocalBackend) path(name string) string {
+	return filepath.Join(b.root, filepath.FromSlash(cleanRemotePath(name)))
+}
+
+// UploadFile записывает файл в хранилище, создавая директории при необходимости.
+// Частично записанный файл удаляется
+func (b *LocalBackend) UploadFile(ctx context.Context, fileName string, data io.Reader, size int64) error {
+	target := b.path(fileName)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("ошибка создания директории для %s: %w", fileName, err)
+	}
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("ошибка создания файла %s: %w", fileName, err)
+	}
+	if _, err := io.CopyN(f, &contextReader{ctx: ctx, r: data}, size); err != nil {
+		f.Close()
+		os.Remove(target)
+		return fmt.Errorf("ошибка записи файла %s: %w", fileName, err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(target)
+		return fmt.Errorf("ошибка записи файла %s: %w", fileName, err)
+	}
+	return nil
+}
+
+// DownloadFile копирует файл из хранилища в w
+func (b *LocalBackend) DownloadFile(ctx context.Context, fileName string, w io.Writer) error {
+	f, err := os.Open(b.path(fileName))
+	if err != nil {
+		return fmt.Errorf("ошибка чтения файла %s: %w", fileName, err)
+	}
+	defer f.Close()
+	if _, err := io.Copy(w, &contextReader{ctx: ctx, r: f}); err != nil {
+		return fmt.Errorf("ошибка чтения файла %s: %w", fileName, err)
+	}
+	return nil
+}
+
+// List возвращает содержимое директории хранилища
+func (b *LocalBackend) List(ctx context.Context, dir string) ([]FileInfo, error) {
+	entries, err := os.ReadDir(b.path(dir))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения директории %s: %w", dir, err)
+	}
+	files := make([]FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("ошибка получения информации о %s: %w", entry.Name(), err)
+		}
+		files = append(files, fileInfoFromOS(info))
+	}
+	return files, nil
+}
+
+// Stat возвращает информацию о файле в хранилище
+func (b *LocalBackend) Stat(ctx context.Context, fileName string) (*FileInfo, error) {
+	info, err := os.Stat(b.path(fileName))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения информации о %s: %w", fileName, err)
+	}
+	fi := fileInfoFromOS(info)
+	return &fi, nil
+}
+
+// Delete удаляет файл из хранилища
+func (b *LocalBackend) Delete(ctx context.Context, fileName string) error {
+	if err := os.Remove(b.path(fileName)); err != nil {
+		return fmt.Errorf("ошибка удаления %s: %w", fileName, err)
+	}
+	return nil
+}
+
+// Rename атомарно переименовывает файл в хранилище
+func (b *LocalBackend) Rename(ctx context.Context, oldName, newName string) error {
+	target := b.path(newName)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("ошибка создания директории для %s: %w", newName, err)
+	}
+	if err := os.Rename(b.path(oldName), target); err != nil {
+		return fmt.Errorf("ошибка переименования %s: %w", oldName, err)
+	}
+	return nil
+}
+
+// Close ничего не делает: локальное хранилище не держит ресурсов
+func (b *LocalBackend) Close() error {
+	return nil
+}
+
+// contextReader прерывает чтение после отмены ctx
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+func fileInfoFromOS(info os.FileInfo) FileInfo {
+	return FileInfo{Name: info.Name(), Size: info.Size(), ModTime: info.ModTime(), IsDir: info.IsDir()}
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"package-manager/internal/models"
+)
+
+// lockFileName - имя lock-файла, создаваемого рядом с файлом пакетов
+const lockFileName = "packages.lock"
+
+// lockFilePath возвращает путь к lock-файлу для файла пакетов
+func lockFilePath(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), lockFileName)
+}
+
+// readLockFile читает lock-файл в формате файла пакетов
+func readLockFile(path, format string) (*models.LockFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения lock-файла: %w", err)
+	}
+	var lock models.LockFile
+	if err := decodeConfig(data, format, &lock); err != nil {
+		return nil, fmt.Errorf("ошибка парсинга lock-файла %s: %w", path, err)
+	}
+	return &lock, nil
+}
+
+// writeLockFile записывает lock-файл через временный файл, чтобы не оставить его частично записанным
+func writeLockFile(path, format string, lock *models.LockFile) error {
+	data, err := encodeConfig(format, lock)
+	if err != nil {
+		return fmt.Errorf("ошибка формирования lock-файла: %w", err)
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("ошибка записи lock-файла: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("ошибка записи lock-файла: %w", err)
+	}
+	return nil
+}
+
+// checkLockDrift проверяет, что требования в файле пакетов не изменились после создания lock-файла
+func checkLockDrift(current, locked []models.Package) error {
+	want, got := requirementSet(locked), requirementSet(current)
+
+	var changed []string
+	for name, ver := range got {
+		if lockedVer, ok := want[name]; !ok {
+			changed = append(changed, fmt.Sprintf("добавлен %s", name))
+		} else if lockedVer != ver {
+			changed = append(changed, fmt.Sprintf("%s: %q вместо %q", name, ver, lockedVer))
+		}
+	}
+	for name := range want {
+		if _, ok := got[name]; !ok {
+			changed = append(changed, fmt.Sprintf("удален %s", name))
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	sort.Strings(changed)
+	return fmt.Errorf("файл пакетов изменился после создания lock-файла (%s), выполните pm update без --locked",
+		strings.Join(changed, "; "))
+}
+
+// requirementSet приводит требования к виду "имя -> ограничения" для сравнения без учета порядка
+func requirementSet(packages []models.Package) map[string]string {
+	set := make(map[string][]string)
+	for _, pkg := range packages {
+		set[pkg.Name] = append(set[pkg.Name], strings.TrimSpace(pkg.Ver))
+	}
+	result := make(map[string]string, len(set))
+	for name, vers := range set {
+		sort.Strings(vers)
+		result[name] = strings.Join(vers, ", ")
+	}
+	return result
+}
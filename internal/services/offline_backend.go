@@ -0,0 +1,44 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrOffline возвращается при обращении к хранилищу в автономном режиме
+var ErrOffline = errors.New("автономный режим: обращение к хранилищу запрещено")
+
+// OfflineBackend - хранилище для автономного режима (PM_OFFLINE, --offline).
+// Любое обращение завершается ошибкой ErrOffline, архивы берутся только из локального кэша.
+// Реализует интерфейс Backend
+type OfflineBackend struct{}
+
+func (OfflineBackend) UploadFile(ctx context.Context, fileName string, data io.Reader, size int64) error {
+	return fmt.Errorf("%w (%s)", ErrOffline, fileName)
+}
+
+func (OfflineBackend) DownloadFile(ctx context.Context, fileName string, w io.Writer) error {
+	return fmt.Errorf("%w (%s)", ErrOffline, fileName)
+}
+
+func (OfflineBackend) List(ctx context.Context, dir string) ([]FileInfo, error) {
+	return nil, fmt.Errorf("%w (%s)", ErrOffline, dir)
+}
+
+func (OfflineBackend) Stat(ctx context.Context, fileName string) (*FileInfo, error) {
+	return nil, fmt.Errorf("%w (%s)", ErrOffline, fileName)
+}
+
+func (OfflineBackend) Delete(ctx context.Context, fileName string) error {
+	return fmt.Errorf("%w (%s)", ErrOffline, fileName)
+}
+
+func (OfflineBackend) Rename(ctx context.Context, oldName, newName string) error {
+	return fmt.Errorf("%w (%s)", ErrOffline, oldName)
+}
+
+func (OfflineBackend) Close() error {
+	return nil
+}
@@ -1,40 +1,52 @@
 package services
 
 import (
-	"archive/zip"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
+	"golang.org/x/crypto/ssh"
 	"gopkg.in/yaml.v3"
 	"package-manager/internal/config"
 	"package-manager/internal/models"
+	"package-manager/internal/resolver"
+	"package-manager/internal/semver"
+	"package-manager/internal/signing"
 )
 
 // PackageManager (далее PM) содержит логику для создания и обновления пакетов
 type PackageManager struct {
-	config    *config.Config
-	sshClient SSHClientInterface
+	config        *config.Config
+	backend       Backend
+	cache         *archiveCache
+	extractLimits extractLimits
 }
 
-// NewPackageManager создает новый экземпляр PM с SSH-клиентом
-func NewPackageManager(cfg *config.Config, sshClient SSHClientInterface) *PackageManager {
-	return &PackageManager{config: cfg, sshClient: sshClient}
+// NewPackageManager создает новый экземпляр PM поверх хранилища пакетов.
+// Операции с хранилищем повторяются при временных ошибках сети (cfg.Retries)
+func NewPackageManager(cfg *config.Config, backend Backend) *PackageManager {
+	return &PackageManager{config: cfg, backend: withRetries(backend, cfg), cache: newArchiveCache(cfg), extractLimits: defaultExtractLimits()}
 }
 
 // ReadConfig читает и парсит файл конфигурации
 func (pm *PackageManager) ReadConfig(path string, cfg any) error {
-	ext := filepath.Ext(path)
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return fmt.Errorf("ошибка чтения файла: %w", err)
 	}
+	return decodeConfig(data, filepath.Ext(path), cfg)
+}
 
+// decodeConfig разбирает данные в формате, заданном расширением файла (.json, .yaml, .yml)
+func decodeConfig(data []byte, ext string, cfg any) error {
 	switch strings.ToLower(ext) {
 	case ".json":
 		return json.Unmarshal(data, cfg)
@@ -45,230 +57,322 @@ func (pm *PackageManager) ReadConfig(path string, cfg any) error {
 	}
 }
 
-// CreatePackage упаковывает файлы и загружает их на сервер
-func (pm *PackageManager) CreatePackage(configPath string) error {
+// encodeConfig сериализует данные в формате, заданном расширением файла
+func encodeConfig(ext string, cfg any) ([]byte, error) {
+	switch strings.ToLower(ext) {
+	case ".json":
+		data, err := json.MarshalIndent(cfg, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	case ".yaml", ".yml":
+		return yaml.Marshal(cfg)
+	default:
+		return nil, fmt.Errorf("неподдерживаемый формат файла: %s", ext)
+	}
+}
+
+// CreateOptions задает режим работы CreatePackage
+type CreateOptions struct {
+	// Sign подписывает архив ключом из конфигурации, подпись публикуется в индексе пакета
+	Sign bool
+}
+
+// CreatePackage упаковывает файлы и загружает их на сервер.
+// При отмене ctx временные файлы в хранилище удаляются, а архив без записи в индексе не остается
+func (pm *PackageManager) CreatePackage(ctx context.Context, configPath string, opts CreateOptions) error {
 	var cfg models.CreateConfig
 	if err := pm.ReadConfig(configPath, &cfg); err != nil {
 		return fmt.Errorf("ошибка парсинга файла %s: %w", configPath, err)
 	}
 
-	log.Printf("Создание пакета %s версии %s...", cfg.Name, cfg.Ver)
+	if err := checkPackageName(cfg.Name); err != nil {
+		return err
+	}
+	if _, err := semver.Parse(cfg.Ver); err != nil {
+		return fmt.Errorf("некорректная версия пакета %s: %w", cfg.Name, err)
+	}
+	for _, dep := range cfg.Packets {
+		if err := checkPackageName(dep.Name); err != nil {
+			return fmt.Errorf("зависимость пакета %s: %w", cfg.Name, err)
+		}
+		if _, err := semver.ParseConstraint(dep.Ver); err != nil {
+			return fmt.Errorf("зависимость %s пакета %s: %w", dep.Name, cfg.Name, err)
+		}
+	}
+	format, err := checkArchiveFormat(cfg.Format)
+	if err != nil {
+		return fmt.Errorf("пакет %s: %w", cfg.Name, err)
+	}
 
-	// Создаем временный ZIP-архив в памяти
-	buf := new(bytes.Buffer)
-	zipWriter := zip.NewWriter(buf)
+	if err := pm.checkVersionUnpublished(ctx, cfg.Name, cfg.Ver); err != nil {
+		return err
+	}
 
-	for _, target := range cfg.Targets {
-		matches, err := filepath.Glob(target.Path)
-		if err != nil {
-			log.Printf("Ошибка при поиске файлов по маске %s: %v", target.Path, err)
-			continue
+	// Ключ читается до упаковки, чтобы не собирать архив впустую
+	var signer ssh.Signer
+	if opts.Sign {
+		if signer, err = pm.loadSigner(); err != nil {
+			return err
 		}
+	}
 
-		for _, match := range matches {
-			info, err := os.Stat(match)
-			if err != nil {
-				log.Printf("Не удалось получить информацию о файле %s: %v", match, err)
-				continue
-			}
+	log.Printf("Создание пакета %s версии %s...", cfg.Name, cfg.Ver)
 
-			if info.IsDir() {
-				// Рекурсивное добавление содержимого директории
-				if err := pm.addDirToArchive(zipWriter, match, target.Exclude); err != nil {
-					log.Printf("Не удалось добавить директорию %s в архив: %v", match, err)
-				}
-			} else {
-				// Добавление одиночного файла
-				if err := pm.addFileToArchive(zipWriter, match, target.Exclude); err != nil {
-					log.Printf("Не удалось добавить файл %s в архив: %v", match, err)
-				}
-			}
+	// Архив собирается во временном файле: размер пакета не ограничен объемом памяти
+	spool, err := newSpoolFile()
+	if err != nil {
+		return err
+	}
+	defer spool.Close()
+	builder, err := newArchiveBuilder(ctx, spool, format)
+	if err != nil {
+		return err
+	}
+	for _, target := range cfg.Targets {
+		if err := builder.addTarget(target); err != nil {
+			return err
 		}
 	}
 
-	if err := zipWriter.Close(); err != nil {
+	if err := builder.Close(); err != nil {
 		return fmt.Errorf("ошибка закрытия архива: %w", err)
 	}
-	log.Printf("Архив создан, размер: %d байт.", buf.Len())
+	log.Printf("Архив %s создан, размер: %d байт.", format, spool.Size())
+
+	entry := models.IndexEntry{
+		Ver:       cfg.Ver,
+		Checksum:  spool.Checksum(),
+		Size:      spool.Size(),
+		Packets:   cfg.Packets,
+		Published: time.Now().UTC(),
+	}
+	// Формат zip по умолчанию не записывается: индекс остается понятным прежним версиям pm
+	if format != FormatZip {
+		entry.Format = format
+	}
+	if signer != nil {
+		if entry.Signature, err = signing.Sign(signer, bytes.NewReader(signing.Manifest(cfg.Name, cfg.Ver, entry.Checksum))); err != nil {
+			return fmt.Errorf("ошибка подписи пакета %s: %w", cfg.Name, err)
+		}
+		log.Printf("Архив подписан ключом %s.", ssh.FingerprintSHA256(signer.PublicKey()))
+	}
 
-	// Загружаем архив на сервер по SSH, используя внедренный клиент
-	archiveName := fmt.Sprintf("%s-%s.zip", cfg.Name, cfg.Ver)
-	if err := pm.sshClient.UploadFile(archiveName, buf); err != nil {
-		return fmt.Errorf("ошибка загрузки пакета по SSH: %w", err)
+	// Загружаем архив в хранилище, используя внедренный backend.
+	// Индекс обновляется только после того, как архив полностью загружен
+	archiveName := archivePath(cfg.Name, cfg.Ver, entry.Format)
+	if err := pm.uploadAtomic(ctx, archiveName, spool.Reader(), spool.Size()); err != nil {
+		return fmt.Errorf("ошибка загрузки пакета в хранилище: %w", err)
+	}
+	if err := pm.publishToIndex(ctx, cfg.Name, entry); err != nil {
+		// Архив, который не попал в индекс пакета, недоступен для установки и мешал бы повторной публикации
+		cleanupCtx, cancel := cleanupContext(ctx)
+		defer cancel()
+		if pm.checkVersionUnpublished(cleanupCtx, cfg.Name, cfg.Ver) == nil {
+			pm.removeRemote(cleanupCtx, archiveName)
+		}
+		return err
 	}
 
 	log.Printf("Пакет %s успешно загружен на сервер.", archiveName)
 	return nil
 }
 
-// UpdatePackages скачивает и распаковывает архивы с сервера
-func (pm *PackageManager) UpdatePackages(configPath string) error {
+// UpdateOptions задает режим работы UpdatePackages
+type UpdateOptions struct {
+	// Locked устанавливает ровно те версии, что записаны в lock-файле, без разрешения зависимостей
+	Locked bool
+	// Prefix - корень установки, к которому добавляются директории dest из файла пакетов
+	Prefix string
+	// Jobs - число одновременных скачиваний; 0 - по одному
+	Jobs int
+}
+
+// ErrIncompleteUpdate возвращается, если часть пакетов не скачана: остальные пакеты установлены,
+// а пакеты, зависящие от не скачанных, пропущены
+var ErrIncompleteUpdate = errors.New("установлены не все пакеты")
+
+// UpdatePackages скачивает и распаковывает архивы с сервера.
+// После успешного обновления рядом с файлом пакетов записывается lock-файл с точными версиями.
+// Файлы установленных пакетов записываются в базу .pm/installed.json в корне установки.
+// Отмена ctx прерывает скачивание и распаковку; уже установленные пакеты остаются, lock-файл не обновляется
+func (pm *PackageManager) UpdatePackages(ctx context.Context, configPath string, opts UpdateOptions) error {
 	var cfg models.UpdateConfig
 	if err := pm.ReadConfig(configPath, &cfg); err != nil {
 		return fmt.Errorf("ошибка парсинга файла %s: %w", configPath, err)
 	}
 
-	log.Println("Обновление пакетов...")
+	policy, err := newSignaturePolicy(&cfg)
+	if err != nil {
+		return err
+	}
+	layout, err := newInstallLayout(cfg.Packages, opts.Prefix)
+	if err != nil {
+		return err
+	}
 
-	for _, pkg := range cfg.Packages {
-		archiveName := fmt.Sprintf("%s-%s.zip", pkg.Name, pkg.Ver)
-		log.Printf("Скачивание и распаковка пакета %s...", archiveName)
+	lockPath := lockFilePath(configPath)
+	format := filepath.Ext(configPath)
 
-		buf, err := pm.sshClient.DownloadFile(archiveName)
+	var packages []models.LockedPackage
+	if opts.Locked {
+		lock, err := readLockFile(lockPath, format)
 		if err != nil {
-			log.Printf("Не удалось скачать пакет %s: %v", archiveName, err)
-			continue
+			return err
 		}
-
-		// Распаковка архива
-		zipReader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err := checkLockDrift(cfg.Packages, lock.Requires); err != nil {
+			return err
+		}
+		packages = lock.Packages
+	} else {
+		resolved, err := pm.resolvePackages(ctx, cfg.Packages)
 		if err != nil {
-			log.Printf("Ошибка создания ZIP-ридера для %s: %v", archiveName, err)
-			continue
+			return err
 		}
+		packages = resolved
+	}
+	checksumSource := "индексом пакета"
+	if opts.Locked {
+		checksumSource = "lock-файлом"
+	}
 
-		for _, f := range zipReader.File {
-			path := filepath.Join(".", f.Name)
-			if f.FileInfo().IsDir() {
-				os.MkdirAll(path, f.Mode())
-				continue
-			}
+	var trustedKeys signing.TrustedKeys
+	if policy.checksSignatures(packages) {
+		if trustedKeys, err = pm.loadTrustedKeys(); err != nil {
+			return err
+		}
+	}
 
-			os.MkdirAll(filepath.Dir(path), 0755)
-			outFile, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
-			if err != nil {
-				log.Printf("Ошибка создания файла %s: %v", path, err)
-				continue
-			}
-			rc, err := f.Open()
-			if err != nil {
-				outFile.Close()
-				log.Printf("Ошибка открытия файла в архиве %s: %v", f.Name, err)
-				continue
-			}
-			_, err = io.Copy(outFile, rc)
-			outFile.Close()
-			rc.Close()
+	log.Println("Обновление пакетов...")
+
+	// Архивы скачиваются параллельно, а устанавливаются по одному в порядке зависимостей
+	downloads := pm.startDownloads(ctx, packages, opts.Jobs)
+	defer downloads.Close()
 
-			if err != nil {
-				log.Printf("Ошибка распаковки файла %s: %v", f.Name, err)
+	// Пакеты, которые не скачаны, и зависящие от них: зависимости идут раньше зависящих пакетов
+	var missing []string
+	for i := range packages {
+		pkg := &packages[i]
+		archiveName := archivePath(pkg.Name, pkg.Ver, pkg.Format)
+
+		if dep := slices.IndexFunc(pkg.Dependencies, func(dep string) bool { return slices.Contains(missing, dep) }); dep >= 0 {
+			log.Printf("Пакет %s %s пропущен: не установлена зависимость %s.", pkg.Name, pkg.Ver, pkg.Dependencies[dep])
+			missing = append(missing, pkg.Name)
+			continue
+		}
+		spool, cached, err := downloads.wait(ctx, i)
+		if err != nil {
+			if opts.Locked || errors.Is(err, ErrOffline) || ctx.Err() != nil {
+				return err
 			}
-			log.Printf("Распакован файл: %s", path)
+			log.Printf("%v", err)
+			missing = append(missing, pkg.Name)
+			continue
 		}
-		log.Printf("Пакет %s успешно распакован.", pkg.Name)
-	}
 
-	return nil
-}
+		// Поврежденный или подмененный архив не распаковывается
+		if err := verifyChecksum(archiveName, pkg.Checksum, spool.Checksum(), checksumSource); err != nil {
+			spool.Close()
+			return err
+		}
+		if err := verifySignature(archiveName, pkg, policy.forPackage(pkg.Name), trustedKeys); err != nil {
+			spool.Close()
+			return err
+		}
+		if !cached {
+			if err := pm.cache.store(pkg.Name, pkg.Ver, pkg.Format, spool); err != nil {
+				log.Printf("Архив %s не сохранен в кэш: %v", archiveName, err)
+			}
+		}
 
-// addFileToArchive добавляет одиночный файл в архив, если он не исключен
-func (pm *PackageManager) addFileToArchive(writer *zip.Writer, filePath string, exclude string) error {
-	// Проверка на исключение
-	if exclude != "" {
-		excludeMatch, err := filepath.Match(exclude, filepath.Base(filePath))
+		log.Printf("Установка пакета %s %s...", pkg.Name, pkg.Ver)
+		// Пакет распаковывается во временную директорию и переносится на место целиком.
+		// Ошибка установки прерывает обновление: уже установленные файлы пакета не меняются
+		err = pm.installArchive(ctx, layout.root, archiveName, spool, layout.forPackage(pkg.Name), *pkg)
+		spool.Close()
 		if err != nil {
-			return fmt.Errorf("ошибка при проверке исключения %s для файла %s: %w", exclude, filePath, err)
-		}
-		if excludeMatch {
-			log.Printf("Исключение файла %s", filePath)
-			return nil
+			return err
 		}
+		log.Printf("Пакет %s %s успешно установлен.", pkg.Name, pkg.Ver)
 	}
 
-	file, err := os.Open(filePath)
-	if err != nil {
-		return fmt.Errorf("не удалось открыть файл %s: %w", filePath, err)
+	if len(missing) > 0 {
+		log.Printf("Lock-файл %s не обновлен: скачаны не все пакеты.", lockPath)
+		return fmt.Errorf("%w: %s", ErrIncompleteUpdate, strings.Join(missing, ", "))
 	}
-	defer file.Close()
-
-	zipFile, err := writer.Create(filepath.Base(filePath))
-	if err != nil {
-		return fmt.Errorf("не удалось создать запись в архиве для файла %s: %w", filePath, err)
+	if opts.Locked {
+		return nil
 	}
-
-	_, err = io.Copy(zipFile, file)
-	if err != nil {
-		return fmt.Errorf("не удалось скопировать данные в архив из файла %s: %w", filePath, err)
+	lock := models.LockFile{Requires: cfg.Packages, Packages: packages}
+	if err := writeLockFile(lockPath, format, &lock); err != nil {
+		return err
 	}
+	log.Printf("Lock-файл %s обновлен.", lockPath)
 	return nil
 }
 
-// addDirToArchive рекурсивно добавляет директорию в архив
-func (pm *PackageManager) addDirToArchive(writer *zip.Writer, dirPath string, exclude string) error {
-	// Исключаем саму директорию, если она совпадает с исключениями
-	if exclude != "" {
-		excludeMatch, err := filepath.Match(exclude, filepath.Base(dirPath))
-		if err != nil {
-			return fmt.Errorf("ошибка при проверке исключения %s для папки %s: %w", exclude, dirPath, err)
-		}
-		if excludeMatch {
-			log.Printf("Исключение директории %s", dirPath)
-			return filepath.SkipDir
-		}
-	}
+// resolvePackages подбирает версии пакетов и их транзитивных зависимостей по индексам на сервере.
+// Контрольные суммы выбранных версий берутся из индексов
+func (pm *PackageManager) resolvePackages(ctx context.Context, packages []models.Package) ([]models.LockedPackage, error) {
+	source := newRemoteSource(ctx, pm)
 
-	return filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
+	// Разрешаем все дерево зависимостей до начала установки
+	resolved, err := resolver.New(source).Resolve(packages)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка разрешения зависимостей: %w", err)
+	}
 
-		// Создаем заголовок файла в архиве
-		header, err := zip.FileInfoHeader(info)
+	locked := make([]models.LockedPackage, 0, len(resolved))
+	for _, pkg := range resolved {
+		entry, err := source.entry(pkg.Name, pkg.Version)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		locked = append(locked, models.LockedPackage{
+			Name:         pkg.Name,
+			Ver:          pkg.Version.Original(),
+			Checksum:     entry.Checksum,
+			Format:       entry.Format,
+			Signature:    entry.Signature,
+			Dependencies: pkg.Dependencies,
+		})
+	}
+	return locked, nil
+}
 
-		// Устанавливаем относительный путь
-		relPath, err := filepath.Rel(filepath.Dir(dirPath), path)
-		if err != nil {
-			return err
-		}
-		header.Name = relPath
-
-		if info.IsDir() {
-			header.Name += "/"
-			// Пропускаем исключенные поддиректории
-			if exclude != "" {
-				excludeMatch, err := filepath.Match(exclude, filepath.Base(path))
-				if err != nil {
-					return fmt.Errorf("ошибка при проверке исключения %s для папки %s: %w", exclude, path, err)
-				}
-				if excludeMatch {
-					log.Printf("Исключение поддиректории %s", path)
-					return filepath.SkipDir
-				}
-			}
-		} else {
-			// Пропускаем исключенные файлы
-			if exclude != "" {
-				excludeMatch, err := filepath.Match(exclude, filepath.Base(path))
-				if err != nil {
-					return fmt.Errorf("ошибка при проверке исключения %s для файла %s: %w", exclude, path, err)
-				}
-				if excludeMatch {
-					log.Printf("Исключение файла %s", path)
-					return nil
-				}
-			}
-			header.Method = zip.Deflate
-		}
+// fetchArchive берет архив из локального кэша по контрольной сумме или скачивает его из хранилища.
+// Второе значение сообщает, что архив взят из кэша
+func (pm *PackageManager) fetchArchive(ctx context.Context, archiveName string, pkg *models.LockedPackage) (*spoolFile, bool, error) {
+	if spool, ok := pm.cache.open(pkg.Name, pkg.Ver, pkg.Checksum, pkg.Format); ok {
+		log.Printf("Архив %s взят из кэша.", archiveName)
+		return spool, true, nil
+	}
+	spool, err := pm.downloadArchive(ctx, archiveName)
+	return spool, false, err
+}
 
-		writer, err := writer.CreateHeader(header)
-		if err != nil {
-			return fmt.Errorf("не удалось создать запись в архиве для %s: %w", path, err)
-		}
+// downloadArchive скачивает архив во временный файл, вычисляя контрольную сумму по ходу загрузки.
+// Временный файл нужно закрыть вызовом Close
+func (pm *PackageManager) downloadArchive(ctx context.Context, archiveName string) (*spoolFile, error) {
+	spool, err := newSpoolFile()
+	if err != nil {
+		return nil, err
+	}
+	if err := pm.backend.DownloadFile(ctx, archiveName, spool); err != nil {
+		spool.Close()
+		return nil, fmt.Errorf("не удалось скачать пакет %s: %w", archiveName, err)
+	}
+	return spool, nil
+}
 
-		if !info.IsDir() {
-			file, err := os.Open(path)
-			if err != nil {
-				return fmt.Errorf("не удалось открыть файл %s: %w", path, err)
-			}
-			defer file.Close()
-			_, err = io.Copy(writer, file)
-			if err != nil {
-				return fmt.Errorf("не удалось скопировать данные в архив из файла %s: %w", path, err)
-			}
-		}
-		return nil
-	})
+// extractArchive распаковывает архив пакета в его директорию установки. Формат (zip, tar.gz, tar.zst)
+// определяется по сигнатуре или по расширению имени архива.
+// Файлы распаковываются потоком, без чтения архива в память. Возвращает пути распакованных записей
+func (pm *PackageManager) extractArchive(ctx context.Context, archiveName string, spool *spoolFile, target installTarget) ([]string, error) {
+	archive, err := openPackageArchive(archiveName, spool)
+	if err != nil {
+		return nil, err
+	}
+	return extractPackageArchive(ctx, archiveName, archive, target, pm.extractLimits)
 }
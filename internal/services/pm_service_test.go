@@ -2,29 +2,222 @@ package services
 
 import (
 	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
 	"errors"
+	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"golang.org/x/crypto/ssh"
 	"package-manager/internal/config"
+	"package-manager/internal/models"
+	"package-manager/internal/signing"
 )
 
-// MockSSHClient мок для тестирования, реализует интерфейс SSHClientInterface
-type MockSSHClient struct {
-	UploadFileFunc   func(fileName string, data *bytes.Buffer) error
-	DownloadFileFunc func(fileName string) (*bytes.Buffer, error)
+// MockBackend мок для тестирования, реализует интерфейс Backend
+type MockBackend struct {
+	UploadFileFunc   func(fileName string, data io.Reader, size int64) error
+	DownloadFileFunc func(fileName string, w io.Writer) error
+	ListFunc         func(dir string) ([]FileInfo, error)
+	StatFunc         func(fileName string) (*FileInfo, error)
+	DeleteFunc       func(fileName string) error
+	RenameFunc       func(oldName, newName string) error
 }
 
-func (m *MockSSHClient) UploadFile(fileName string, data *bytes.Buffer) error {
-	return m.UploadFileFunc(fileName, data)
+func (m *MockBackend) UploadFile(ctx context.Context, fileName string, data io.Reader, size int64) error {
+	return m.UploadFileFunc(fileName, data, size)
 }
 
-func (m *MockSSHClient) DownloadFile(fileName string) (*bytes.Buffer, error) {
-	return m.DownloadFileFunc(fileName)
+func (m *MockBackend) DownloadFile(ctx context.Context, fileName string, w io.Writer) error {
+	return m.DownloadFileFunc(fileName, w)
 }
 
-// TestCreatePackageWithMockClient тестирует создание пакета, используя мок-объект SSH-клиента
+func (m *MockBackend) List(ctx context.Context, dir string) ([]FileInfo, error) {
+	return m.ListFunc(dir)
+}
+
+func (m *MockBackend) Stat(ctx context.Context, fileName string) (*FileInfo, error) {
+	return m.StatFunc(fileName)
+}
+
+func (m *MockBackend) Delete(ctx context.Context, fileName string) error {
+	return m.DeleteFunc(fileName)
+}
+
+func (m *MockBackend) Rename(ctx context.Context, oldName, newName string) error {
+	return m.RenameFunc(oldName, newName)
+}
+
+func (m *MockBackend) Close() error {
+	return nil
+}
+
+// newMemoryRemote создает мок хранилища, держащий файлы в памяти (путь -> содержимое)
+func newMemoryRemote(remote map[string][]byte) *MockBackend {
+	return &MockBackend{
+		UploadFileFunc: func(fileName string, data io.Reader, size int64) error {
+			var buf bytes.Buffer
+			if _, err := io.CopyN(&buf, data, size); err != nil {
+				return err
+			}
+			remote[fileName] = buf.Bytes()
+			return nil
+		},
+		DownloadFileFunc: func(fileName string, w io.Writer) error {
+			data, ok := remote[fileName]
+			if !ok {
+				return fs.ErrNotExist
+			}
+			_, err := w.Write(data)
+			return err
+		},
+		ListFunc: func(dir string) ([]FileInfo, error) {
+			var files []FileInfo
+			for name, data := range remote {
+				if path.Dir(name) == dir {
+					files = append(files, FileInfo{Name: path.Base(name), Size: int64(len(data))})
+				}
+			}
+			return files, nil
+		},
+		StatFunc: func(fileName string) (*FileInfo, error) {
+			data, ok := remote[fileName]
+			if !ok {
+				return nil, fs.ErrNotExist
+			}
+			return &FileInfo{Name: path.Base(fileName), Size: int64(len(data))}, nil
+		},
+		DeleteFunc: func(fileName string) error {
+			if _, ok := remote[fileName]; !ok {
+				return fs.ErrNotExist
+			}
+			delete(remote, fileName)
+			return nil
+		},
+		RenameFunc: func(oldName, newName string) error {
+			data, ok := remote[oldName]
+			if !ok {
+				return fs.ErrNotExist
+			}
+			delete(remote, oldName)
+			remote[newName] = data
+			return nil
+		},
+	}
+}
+
+// archiveChecksum вычисляет контрольную сумму данных в формате spoolFile.Checksum
+func archiveChecksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// uploadBytes загружает данные в хранилище целиком
+func uploadBytes(b Backend, fileName string, data []byte) error {
+	return b.UploadFile(context.Background(), fileName, bytes.NewReader(data), int64(len(data)))
+}
+
+// downloadBytes скачивает файл из хранилища в память
+func downloadBytes(b Backend, fileName string) ([]byte, error) {
+	var buf bytes.Buffer
+	err := b.DownloadFile(context.Background(), fileName, &buf)
+	return buf.Bytes(), err
+}
+
+// testPackageArchive возвращает архив тестового пакета с файлом <name>.txt, содержащим "<name>-<ver>"
+func testPackageArchive(t *testing.T, name, ver string) []byte {
+	t.Helper()
+	return buildTestZipData(t, []testZipEntry{{name: name + ".txt", data: name + "-" + ver}})
+}
+
+// publishTestPackage кладет в память сервера архивы пакета и его индекс.
+// versions задает версии и их зависимости
+func publishTestPackage(t *testing.T, remote map[string][]byte, name string, versions map[string][]models.Package) {
+	t.Helper()
+	index := models.PackageIndex{Name: name}
+	for ver, deps := range versions {
+		archive := testPackageArchive(t, name, ver)
+		remote[archivePath(name, ver, "")] = archive
+		index.Versions = append(index.Versions, models.IndexEntry{
+			Ver:      ver,
+			Checksum: archiveChecksum(archive),
+			Size:     int64(len(archive)),
+			Packets:  deps,
+		})
+	}
+	data, err := json.Marshal(index)
+	if err != nil {
+		t.Fatalf("Не удалось сформировать индекс: %v", err)
+	}
+	remote[packageIndexPath(name)] = data
+}
+
+// replaceTestArchive заменяет архив опубликованной версии и его контрольную сумму в индексе.
+// Остальные поля записи индекса, включая подпись, не меняются
+func replaceTestArchive(t *testing.T, remote map[string][]byte, name, ver string, archive []byte) {
+	t.Helper()
+	var index models.PackageIndex
+	if err := json.Unmarshal(remote[packageIndexPath(name)], &index); err != nil {
+		t.Fatalf("Не удалось прочитать индекс: %v", err)
+	}
+	for i := range index.Versions {
+		if index.Versions[i].Ver == ver {
+			index.Versions[i].Checksum = archiveChecksum(archive)
+			index.Versions[i].Size = int64(len(archive))
+		}
+	}
+	data, err := json.Marshal(index)
+	if err != nil {
+		t.Fatalf("Не удалось сформировать индекс: %v", err)
+	}
+	remote[packageIndexPath(name)] = data
+	remote[archivePath(name, ver, "")] = archive
+}
+
+// writeTestSigningKey создает ключ Ed25519 для подписи пакетов и файл доверенных ключей,
+// в котором ключу разрешено подписывать пакеты principals. Возвращает пути к обоим файлам
+func writeTestSigningKey(t *testing.T, dir, principals string) (string, string) {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Не удалось создать ключ: %v", err)
+	}
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		t.Fatalf("Не удалось сериализовать ключ: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatalf("Не удалось создать подписчика: %v", err)
+	}
+
+	keyPath := filepath.Join(dir, "signing_key")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("Не удалось записать ключ: %v", err)
+	}
+	trustedPath := filepath.Join(dir, "trusted_keys")
+	trusted := principals + " " + string(ssh.MarshalAuthorizedKey(signer.PublicKey()))
+	if err := os.WriteFile(trustedPath, []byte(trusted), 0644); err != nil {
+		t.Fatalf("Не удалось записать доверенные ключи: %v", err)
+	}
+	return keyPath, trustedPath
+}
+
+// TestCreatePackageWithMockClient тестирует создание пакета, используя мок-объект хранилища
 func TestCreatePackageWithMockClient(t *testing.T) {
 	// Временная директория и файлы для тестирования
 	tempDir, err := os.MkdirTemp("", "test-pm")
@@ -61,30 +254,152 @@ func TestCreatePackageWithMockClient(t *testing.T) {
 	// Убеждаемся, что мы вернемся в исходную директорию, когда тест завершится
 	defer os.Chdir(currentDir)
 
-	// Создаем мок-объект SSH-клиента
-	mockSSHClient := &MockSSHClient{
-		UploadFileFunc: func(fileName string, data *bytes.Buffer) error {
-			// Проверяем, что файл был передан с правильным именем
-			if fileName != "test-pkg-1.0.zip" {
-				t.Errorf("Ожидалось имя файла 'test-pkg-1.0.zip', получено '%s'", fileName)
-				return errors.New("неверное имя файла")
+	// Создаем мок-объект хранилища с сервером в памяти
+	remote := map[string][]byte{}
+	mockBackend := newMemoryRemote(remote)
+
+	// Создаем PackageManager, используя мок хранилища
+	pm := NewPackageManager(&config.Config{}, mockBackend)
+
+	// Проверяем, что вызов `CreatePackage` не приводит к ошибке
+	err = pm.CreatePackage(t.Context(), filepath.Base(configFile), CreateOptions{})
+	if err != nil {
+		t.Fatalf("Ожидалась успешная упаковка, но получена ошибка: %v", err)
+	}
+
+	// Проверяем, что архив загружен под правильным именем и не пустой
+	archive := remote["test-pkg/1.0/test-pkg-1.0.zip"]
+	if len(archive) == 0 {
+		t.Fatal("Ожидался заполненный архив test-pkg/1.0/test-pkg-1.0.zip")
+	}
+
+	// Проверяем, что версия попала в индекс пакета и в общий каталог
+	index, err := pm.PackageInfo(t.Context(), "test-pkg")
+	if err != nil {
+		t.Fatalf("Не удалось прочитать индекс пакета: %v", err)
+	}
+	if len(index.Versions) != 1 || index.Versions[0].Checksum != archiveChecksum(archive) || index.Versions[0].Size != int64(len(archive)) {
+		t.Errorf("Неожиданное содержимое индекса: %+v", index.Versions)
+	}
+	found, err := pm.SearchPackages(t.Context(), "TEST")
+	if err != nil || len(found) != 1 || found[0].Latest != "1.0" {
+		t.Errorf("Ожидалось найти test-pkg 1.0 в каталоге, получено %+v (%v)", found, err)
+	}
+
+	// Временные файлы не должны оставаться на сервере
+	for name := range remote {
+		if strings.Contains(name, ".tmp-") {
+			t.Errorf("На сервере остался временный файл %s", name)
+		}
+	}
+
+	// Повторная публикация той же версии запрещена
+	if err := pm.CreatePackage(t.Context(), filepath.Base(configFile), CreateOptions{}); !errors.Is(err, ErrVersionExists) {
+		t.Errorf("Ожидалась ошибка ErrVersionExists, получено: %v", err)
+	}
+}
+
+// TestCreatePackageInvalidName проверяет, что недопустимые имена пакетов отклоняются до обращения к хранилищу
+func TestCreatePackageInvalidName(t *testing.T) {
+	t.Chdir(t.TempDir())
+	remote := map[string][]byte{}
+	pm := NewPackageManager(&config.Config{}, newMemoryRemote(remote))
+
+	for _, packet := range []string{
+		`{"name": "", "ver": "1.0", "targets": []}`,
+		`{"name": "..", "ver": "1.0", "targets": []}`,
+		`{"name": "a/b", "ver": "1.0", "targets": []}`,
+		`{"name": "app", "ver": "1.0", "targets": [], "packets": [{"name": "../lib"}]}`,
+	} {
+		if err := os.WriteFile("packet.json", []byte(packet), 0644); err != nil {
+			t.Fatalf("Не удалось создать файл пакета: %v", err)
+		}
+		if err := pm.CreatePackage(t.Context(), "packet.json", CreateOptions{}); err == nil || !strings.Contains(err.Error(), "недопустимое имя пакета") {
+			t.Errorf("Ожидалась ошибка недопустимого имени для %s, получено: %v", packet, err)
+		}
+	}
+	if len(remote) != 0 {
+		t.Errorf("Хранилище не должно изменяться, найдено %d файлов", len(remote))
+	}
+}
+
+// TestCreatePackageLostUpdate проверяет, что версия, затертая одновременной публикацией, записывается заново
+func TestCreatePackageLostUpdate(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile("packet.json", []byte(`{"name": "app", "ver": "1.0", "targets": []}`), 0644); err != nil {
+		t.Fatalf("Не удалось создать файл пакета: %v", err)
+	}
+
+	for _, tt := range []struct {
+		lost    int
+		wantErr error
+	}{{lost: 1}, {lost: publishAttempts, wantErr: ErrConcurrentPublish}} {
+		remote := map[string][]byte{}
+		mockBackend := newMemoryRemote(remote)
+		// Другой писатель, прочитавший индекс до нашей записи, записывает его поверх
+		lost := tt.lost
+		rename := mockBackend.RenameFunc
+		mockBackend.RenameFunc = func(oldName, newName string) error {
+			stale, existed := remote[newName]
+			if err := rename(oldName, newName); err != nil {
+				return err
 			}
-			// Проверяем, что архив не пустой
-			if data.Len() == 0 {
-				t.Error("Ожидался заполненный архив, но он пуст")
-				return errors.New("пустой архив")
+			if newName == packageIndexPath("app") && lost > 0 {
+				lost--
+				if existed {
+					remote[newName] = stale
+				} else {
+					delete(remote, newName)
+				}
 			}
 			return nil
-		},
+		}
+		pm := NewPackageManager(&config.Config{}, mockBackend)
+
+		err := pm.CreatePackage(t.Context(), "packet.json", CreateOptions{})
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Ожидалась ошибка %v, получено: %v", tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Ожидалась успешная упаковка, но получена ошибка: %v", err)
+		}
+		index, err := pm.PackageInfo(t.Context(), "app")
+		if err != nil || len(index.Versions) != 1 {
+			t.Errorf("Ожидалась версия 1.0 в индексе после повторной записи, получено %+v (%v)", index, err)
+		}
 	}
+}
 
-	// Создаем PackageManager, используя мок SSH-клиента
-	pm := NewPackageManager(&config.Config{}, mockSSHClient)
+// TestCreatePackageMalformedIndex проверяет, что некорректная версия в индексе, записанная другим писателем,
+// не мешает публикации и сохраняется в индексе
+func TestCreatePackageMalformedIndex(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile("packet.json", []byte(`{"name": "app", "ver": "1.0", "targets": []}`), 0644); err != nil {
+		t.Fatalf("Не удалось создать файл пакета: %v", err)
+	}
+	index, err := json.Marshal(models.PackageIndex{Name: "app", Versions: []models.IndexEntry{{Ver: "2.0"}, {Ver: "latest"}, {Ver: "0.9"}}})
+	if err != nil {
+		t.Fatalf("Не удалось сериализовать индекс: %v", err)
+	}
+	remote := map[string][]byte{packageIndexPath("app"): index}
+	pm := NewPackageManager(&config.Config{}, newMemoryRemote(remote))
 
-	// Проверяем, что вызов `CreatePackage` не приводит к ошибке
-	err = pm.CreatePackage(filepath.Base(configFile))
+	if err := pm.CreatePackage(t.Context(), "packet.json", CreateOptions{}); err != nil {
+		t.Fatalf("Ожидалась успешная упаковка, но получена ошибка: %v", err)
+	}
+	written, err := pm.PackageInfo(t.Context(), "app")
 	if err != nil {
-		t.Errorf("Ожидалась успешная упаковка, но получена ошибка: %v", err)
+		t.Fatalf("Ошибка чтения индекса: %v", err)
+	}
+	var versions []string
+	for _, entry := range written.Versions {
+		versions = append(versions, entry.Ver)
+	}
+	if got := strings.Join(versions, ","); got != "0.9,1.0,2.0,latest" {
+		t.Errorf("Ожидались версии 0.9,1.0,2.0,latest, получено %s", got)
 	}
 }
 
@@ -96,10 +411,12 @@ func TestUpdatePackagesWithMockClient(t *testing.T) {
 		t.Fatalf("Не удалось создать временную директорию: %v", err)
 	}
 	defer os.RemoveAll(tempDir)
+	t.Chdir(tempDir)
 
 	// Создаем тестовый packages.json
 	configFile := filepath.Join(tempDir, "packages.json")
 	configData := []byte(`{
+		"signature": "none",
 		"packages": [
 		{"name": "test-pkg", 
 		"ver": "1.0"}
@@ -109,24 +426,1050 @@ func TestUpdatePackagesWithMockClient(t *testing.T) {
 		t.Fatalf("Не удалось создать файл конфигурации: %v", err)
 	}
 
-	// Создаем мок SSH-клиента
-	mockSSHClient := &MockSSHClient{
-		DownloadFileFunc: func(fileName string) (*bytes.Buffer, error) {
-			// Проверяем, что запрашивается правильное имя файла
-			if fileName != "test-pkg-1.0.zip" {
-				return nil, errors.New("неверное имя файла")
-			}
-			// Возвращаем пустой буфер для симуляции скачивания
-			return bytes.NewBuffer([]byte{}), nil
-		},
+	// Создаем мок хранилища: на сервере есть индекс пакета и архив
+	remote := map[string][]byte{}
+	publishTestPackage(t, remote, "test-pkg", map[string][]models.Package{"1.0": nil})
+	mockBackend := newMemoryRemote(remote)
+	download := mockBackend.DownloadFileFunc
+	mockBackend.DownloadFileFunc = func(fileName string, w io.Writer) error {
+		// Проверяем, что запрашиваются только индекс и архив нужной версии
+		if fileName != "test-pkg/index.json" && fileName != "test-pkg/1.0/test-pkg-1.0.zip" {
+			return errors.New("неверное имя файла")
+		}
+		return download(fileName, w)
 	}
 
-	// Создаем PackageManager, используя мок SSH-Клиента
-	pm := NewPackageManager(&config.Config{}, mockSSHClient)
+	// Создаем PackageManager, используя мок хранилища
+	pm := NewPackageManager(&config.Config{}, mockBackend)
 
 	// Проверяем, что вызов `UpdatePackages` не приводит к ошибке
-	err = pm.UpdatePackages(configFile)
+	err = pm.UpdatePackages(t.Context(), configFile, UpdateOptions{})
+	if err != nil {
+		t.Errorf("Ожидалось успешное обновление, но получена ошибка: %v", err)
+	}
+}
+
+// TestUpdatePackagesResolvesConstraints проверяет выбор наибольшей подходящей версии на сервере
+func TestUpdatePackagesResolvesConstraints(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Chdir(tempDir)
+
+	configFile := filepath.Join(tempDir, "packages.json")
+	configData := []byte(`{
+		"signature": "none",
+		"packages": [
+			{"name": "packet-1", "ver": ">=1.10"},
+			{"name": "packet-2"},
+			{"name": "packet-3", "ver": "<=1.10"}
+		]
+	}`)
+	if err := os.WriteFile(configFile, configData, 0644); err != nil {
+		t.Fatalf("Не удалось создать файл конфигурации: %v", err)
+	}
+
+	remote := map[string][]byte{}
+	publishTestPackage(t, remote, "packet-1", map[string][]models.Package{"1.9": nil, "1.10": nil, "1.11": nil})
+	publishTestPackage(t, remote, "packet-2", map[string][]models.Package{"0.1": nil, "2.0": nil, "3.0.0-rc.1": nil})
+	publishTestPackage(t, remote, "packet-3", map[string][]models.Package{"1.2": nil, "2.0": nil})
+	publishTestPackage(t, remote, "packet-1-extra", map[string][]models.Package{"5.0": nil})
+
+	var downloaded []string
+	mockBackend := newMemoryRemote(remote)
+	download := mockBackend.DownloadFileFunc
+	mockBackend.DownloadFileFunc = func(fileName string, w io.Writer) error {
+		if strings.HasSuffix(fileName, ".zip") {
+			downloaded = append(downloaded, fileName)
+		}
+		return download(fileName, w)
+	}
+
+	pm := NewPackageManager(&config.Config{}, mockBackend)
+	if err := pm.UpdatePackages(t.Context(), configFile, UpdateOptions{}); err != nil {
+		t.Fatalf("Ожидалось успешное обновление, но получена ошибка: %v", err)
+	}
+
+	want := []string{"packet-1/1.11/packet-1-1.11.zip", "packet-2/2.0/packet-2-2.0.zip", "packet-3/1.2/packet-3-1.2.zip"}
+	if strings.Join(downloaded, ",") != strings.Join(want, ",") {
+		t.Errorf("Ожидалось скачивание %v, получено %v", want, downloaded)
+	}
+}
+
+// TestCreateAndUpdateWithDependencies проверяет публикацию зависимостей и установку всего графа
+func TestCreateAndUpdateWithDependencies(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Chdir(tempDir)
+
+	remote := map[string][]byte{}
+	publishTestPackage(t, remote, "lib", map[string][]models.Package{"1.0": nil, "2.0": nil})
+	mockBackend := newMemoryRemote(remote)
+	pm := NewPackageManager(&config.Config{}, mockBackend)
+
+	packetFile := filepath.Join(tempDir, "packet.json")
+	packetData := []byte(`{
+		"name": "app",
+		"ver": "1.0",
+		"targets": [],
+		"packets": [{"name": "lib", "ver": "<2.0"}]
+	}`)
+	if err := os.WriteFile(packetFile, packetData, 0644); err != nil {
+		t.Fatalf("Не удалось создать файл пакета: %v", err)
+	}
+	if err := pm.CreatePackage(t.Context(), packetFile, CreateOptions{}); err != nil {
+		t.Fatalf("Ожидалась успешная упаковка, но получена ошибка: %v", err)
+	}
+	index, err := pm.PackageInfo(t.Context(), "app")
+	if err != nil || len(index.Versions) != 1 || len(index.Versions[0].Packets) != 1 {
+		t.Fatalf("Ожидалась публикация зависимостей в индексе пакета, получено %+v (%v)", index, err)
+	}
+
+	var downloaded []string
+	download := mockBackend.DownloadFileFunc
+	mockBackend.DownloadFileFunc = func(fileName string, w io.Writer) error {
+		if strings.HasSuffix(fileName, ".zip") {
+			downloaded = append(downloaded, fileName)
+		}
+		return download(fileName, w)
+	}
+
+	configFile := filepath.Join(tempDir, "packages.json")
+	if err := os.WriteFile(configFile, []byte(`{"signature": "none", "packages": [{"name": "app"}]}`), 0644); err != nil {
+		t.Fatalf("Не удалось создать файл конфигурации: %v", err)
+	}
+	if err := pm.UpdatePackages(t.Context(), configFile, UpdateOptions{}); err != nil {
+		t.Fatalf("Ожидалось успешное обновление, но получена ошибка: %v", err)
+	}
+
+	want := []string{"lib/1.0/lib-1.0.zip", "app/1.0/app-1.0.zip"}
+	if strings.Join(downloaded, ",") != strings.Join(want, ",") {
+		t.Errorf("Ожидалось скачивание %v, получено %v", want, downloaded)
+	}
+
+	// Конфликт с требованием верхнего уровня должен приводить к ошибке
+	conflictData := []byte(`{"signature": "none", "packages": [{"name": "app"}, {"name": "lib", "ver": ">=2.0"}]}`)
+	if err := os.WriteFile(configFile, conflictData, 0644); err != nil {
+		t.Fatalf("Не удалось создать файл конфигурации: %v", err)
+	}
+	err = pm.UpdatePackages(t.Context(), configFile, UpdateOptions{})
+	if err == nil || !strings.Contains(err.Error(), "<2.0 (от app 1.0)") {
+		t.Errorf("Ожидалась ошибка конфликта с указанием ограничений, получено: %v", err)
+	}
+}
+
+// TestCreateAndUpdateTarFormats проверяет упаковку и установку архивов tar.gz и tar.zst
+// с сохранением прав доступа и ссылок
+func TestCreateAndUpdateTarFormats(t *testing.T) {
+	for _, format := range []string{FormatTarGz, FormatTarZst} {
+		t.Run(format, func(t *testing.T) {
+			tempDir := t.TempDir()
+			t.Chdir(tempDir)
+
+			if err := os.MkdirAll(filepath.Join("src", "bin"), 0755); err != nil {
+				t.Fatalf("Не удалось создать директорию: %v", err)
+			}
+			if err := os.WriteFile(filepath.Join("src", "bin", "tool"), []byte("#!/bin/sh\n"), 0750); err != nil {
+				t.Fatalf("Не удалось создать файл: %v", err)
+			}
+			if err := os.Symlink("bin/tool", filepath.Join("src", "tool")); err != nil {
+				t.Fatalf("Не удалось создать ссылку: %v", err)
+			}
+
+			remote := map[string][]byte{}
+			pm := NewPackageManager(&config.Config{}, newMemoryRemote(remote))
+			packetData := []byte(`{"name": "app", "ver": "1.0", "format": "` + format + `", "targets": [{"path": "src/**"}]}`)
+			if err := os.WriteFile("packet.json", packetData, 0644); err != nil {
+				t.Fatalf("Не удалось создать файл пакета: %v", err)
+			}
+			if err := pm.CreatePackage(t.Context(), "packet.json", CreateOptions{}); err != nil {
+				t.Fatalf("Ожидалась успешная упаковка, но получена ошибка: %v", err)
+			}
+			if len(remote["app/1.0/app-1.0."+format]) == 0 {
+				t.Fatalf("Ожидался архив app/1.0/app-1.0.%s", format)
+			}
+			index, err := pm.PackageInfo(t.Context(), "app")
+			if err != nil || len(index.Versions) != 1 || index.Versions[0].Format != format {
+				t.Fatalf("Ожидался формат %s в индексе, получено %+v (%v)", format, index, err)
+			}
+
+			if err := os.WriteFile("packages.json", []byte(`{"signature": "none", "packages": [{"name": "app", "dest": "out"}]}`), 0644); err != nil {
+				t.Fatalf("Не удалось создать файл конфигурации: %v", err)
+			}
+			if err := pm.UpdatePackages(t.Context(), "packages.json", UpdateOptions{}); err != nil {
+				t.Fatalf("Ожидалось успешное обновление, но получена ошибка: %v", err)
+			}
+			if info, err := os.Stat(filepath.Join("out", "bin", "tool")); err != nil || info.Mode().Perm() != 0750 {
+				t.Errorf("Ожидался файл с правами 0750, получено %v (%v)", info, err)
+			}
+			if link, err := os.Readlink(filepath.Join("out", "tool")); err != nil || link != "bin/tool" {
+				t.Errorf("Ожидалась ссылка на bin/tool, получено %q (%v)", link, err)
+			}
+			lockData, err := os.ReadFile("packages.lock")
+			if err != nil || !strings.Contains(string(lockData), `"format": "`+format+`"`) {
+				t.Errorf("Ожидался формат %s в lock-файле, получено %s (%v)", format, lockData, err)
+			}
+		})
+	}
+
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile("packet.json", []byte(`{"name": "app", "ver": "1.0", "format": "rar", "targets": []}`), 0644); err != nil {
+		t.Fatalf("Не удалось создать файл пакета: %v", err)
+	}
+	pm := NewPackageManager(&config.Config{}, newMemoryRemote(map[string][]byte{}))
+	if err := pm.CreatePackage(t.Context(), "packet.json", CreateOptions{}); err == nil || !strings.Contains(err.Error(), `"rar"`) {
+		t.Errorf("Ожидалась ошибка неизвестного формата архива, получено: %v", err)
+	}
+}
+
+// TestUpdatePackagesFailedDownload проверяет, что пакеты, зависящие от не скачанного, не устанавливаются,
+// а обновление завершается ошибкой
+func TestUpdatePackagesFailedDownload(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	remote := map[string][]byte{}
+	publishTestPackage(t, remote, "lib", map[string][]models.Package{"1.0": nil})
+	publishTestPackage(t, remote, "app", map[string][]models.Package{"1.0": {{Name: "lib"}}})
+	publishTestPackage(t, remote, "tool", map[string][]models.Package{"1.0": nil})
+	mockBackend := newMemoryRemote(remote)
+	download := mockBackend.DownloadFileFunc
+	mockBackend.DownloadFileFunc = func(fileName string, w io.Writer) error {
+		if fileName == archivePath("lib", "1.0", "") {
+			return errors.New("обрыв соединения")
+		}
+		return download(fileName, w)
+	}
+	pm := NewPackageManager(&config.Config{}, mockBackend)
+
+	if err := os.WriteFile("packages.json", []byte(`{"signature": "none", "packages": [{"name": "app"}, {"name": "tool"}]}`), 0644); err != nil {
+		t.Fatalf("Не удалось создать файл конфигурации: %v", err)
+	}
+	err := pm.UpdatePackages(t.Context(), "packages.json", UpdateOptions{})
+	if !errors.Is(err, ErrIncompleteUpdate) || !strings.Contains(err.Error(), "lib, app") {
+		t.Errorf("Ожидалась ошибка ErrIncompleteUpdate для lib и app, получено: %v", err)
+	}
+	if _, err := os.Stat("app.txt"); !os.IsNotExist(err) {
+		t.Errorf("Пакет с не скачанной зависимостью не должен устанавливаться: %v", err)
+	}
+	if data, err := os.ReadFile("tool.txt"); err != nil || string(data) != "tool-1.0" {
+		t.Errorf("Ожидалась установка независимого пакета tool, получено %q (%v)", data, err)
+	}
+	if _, err := os.Stat("packages.lock"); !os.IsNotExist(err) {
+		t.Errorf("Lock-файл не должен записываться при неполном обновлении: %v", err)
+	}
+}
+
+// TestUpdatePackagesLockFile проверяет запись lock-файла и установку в режиме --locked
+func TestUpdatePackagesLockFile(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Chdir(tempDir)
+
+	remote := map[string][]byte{}
+	publishTestPackage(t, remote, "lib", map[string][]models.Package{"1.0": nil, "1.1": nil})
+	pm := NewPackageManager(&config.Config{}, newMemoryRemote(remote))
+
+	configFile := filepath.Join(tempDir, "packages.yaml")
+	configData := []byte("signature: none\npackages:\n  - name: lib\n    ver: \"^1.0\"\n")
+	if err := os.WriteFile(configFile, configData, 0644); err != nil {
+		t.Fatalf("Не удалось создать файл конфигурации: %v", err)
+	}
+	if err := pm.UpdatePackages(t.Context(), configFile, UpdateOptions{}); err != nil {
+		t.Fatalf("Ожидалось успешное обновление, но получена ошибка: %v", err)
+	}
+
+	// Lock-файл записывается в формате файла пакетов
+	lock, err := readLockFile(filepath.Join(tempDir, "packages.lock"), ".yaml")
+	if err != nil {
+		t.Fatalf("Не удалось прочитать lock-файл: %v", err)
+	}
+	if len(lock.Packages) != 1 || lock.Packages[0].Ver != "1.1" || lock.Packages[0].Checksum != archiveChecksum(testPackageArchive(t, "lib", "1.1")) {
+		t.Fatalf("Неожиданное содержимое lock-файла: %+v", lock.Packages)
+	}
+
+	// Новая версия на сервере не влияет на установку по lock-файлу
+	publishTestPackage(t, remote, "lib", map[string][]models.Package{"1.0": nil, "1.1": nil, "1.2": nil})
+	var downloaded []string
+	mockBackend := newMemoryRemote(remote)
+	download := mockBackend.DownloadFileFunc
+	mockBackend.DownloadFileFunc = func(fileName string, w io.Writer) error {
+		downloaded = append(downloaded, fileName)
+		return download(fileName, w)
+	}
+	mockBackend.StatFunc = func(fileName string) (*FileInfo, error) {
+		t.Errorf("В режиме --locked индекс на сервере не должен запрашиваться (%s)", fileName)
+		return nil, fs.ErrNotExist
+	}
+	pm = NewPackageManager(&config.Config{}, mockBackend)
+	if err := pm.UpdatePackages(t.Context(), configFile, UpdateOptions{Locked: true}); err != nil {
+		t.Fatalf("Ожидалась успешная установка по lock-файлу, но получена ошибка: %v", err)
+	}
+	if len(downloaded) != 1 || downloaded[0] != "lib/1.1/lib-1.1.zip" {
+		t.Errorf("Ожидалось скачивание lib/1.1/lib-1.1.zip, получено %v", downloaded)
+	}
+
+	// Подмена архива на сервере обнаруживается по контрольной сумме
+	remote["lib/1.1/lib-1.1.zip"] = []byte("tampered")
+	if err := pm.UpdatePackages(t.Context(), configFile, UpdateOptions{Locked: true}); err == nil || !strings.Contains(err.Error(), "контрольная сумма") {
+		t.Errorf("Ожидалась ошибка контрольной суммы, получено: %v", err)
+	}
+
+	// Изменение файла пакетов после создания lock-файла обнаруживается
+	driftData := []byte("signature: none\npackages:\n  - name: lib\n    ver: \"^2.0\"\n")
+	if err := os.WriteFile(configFile, driftData, 0644); err != nil {
+		t.Fatalf("Не удалось обновить файл конфигурации: %v", err)
+	}
+	if err := pm.UpdatePackages(t.Context(), configFile, UpdateOptions{Locked: true}); err == nil || !strings.Contains(err.Error(), "изменился") {
+		t.Errorf("Ожидалась ошибка расхождения с lock-файлом, получено: %v", err)
+	}
+}
+
+// TestUpdatePackagesChecksumMismatch проверяет, что архив с чужой контрольной суммой не устанавливается
+func TestUpdatePackagesChecksumMismatch(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Chdir(tempDir)
+
+	remote := map[string][]byte{}
+	publishTestPackage(t, remote, "lib", map[string][]models.Package{"1.0": nil})
+	remote["lib/1.0/lib-1.0.zip"] = []byte("tampered")
+
+	downloaded := false
+	mockBackend := newMemoryRemote(remote)
+	download := mockBackend.DownloadFileFunc
+	mockBackend.DownloadFileFunc = func(fileName string, w io.Writer) error {
+		downloaded = downloaded || strings.HasSuffix(fileName, ".zip")
+		return download(fileName, w)
+	}
+	pm := NewPackageManager(&config.Config{}, mockBackend)
+
+	configFile := filepath.Join(tempDir, "packages.json")
+	if err := os.WriteFile(configFile, []byte(`{"signature": "none", "packages": [{"name": "lib"}]}`), 0644); err != nil {
+		t.Fatalf("Не удалось создать файл конфигурации: %v", err)
+	}
+
+	err := pm.UpdatePackages(t.Context(), configFile, UpdateOptions{})
+	var checksumErr *ChecksumError
+	if !errors.As(err, &checksumErr) {
+		t.Fatalf("Ожидалась ошибка ChecksumError, получено: %v", err)
+	}
+	if checksumErr.Expected != archiveChecksum(testPackageArchive(t, "lib", "1.0")) || checksumErr.Actual != archiveChecksum([]byte("tampered")) {
+		t.Errorf("Неожиданные контрольные суммы в ошибке: %+v", checksumErr)
+	}
+	if !downloaded {
+		t.Errorf("Архив должен был быть скачан перед проверкой")
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "packages.lock")); !os.IsNotExist(err) {
+		t.Errorf("Lock-файл не должен записываться после ошибки проверки: %v", err)
+	}
+}
+
+// TestCreatePackageEncryptedSigningKey проверяет подпись пакета ключом, защищенным паролем
+func TestCreatePackageEncryptedSigningKey(t *testing.T) {
+	t.Chdir(t.TempDir())
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
 	if err != nil {
+		t.Fatalf("Не удалось создать ключ: %v", err)
+	}
+	block, err := ssh.MarshalPrivateKeyWithPassphrase(priv, "", []byte("secret"))
+	if err != nil {
+		t.Fatalf("Не удалось сериализовать ключ: %v", err)
+	}
+	keyPath := filepath.Join(t.TempDir(), "signing_key")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("Не удалось записать ключ: %v", err)
+	}
+	if err := os.WriteFile("packet.json", []byte(`{"name": "app", "ver": "1.0", "targets": []}`), 0644); err != nil {
+		t.Fatalf("Не удалось создать файл пакета: %v", err)
+	}
+
+	// Без пароля и без терминала ключ не расшифровать
+	pm := NewPackageManager(&config.Config{SigningKey: keyPath}, newMemoryRemote(map[string][]byte{}))
+	if err := pm.CreatePackage(t.Context(), "packet.json", CreateOptions{Sign: true}); !errors.Is(err, ErrNoTerminal) {
+		t.Errorf("Ожидалась ошибка ErrNoTerminal, получено: %v", err)
+	}
+
+	remote := map[string][]byte{}
+	pm = NewPackageManager(&config.Config{SigningKey: keyPath, SSHKeyPassphrase: "secret"}, newMemoryRemote(remote))
+	if err := pm.CreatePackage(t.Context(), "packet.json", CreateOptions{Sign: true}); err != nil {
+		t.Fatalf("Ожидалась успешная упаковка с подписью, но получена ошибка: %v", err)
+	}
+	index, err := pm.PackageInfo(t.Context(), "app")
+	if err != nil || index.Versions[0].Signature == "" {
+		t.Errorf("Ожидалась подпись в индексе пакета, получено %+v (%v)", index, err)
+	}
+}
+
+// TestUpdatePackagesSignatures проверяет подпись пакетов и политики проверки подписей
+func TestUpdatePackagesSignatures(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Chdir(tempDir)
+	keyPath, trustedKeys := writeTestSigningKey(t, t.TempDir(), "app")
+	_, otherTrustedKeys := writeTestSigningKey(t, t.TempDir(), "*")
+
+	remote := map[string][]byte{}
+	publishTestPackage(t, remote, "lib", map[string][]models.Package{"1.0": nil})
+	cfg := &config.Config{SigningKey: keyPath, TrustedKeys: trustedKeys}
+	pm := NewPackageManager(cfg, newMemoryRemote(remote))
+
+	packetFile := filepath.Join(tempDir, "packet.json")
+	packetData := []byte(`{"name": "app", "ver": "1.0", "targets": [], "packets": [{"name": "lib"}]}`)
+	if err := os.WriteFile(packetFile, packetData, 0644); err != nil {
+		t.Fatalf("Не удалось создать файл пакета: %v", err)
+	}
+	if err := pm.CreatePackage(t.Context(), packetFile, CreateOptions{Sign: true}); err != nil {
+		t.Fatalf("Ожидалась успешная упаковка с подписью, но получена ошибка: %v", err)
+	}
+	index, err := pm.PackageInfo(t.Context(), "app")
+	if err != nil || index.Versions[0].Signature == "" {
+		t.Fatalf("Ожидалась подпись в индексе пакета, получено %+v (%v)", index, err)
+	}
+
+	configFile := filepath.Join(tempDir, "packages.json")
+	update := func(configData string) error {
+		t.Helper()
+		if err := os.WriteFile(configFile, []byte(configData), 0644); err != nil {
+			t.Fatalf("Не удалось создать файл конфигурации: %v", err)
+		}
+		return pm.UpdatePackages(t.Context(), configFile, UpdateOptions{})
+	}
+
+	// По умолчанию неподписанная зависимость отклоняется
+	var signatureErr *SignatureError
+	err = update(`{"packages": [{"name": "app"}]}`)
+	if !errors.As(err, &signatureErr) || !errors.Is(err, ErrUnsigned) || signatureErr.Archive != "lib/1.0/lib-1.0.zip" {
+		t.Errorf("Ожидалась ошибка ErrUnsigned для lib, получено: %v", err)
+	}
+
+	// Политика optional допускает неподписанный пакет, подпись app проверяется
+	if err := update(`{"signature": "optional", "packages": [{"name": "app", "signature": "required"}]}`); err != nil {
 		t.Errorf("Ожидалось успешное обновление, но получена ошибка: %v", err)
 	}
+
+	// Неизвестная политика - ошибка файла пакетов
+	if err := update(`{"packages": [{"name": "app", "signature": "always"}]}`); err == nil || !strings.Contains(err.Error(), "always") {
+		t.Errorf("Ожидалась ошибка неизвестной политики, получено: %v", err)
+	}
+
+	// Подпись ключом не из списка доверенных отклоняется
+	pm.config.TrustedKeys = otherTrustedKeys
+	if err := update(`{"signature": "optional", "packages": [{"name": "app"}]}`); !errors.Is(err, ErrUntrustedKey) {
+		t.Errorf("Ожидалась ошибка ErrUntrustedKey, получено: %v", err)
+	}
+	pm.config.TrustedKeys = trustedKeys
+
+	// Архив и подпись версии 1.0, опубликованные как 1.1, отклоняются: подпись покрывает версию
+	published := remote[packageIndexPath("app")]
+	replayed := *index
+	replayed.Versions = append(slices.Clone(index.Versions), index.Versions[0])
+	replayed.Versions[1].Ver = "1.1"
+	data, err := json.Marshal(replayed)
+	if err != nil {
+		t.Fatalf("Не удалось сформировать индекс: %v", err)
+	}
+	remote[packageIndexPath("app")] = data
+	remote[archivePath("app", "1.1", "")] = remote[archivePath("app", "1.0", "")]
+	if err := update(`{"signature": "optional", "packages": [{"name": "app"}]}`); !errors.Is(err, signing.ErrInvalidSignature) {
+		t.Errorf("Ожидалась ошибка ErrInvalidSignature для подписи другой версии, получено: %v", err)
+	}
+	remote[packageIndexPath("app")] = published
+	delete(remote, archivePath("app", "1.1", ""))
+
+	// Подмена архива вместе с контрольной суммой в индексе обнаруживается по подписи
+	replaceTestArchive(t, remote, "app", "1.0", []byte("tampered"))
+	if err := update(`{"signature": "optional", "packages": [{"name": "app"}]}`); !errors.Is(err, signing.ErrInvalidSignature) {
+		t.Errorf("Ожидалась ошибка ErrInvalidSignature, получено: %v", err)
+	}
+}
+
+// TestVerifySignatureManifest проверяет, что подпись привязана к имени, версии и контрольной сумме пакета
+// даже для ключа, которому доверены все пакеты
+func TestVerifySignatureManifest(t *testing.T) {
+	keyPath, trustedKeysPath := writeTestSigningKey(t, t.TempDir(), "*")
+	signer, err := signing.LoadSigner(keyPath, nil)
+	if err != nil {
+		t.Fatalf("Не удалось загрузить ключ: %v", err)
+	}
+	keys, err := signing.LoadTrustedKeys(trustedKeysPath)
+	if err != nil {
+		t.Fatalf("Не удалось загрузить доверенные ключи: %v", err)
+	}
+	checksum := archiveChecksum([]byte("archive"))
+	signature, err := signing.Sign(signer, bytes.NewReader(signing.Manifest("a", "1.0.0", checksum)))
+	if err != nil {
+		t.Fatalf("Ошибка подписи: %v", err)
+	}
+
+	for _, tt := range []struct {
+		name, ver, checksum string
+		valid               bool
+	}{
+		{"a", "1.0.0", checksum, true},
+		{"a", "1.1.0", checksum, false},
+		{"b", "1.0.0", checksum, false},
+		{"a", "1.0.0", archiveChecksum([]byte("other")), false},
+	} {
+		pkg := models.LockedPackage{Name: tt.name, Ver: tt.ver, Checksum: tt.checksum, Signature: signature}
+		err := verifySignature(archivePath(tt.name, tt.ver, ""), &pkg, SignatureRequired, keys)
+		if tt.valid && err != nil {
+			t.Errorf("%s %s: ожидалась верная подпись, получено: %v", tt.name, tt.ver, err)
+		}
+		if !tt.valid && !errors.Is(err, signing.ErrInvalidSignature) {
+			t.Errorf("%s %s (%s): ожидалась ошибка ErrInvalidSignature, получено: %v", tt.name, tt.ver, tt.checksum, err)
+		}
+	}
+}
+
+// TestUpdatePackagesDestAndPrefix проверяет установку в директории dest внутри корня --prefix
+func TestUpdatePackagesDestAndPrefix(t *testing.T) {
+	tempDir := t.TempDir()
+	prefix := filepath.Join(tempDir, "stage")
+
+	remote := map[string][]byte{}
+	publishTestPackage(t, remote, "lib", map[string][]models.Package{"1.0": nil})
+	publishTestPackage(t, remote, "plugin", map[string][]models.Package{"1.0": {{Name: "lib"}}})
+	replaceTestArchive(t, remote, "lib", "1.0", buildTestZipData(t, []testZipEntry{{name: "lib.txt", data: "lib"}}))
+	replaceTestArchive(t, remote, "plugin", "1.0", buildTestZipData(t, []testZipEntry{
+		{name: "plugin-1.0/plugin.so", data: "plugin"},
+		{name: "plugin-1.0/src/plugin.c", data: "source"},
+	}))
+	pm := NewPackageManager(&config.Config{}, newMemoryRemote(remote))
+
+	configFile := filepath.Join(tempDir, "packages.json")
+	configData := []byte(`{
+		"signature": "none",
+		"packages": [
+			{"name": "plugin", "dest": "/opt/app/plugins", "strip_prefix": "plugin-1.0", "paths": ["*.so"]}
+		]
+	}`)
+	if err := os.WriteFile(configFile, configData, 0644); err != nil {
+		t.Fatalf("Не удалось создать файл конфигурации: %v", err)
+	}
+	if err := pm.UpdatePackages(t.Context(), configFile, UpdateOptions{Prefix: prefix}); err != nil {
+		t.Fatalf("Ожидалось успешное обновление, но получена ошибка: %v", err)
+	}
+
+	for name, want := range map[string]string{
+		"opt/app/plugins/plugin.so": "plugin",
+		"lib.txt":                   "lib",
+	} {
+		if data, err := os.ReadFile(filepath.Join(prefix, filepath.FromSlash(name))); err != nil || string(data) != want {
+			t.Errorf("Ожидался файл %s с содержимым %q, получено %q (%v)", name, want, data, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(prefix, "opt", "app", "plugins", "src")); !os.IsNotExist(err) {
+		t.Errorf("Файлы вне paths не должны устанавливаться: %v", err)
+	}
+	if installed, err := ListInstalled(prefix); err != nil || len(installed) != 2 || strings.Join(installed[1].Files, ",") != "opt/app/plugins/plugin.so" {
+		t.Errorf("Ожидались пути относительно корня установки, получено %+v (%v)", installed, err)
+	}
+}
+
+// TestUpdatePackagesAbsoluteDest проверяет установку в абсолютный dest без --prefix: файлы попадают
+// в саму директорию dest, а обновление, откат и удаление работают с ней
+func TestUpdatePackagesAbsoluteDest(t *testing.T) {
+	tempDir := t.TempDir()
+	project := filepath.Join(tempDir, "project")
+	dest := filepath.Join(tempDir, "opt", "plugins")
+	if err := os.Mkdir(project, 0755); err != nil {
+		t.Fatalf("Не удалось создать директорию: %v", err)
+	}
+	t.Chdir(project)
+
+	remote := map[string][]byte{}
+	publishTestPackage(t, remote, "plugin", map[string][]models.Package{"1.0": nil, "2.0": nil})
+	pm := NewPackageManager(&config.Config{}, newMemoryRemote(remote))
+	update := func(ver string) {
+		t.Helper()
+		configData := `{"signature": "none", "packages": [{"name": "plugin", "ver": "` + ver + `", "dest": ` + strconv.Quote(dest) + `}]}`
+		if err := os.WriteFile("packages.json", []byte(configData), 0644); err != nil {
+			t.Fatalf("Не удалось создать файл конфигурации: %v", err)
+		}
+		if err := pm.UpdatePackages(t.Context(), "packages.json", UpdateOptions{}); err != nil {
+			t.Fatalf("Ожидалось успешное обновление, но получена ошибка: %v", err)
+		}
+	}
+	checkInstalled := func(want string) {
+		t.Helper()
+		if data, err := os.ReadFile(filepath.Join(dest, "plugin.txt")); err != nil || string(data) != want {
+			t.Errorf("Ожидался файл %s/plugin.txt с содержимым %q, получено %q (%v)", dest, want, data, err)
+		}
+	}
+
+	update("1.0")
+	checkInstalled("plugin-1.0")
+	if _, err := os.Stat(filepath.Join(project, filepath.FromSlash(strings.TrimPrefix(filepath.ToSlash(dest), "/")))); !os.IsNotExist(err) {
+		t.Errorf("Абсолютный dest не должен добавляться к текущей директории: %v", err)
+	}
+	installed, err := ListInstalled("")
+	if err != nil || len(installed) != 1 || installed[0].Dest != dest || strings.Join(installed[0].Files, ",") != "plugin.txt" {
+		t.Fatalf("Ожидались пути относительно dest, получено %+v (%v)", installed, err)
+	}
+
+	update("2.0")
+	checkInstalled("plugin-2.0")
+	if err := RollbackPackage("", "plugin"); err != nil {
+		t.Fatalf("Ожидался успешный откат, получено: %v", err)
+	}
+	checkInstalled("plugin-1.0")
+
+	if err := RemovePackage("", "plugin"); err != nil {
+		t.Fatalf("Ожидалось успешное удаление, получено: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "plugin.txt")); !os.IsNotExist(err) {
+		t.Errorf("Файл пакета не удален из dest: %v", err)
+	}
+
+	// Перенос пакета из dest в корень установки удаляет файлы из прежней директории
+	update("1.0")
+	if err := os.WriteFile("packages.json", []byte(`{"signature": "none", "packages": [{"name": "plugin", "ver": "2.0"}]}`), 0644); err != nil {
+		t.Fatalf("Не удалось создать файл конфигурации: %v", err)
+	}
+	if err := pm.UpdatePackages(t.Context(), "packages.json", UpdateOptions{}); err != nil {
+		t.Fatalf("Ожидалось успешное обновление, но получена ошибка: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "plugin.txt")); !os.IsNotExist(err) {
+		t.Errorf("Файл прежней директории установки не удален: %v", err)
+	}
+	if data, err := os.ReadFile("plugin.txt"); err != nil || string(data) != "plugin-2.0" {
+		t.Errorf("Ожидалась установка в корень, получено %q (%v)", data, err)
+	}
+}
+
+// TestInstalledPackages проверяет базу установленных пакетов, удаление файлов прежней версии и pm remove
+func TestInstalledPackages(t *testing.T) {
+	tempDir := t.TempDir()
+	prefix := filepath.Join(tempDir, "root")
+
+	remote := map[string][]byte{}
+	publishTestPackage(t, remote, "app", map[string][]models.Package{"1.0": nil, "2.0": nil})
+	publishTestPackage(t, remote, "tools", map[string][]models.Package{"1.0": nil})
+	replaceTestArchive(t, remote, "app", "1.0", buildTestZipData(t, []testZipEntry{
+		{name: "bin/app", data: "app 1.0"},
+		{name: "share/app/old.txt", data: "old"},
+		{name: "share/common.txt", data: "common"},
+	}))
+	replaceTestArchive(t, remote, "app", "2.0", buildTestZipData(t, []testZipEntry{
+		{name: "bin/app", data: "app 2.0"},
+		{name: "share/common.txt", data: "common"},
+		{name: "var/app/", mode: fs.ModeDir | 0755},
+	}))
+	replaceTestArchive(t, remote, "tools", "1.0", buildTestZipData(t, []testZipEntry{
+		{name: "bin/tool", data: "tool"},
+		{name: "share/common.txt", data: "common"},
+	}))
+	pm := NewPackageManager(&config.Config{}, newMemoryRemote(remote))
+
+	update := func(configData string) {
+		t.Helper()
+		configFile := filepath.Join(tempDir, "packages.json")
+		if err := os.WriteFile(configFile, []byte(configData), 0644); err != nil {
+			t.Fatalf("Не удалось создать файл конфигурации: %v", err)
+		}
+		if err := pm.UpdatePackages(t.Context(), configFile, UpdateOptions{Prefix: prefix}); err != nil {
+			t.Fatalf("Ожидалось успешное обновление, но получена ошибка: %v", err)
+		}
+	}
+	exists := func(name string) bool {
+		_, err := os.Lstat(filepath.Join(prefix, filepath.FromSlash(name)))
+		return err == nil
+	}
+
+	update(`{"signature": "none", "packages": [{"name": "app", "ver": "1.0"}, {"name": "tools"}]}`)
+	installed, err := ListInstalled(prefix)
+	if err != nil {
+		t.Fatalf("Ошибка чтения базы установленных пакетов: %v", err)
+	}
+	if len(installed) != 2 || installed[0].Name != "app" || installed[0].Ver != "1.0" || installed[1].Name != "tools" {
+		t.Fatalf("Неожиданные установленные пакеты: %+v", installed)
+	}
+	if got, want := strings.Join(installed[1].Files, ","), "bin/tool,share/common.txt"; got != want {
+		t.Errorf("Ожидались файлы %s, получено %s", want, got)
+	}
+	if installed[0].Checksum != archiveChecksum(remote[archivePath("app", "1.0", "")]) {
+		t.Errorf("Неожиданная контрольная сумма %s", installed[0].Checksum)
+	}
+
+	// Новая версия удаляет файлы прежней, которых в ней нет
+	update(`{"signature": "none", "packages": [{"name": "app", "ver": "2.0"}, {"name": "tools"}]}`)
+	if exists("share/app") || !exists("share/common.txt") || !exists("var/app") {
+		t.Error("Ожидалось удаление файлов версии 1.0 и установка версии 2.0")
+	}
+
+	if err := RemovePackage(prefix, "app"); err != nil {
+		t.Fatalf("Ошибка удаления пакета: %v", err)
+	}
+	for _, name := range []string{"bin/app", "var"} {
+		if exists(name) {
+			t.Errorf("%s должен быть удален вместе с пакетом", name)
+		}
+	}
+	if !exists("bin/tool") || !exists("share/common.txt") {
+		t.Error("Файлы, принадлежащие другому пакету, не должны удаляться")
+	}
+	if installed, _ := ListInstalled(prefix); len(installed) != 1 || installed[0].Name != "tools" {
+		t.Errorf("Ожидался один установленный пакет tools, получено %+v", installed)
+	}
+	if err := RemovePackage(prefix, "app"); err == nil {
+		t.Error("Ожидалась ошибка удаления неустановленного пакета")
+	}
+}
+
+// TestUpdatePackagesRollback проверяет, что неудачная установка не меняет установленные файлы,
+// а pm rollback возвращает предыдущую версию
+func TestUpdatePackagesRollback(t *testing.T) {
+	tempDir := t.TempDir()
+	prefix := filepath.Join(tempDir, "root")
+
+	remote := map[string][]byte{}
+	publishTestPackage(t, remote, "app", map[string][]models.Package{"1.0": nil, "2.0": nil})
+	replaceTestArchive(t, remote, "app", "1.0", buildTestZipData(t, []testZipEntry{
+		{name: "bin/app", data: "1.0"},
+		{name: "share/old.txt", data: "old"},
+	}))
+	replaceTestArchive(t, remote, "app", "2.0", buildTestZipData(t, []testZipEntry{
+		{name: "bin/app", data: "2.0"},
+		{name: "etc/app.conf", data: "conf"},
+	}))
+	pm := NewPackageManager(&config.Config{}, newMemoryRemote(remote))
+
+	update := func(ver string) error {
+		t.Helper()
+		configFile := filepath.Join(tempDir, "packages.json")
+		configData := `{"signature": "none", "packages": [{"name": "app", "ver": "` + ver + `"}]}`
+		if err := os.WriteFile(configFile, []byte(configData), 0644); err != nil {
+			t.Fatalf("Не удалось создать файл конфигурации: %v", err)
+		}
+		return pm.UpdatePackages(t.Context(), configFile, UpdateOptions{Prefix: prefix})
+	}
+	// check сверяет установленную версию с базой и файлами на диске
+	check := func(ver string, files map[string]string) {
+		t.Helper()
+		installed, err := ListInstalled(prefix)
+		if err != nil || len(installed) != 1 || installed[0].Ver != ver {
+			t.Fatalf("Ожидалась установленная версия %s, получено %+v (%v)", ver, installed, err)
+		}
+		for name, want := range files {
+			data, err := os.ReadFile(filepath.Join(prefix, filepath.FromSlash(name)))
+			if want == "" {
+				if !os.IsNotExist(err) {
+					t.Errorf("Файл %s не должен существовать: %v", name, err)
+				}
+			} else if err != nil || string(data) != want {
+				t.Errorf("Ожидался файл %s с содержимым %q, получено %q (%v)", name, want, data, err)
+			}
+		}
+	}
+
+	if err := update("1.0"); err != nil {
+		t.Fatalf("Ожидалось успешное обновление, но получена ошибка: %v", err)
+	}
+	check("1.0", map[string]string{"bin/app": "1.0", "share/old.txt": "old"})
+
+	// Директория на месте файла новой версии прерывает перенос: bin/app уже заменен и возвращается обратно
+	if err := os.MkdirAll(filepath.Join(prefix, "etc", "app.conf"), 0755); err != nil {
+		t.Fatalf("Не удалось создать директорию: %v", err)
+	}
+	if err := update("2.0"); err == nil || !strings.Contains(err.Error(), "отменена") {
+		t.Fatalf("Ожидалась ошибка установки, получено: %v", err)
+	}
+	check("1.0", map[string]string{"bin/app": "1.0", "share/old.txt": "old"})
+	if entries, _ := os.ReadDir(filepath.Join(prefix, ".pm", "staging")); len(entries) != 0 {
+		t.Errorf("После неудачной установки остались временные файлы: %v", entries)
+	}
+
+	// Небезопасный архив отклоняется до переноса
+	original := remote[archivePath("app", "2.0", "")]
+	replaceTestArchive(t, remote, "app", "2.0", buildTestZipData(t, []testZipEntry{{name: "bin/app", data: "evil"}, {name: "../x", data: "evil"}}))
+	var extractErr *ExtractError
+	if err := update("2.0"); !errors.As(err, &extractErr) {
+		t.Fatalf("Ожидалась ошибка ExtractError, получено: %v", err)
+	}
+	check("1.0", map[string]string{"bin/app": "1.0"})
+	replaceTestArchive(t, remote, "app", "2.0", original)
+
+	if err := os.Remove(filepath.Join(prefix, "etc", "app.conf")); err != nil {
+		t.Fatalf("Не удалось удалить директорию: %v", err)
+	}
+	if err := update("2.0"); err != nil {
+		t.Fatalf("Ожидалось успешное обновление, но получена ошибка: %v", err)
+	}
+	check("2.0", map[string]string{"bin/app": "2.0", "etc/app.conf": "conf", "share/old.txt": ""})
+
+	// Откат возвращает файлы версии 1.0, повторный откат - версии 2.0
+	if err := RollbackPackage(prefix, "app"); err != nil {
+		t.Fatalf("Ошибка отката: %v", err)
+	}
+	check("1.0", map[string]string{"bin/app": "1.0", "share/old.txt": "old", "etc/app.conf": ""})
+	if err := RollbackPackage(prefix, "app"); err != nil {
+		t.Fatalf("Ошибка отката: %v", err)
+	}
+	check("2.0", map[string]string{"bin/app": "2.0", "etc/app.conf": "conf", "share/old.txt": ""})
+
+	if err := RemovePackage(prefix, "app"); err != nil {
+		t.Fatalf("Ошибка удаления пакета: %v", err)
+	}
+	if err := RollbackPackage(prefix, "app"); err == nil {
+		t.Error("Ожидалась ошибка отката неустановленного пакета")
+	}
+	if _, err := os.Stat(filepath.Join(prefix, ".pm", "backup", "app")); !os.IsNotExist(err) {
+		t.Errorf("Копия предыдущей версии должна удаляться вместе с пакетом: %v", err)
+	}
+}
+
+// TestUpdatePackagesParallelDownloads проверяет ограничение числа одновременных скачиваний
+// и установку в порядке зависимостей независимо от порядка завершения скачиваний
+func TestUpdatePackagesParallelDownloads(t *testing.T) {
+	tempDir := t.TempDir()
+	prefix := filepath.Join(tempDir, "root")
+
+	remote := map[string][]byte{}
+	publishTestPackage(t, remote, "lib", map[string][]models.Package{"1.0": nil})
+	publishTestPackage(t, remote, "mid", map[string][]models.Package{"1.0": {{Name: "lib"}}})
+	publishTestPackage(t, remote, "app", map[string][]models.Package{"1.0": {{Name: "mid"}}})
+	publishTestPackage(t, remote, "tool", map[string][]models.Package{"1.0": nil})
+	// Все пакеты пишут один и тот же файл: после установки в нем содержимое последнего пакета
+	for _, name := range []string{"lib", "mid", "app", "tool"} {
+		replaceTestArchive(t, remote, name, "1.0", buildTestZipData(t, []testZipEntry{{name: "last.txt", data: name}}))
+	}
+
+	var active, maxActive atomic.Int32
+	mockBackend := newMemoryRemote(remote)
+	download := mockBackend.DownloadFileFunc
+	mockBackend.DownloadFileFunc = func(fileName string, w io.Writer) error {
+		if strings.HasSuffix(fileName, ".zip") {
+			n := active.Add(1)
+			defer active.Add(-1)
+			for m := maxActive.Load(); n > m && !maxActive.CompareAndSwap(m, n); m = maxActive.Load() {
+			}
+			// Первый по порядку установки пакет скачивается дольше остальных
+			delay := 20 * time.Millisecond
+			if strings.HasPrefix(fileName, "lib/") {
+				delay = 100 * time.Millisecond
+			}
+			time.Sleep(delay)
+		}
+		return download(fileName, w)
+	}
+	pm := NewPackageManager(&config.Config{}, mockBackend)
+
+	configFile := filepath.Join(tempDir, "packages.json")
+	configData := []byte(`{"signature": "none", "packages": [{"name": "app"}, {"name": "tool"}]}`)
+	if err := os.WriteFile(configFile, configData, 0644); err != nil {
+		t.Fatalf("Не удалось создать файл конфигурации: %v", err)
+	}
+	if err := pm.UpdatePackages(t.Context(), configFile, UpdateOptions{Prefix: prefix, Jobs: 3}); err != nil {
+		t.Fatalf("Ожидалось успешное обновление, но получена ошибка: %v", err)
+	}
+
+	if n := maxActive.Load(); n < 2 || n > 3 {
+		t.Errorf("Ожидалось от 2 до 3 одновременных скачиваний, получено %d", n)
+	}
+	lock, err := readLockFile(filepath.Join(tempDir, "packages.lock"), ".json")
+	if err != nil || len(lock.Packages) != 4 {
+		t.Fatalf("Ожидался lock-файл с 4 пакетами, получено %+v (%v)", lock, err)
+	}
+	last := lock.Packages[len(lock.Packages)-1].Name
+	if data, err := os.ReadFile(filepath.Join(prefix, "last.txt")); err != nil || string(data) != last {
+		t.Errorf("Ожидалась установка в порядке lock-файла (последний %s), получено %q (%v)", last, data, err)
+	}
+}
+
+// TestDownloadPoolCancelled проверяет, что отмена не оставляет ожидание архива, который так и не попал в очередь
+func TestDownloadPoolCancelled(t *testing.T) {
+	remote := map[string][]byte{}
+	publishTestPackage(t, remote, "a", map[string][]models.Package{"1.0": nil})
+	publishTestPackage(t, remote, "b", map[string][]models.Package{"1.0": nil})
+	started, release := make(chan struct{}), make(chan struct{})
+	mockBackend := newMemoryRemote(remote)
+	download := mockBackend.DownloadFileFunc
+	mockBackend.DownloadFileFunc = func(fileName string, w io.Writer) error {
+		if fileName == archivePath("a", "1.0", "") {
+			close(started)
+			<-release
+		}
+		return download(fileName, w)
+	}
+	pm := NewPackageManager(&config.Config{}, mockBackend)
+
+	// Единственный поток занят первым архивом, поэтому второй к моменту отмены не поставлен в очередь
+	ctx, cancel := context.WithCancel(t.Context())
+	downloads := pm.startDownloads(ctx, []models.LockedPackage{{Name: "a", Ver: "1.0"}, {Name: "b", Ver: "1.0"}}, 1)
+	defer downloads.Close()
+	<-started
+	cancel()
+	close(release)
+
+	result := make(chan error, 1)
+	go func() {
+		_, _, err := downloads.wait(ctx, 1)
+		result <- err
+	}()
+	select {
+	case err := <-result:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Ожидалась ошибка context.Canceled, получено: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Ожидание архива не прервано отменой")
+	}
+}
+
+// TestUpdatePackagesCancelledBetweenInstalls проверяет отмену после установки первого пакета при jobs=1:
+// обновление завершается ошибкой отмены, оставшиеся пакеты не устанавливаются, lock-файл не записывается
+func TestUpdatePackagesCancelledBetweenInstalls(t *testing.T) {
+	tempDir := t.TempDir()
+	prefix := filepath.Join(tempDir, "root")
+
+	remote := map[string][]byte{}
+	publishTestPackage(t, remote, "a", map[string][]models.Package{"1.0": nil})
+	publishTestPackage(t, remote, "b", map[string][]models.Package{"1.0": {{Name: "a"}}})
+	publishTestPackage(t, remote, "c", map[string][]models.Package{"1.0": {{Name: "b"}}})
+
+	ctx, cancel := context.WithCancel(t.Context())
+	mockBackend := newMemoryRemote(remote)
+	download := mockBackend.DownloadFileFunc
+	mockBackend.DownloadFileFunc = func(fileName string, w io.Writer) error {
+		// Второй архив отдается только после установки первого пакета, и тогда же приходит отмена
+		if fileName == archivePath("b", "1.0", "") {
+			for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+				if _, err := os.Stat(filepath.Join(prefix, "a.txt")); err == nil {
+					break
+				}
+			}
+			cancel()
+		}
+		return download(fileName, w)
+	}
+	pm := NewPackageManager(&config.Config{}, mockBackend)
+
+	configFile := filepath.Join(tempDir, "packages.json")
+	if err := os.WriteFile(configFile, []byte(`{"signature": "none", "packages": [{"name": "c"}]}`), 0644); err != nil {
+		t.Fatalf("Не удалось создать файл конфигурации: %v", err)
+	}
+	result := make(chan error, 1)
+	go func() { result <- pm.UpdatePackages(ctx, configFile, UpdateOptions{Prefix: prefix, Jobs: 1}) }()
+	select {
+	case err := <-result:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("Ожидалась ошибка context.Canceled, получено: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Обновление не завершилось после отмены")
+	}
+
+	if _, err := os.Stat(filepath.Join(prefix, "a.txt")); err != nil {
+		t.Errorf("Ожидался установленный до отмены пакет a: %v", err)
+	}
+	for _, name := range []string{"b.txt", "c.txt"} {
+		if _, err := os.Stat(filepath.Join(prefix, name)); !os.IsNotExist(err) {
+			t.Errorf("Файл %s не должен устанавливаться после отмены: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(lockFilePath(configFile)); !os.IsNotExist(err) {
+		t.Errorf("Lock-файл не должен записываться после отмены: %v", err)
+	}
+}
+
+// TestCancelledOperations проверяет, что прерванные create и update не оставляют следов
+func TestCancelledOperations(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Chdir(tempDir)
+	writeTestTree(t, tempDir, map[string]string{
+		"app.txt":     "app",
+		"packet.json": `{"name": "app", "ver": "1.0", "targets": [{"path": "./app.txt"}]}`,
+	})
+
+	remote := map[string][]byte{}
+	mockBackend := newMemoryRemote(remote)
+	pm := NewPackageManager(&config.Config{}, mockBackend)
+
+	// Прерывание во время загрузки архива: временный файл удаляется
+	ctx, cancel := context.WithCancel(t.Context())
+	upload := mockBackend.UploadFileFunc
+	mockBackend.UploadFileFunc = func(fileName string, data io.Reader, size int64) error {
+		remote[fileName] = []byte("partial")
+		cancel()
+		return context.Canceled
+	}
+	if err := pm.CreatePackage(ctx, "packet.json", CreateOptions{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Ожидалась ошибка context.Canceled, получено: %v", err)
+	}
+	if len(remote) != 0 {
+		t.Errorf("В хранилище остались файлы прерванной загрузки: %v", remote)
+	}
+
+	// Прерывание во время обновления индекса: архив без записи в индексе удаляется
+	ctx, cancel = context.WithCancel(t.Context())
+	mockBackend.UploadFileFunc = upload
+	rename := mockBackend.RenameFunc
+	mockBackend.RenameFunc = func(oldName, newName string) error {
+		if newName == "app/index.json" {
+			cancel()
+			return context.Canceled
+		}
+		return rename(oldName, newName)
+	}
+	if err := pm.CreatePackage(ctx, "packet.json", CreateOptions{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Ожидалась ошибка context.Canceled, получено: %v", err)
+	}
+	if len(remote) != 0 {
+		t.Errorf("В хранилище остались файлы прерванной публикации: %v", remote)
+	}
+	mockBackend.RenameFunc = rename
+	if err := pm.CreatePackage(t.Context(), "packet.json", CreateOptions{}); err != nil {
+		t.Fatalf("Ожидалась успешная повторная публикация, получено: %v", err)
+	}
+
+	// Прерывание во время скачивания: ничего не установлено, lock-файл не записан
+	configFile := filepath.Join(tempDir, "packages.json")
+	if err := os.WriteFile(configFile, []byte(`{"signature": "none", "packages": [{"name": "app"}]}`), 0644); err != nil {
+		t.Fatalf("Не удалось создать файл конфигурации: %v", err)
+	}
+	prefix := filepath.Join(tempDir, "root")
+	ctx, cancel = context.WithCancel(t.Context())
+	mockBackend.DownloadFileFunc = func(fileName string, w io.Writer) error {
+		if strings.HasSuffix(fileName, ".zip") {
+			w.Write([]byte("PK"))
+			cancel()
+			return context.Canceled
+		}
+		return newMemoryRemote(remote).DownloadFileFunc(fileName, w)
+	}
+	if err := pm.UpdatePackages(ctx, configFile, UpdateOptions{Prefix: prefix}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Ожидалась ошибка context.Canceled, получено: %v", err)
+	}
+	if _, err := os.Stat(lockFilePath(configFile)); !os.IsNotExist(err) {
+		t.Errorf("Lock-файл не должен записываться после отмены: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(prefix, "app.txt")); !os.IsNotExist(err) {
+		t.Errorf("Пакет не должен устанавливаться после отмены: %v", err)
+	}
+}
+
+// TestSpoolFile проверяет подсчет размера и контрольной суммы временного файла архива
+func TestSpoolFile(t *testing.T) {
+	spool, err := newSpoolFile()
+	if err != nil {
+		t.Fatalf("Не удалось создать временный файл: %v", err)
+	}
+	name := spool.file.Name()
+
+	data := bytes.Repeat([]byte("0123456789"), 100000)
+	if _, err := io.Copy(spool, bytes.NewReader(data)); err != nil {
+		t.Fatalf("Ошибка записи: %v", err)
+	}
+	if spool.Size() != int64(len(data)) || spool.Checksum() != archiveChecksum(data) {
+		t.Errorf("Неожиданные размер %d или контрольная сумма %s", spool.Size(), spool.Checksum())
+	}
+
+	// Чтение с начала можно повторять
+	for i := 0; i < 2; i++ {
+		read, err := io.ReadAll(spool.Reader())
+		if err != nil || !bytes.Equal(read, data) {
+			t.Fatalf("Прочитанные данные не совпадают (%v)", err)
+		}
+	}
+
+	if err := spool.Close(); err != nil {
+		t.Fatalf("Ошибка закрытия: %v", err)
+	}
+	if _, err := os.Stat(name); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Временный файл должен удаляться при закрытии: %v", err)
+	}
 }
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"package-manager/internal/models"
+	"package-manager/internal/semver"
+)
+
+// remoteSource предоставляет резолверу версии и зависимости пакетов из индексов на сервере.
+// Интерфейс резолвера не принимает контекст, поэтому контекст разрешения хранится в источнике
+type remoteSource struct {
+	ctx     context.Context
+	pm      *PackageManager
+	indexes map[string]*models.PackageIndex
+}
+
+func newRemoteSource(ctx context.Context, pm *PackageManager) *remoteSource {
+	return &remoteSource{ctx: ctx, pm: pm, indexes: make(map[string]*models.PackageIndex)}
+}
+
+// index читает индекс пакета один раз за время разрешения зависимостей
+func (s *remoteSource) index(name string) (*models.PackageIndex, error) {
+	if index, ok := s.indexes[name]; ok {
+		return index, nil
+	}
+	index, err := s.pm.readPackageIndex(s.ctx, name)
+	if errors.Is(err, ErrPackageNotFound) {
+		index, err = &models.PackageIndex{Name: name}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.indexes[name] = index
+	return index, nil
+}
+
+// Versions возвращает опубликованные версии пакета
+func (s *remoteSource) Versions(name string) ([]semver.Version, error) {
+	index, err := s.index(name)
+	if err != nil {
+		return nil, err
+	}
+	var versions []semver.Version
+	for _, entry := range index.Versions {
+		// Некорректные записи индекса пропускаются, чтобы не блокировать остальные версии
+		if v, err := semver.Parse(entry.Ver); err == nil {
+			versions = append(versions, v)
+		}
+	}
+	return versions, nil
+}
+
+// Dependencies возвращает зависимости версии пакета из индекса
+func (s *remoteSource) Dependencies(name string, version semver.Version) ([]models.Package, error) {
+	entry, err := s.entry(name, version)
+	if err != nil {
+		return nil, err
+	}
+	return entry.Packets, nil
+}
+
+// entry возвращает запись индекса для версии пакета
+func (s *remoteSource) entry(name string, version semver.Version) (*models.IndexEntry, error) {
+	index, err := s.index(name)
+	if err != nil {
+		return nil, err
+	}
+	if entry := indexEntry(index, version); entry != nil {
+		return entry, nil
+	}
+	return nil, fmt.Errorf("версия %s пакета %s отсутствует в индексе", version.Original(), name)
+}
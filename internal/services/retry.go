@@ -0,0 +1,285 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"package-manager/internal/config"
+)
+
+// ErrTransferTimeout возвращается, если данные не передавались дольше допустимого времени (PM_TRANSFER_TIMEOUT)
+var ErrTransferTimeout = errors.New("передача прервана: данные не поступают дольше допустимого времени")
+
+// Задержки между повторами: удваиваются после каждой попытки, но не превышают maxRetryDelay
+const (
+	baseRetryDelay = time.Second
+	maxRetryDelay  = 30 * time.Second
+)
+
+// resumableBackend - хранилище, которое умеет скачивать файл начиная с заданного смещения.
+// Используется для продолжения прерванного скачивания
+type resumableBackend interface {
+	DownloadFileFrom(ctx context.Context, fileName string, offset int64, w io.Writer) error
+}
+
+// retryBackend повторяет операции хранилища при временных ошибках сети с экспоненциальной задержкой.
+// Прерванное скачивание продолжается с полученного смещения, если хранилище это поддерживает,
+// иначе файл скачивается заново, а уже записанные байты пропускаются.
+// Если Delete или Rename выполнились, но ответ потерялся, повтор завершится ошибкой отсутствия файла
+type retryBackend struct {
+	Backend
+	retries   int
+	baseDelay time.Duration
+}
+
+// withRetries оборачивает хранилище повторами по настройкам. При нулевом числе повторов
+// хранилище возвращается как есть
+func withRetries(backend Backend, cfg *config.Config) Backend {
+	if cfg.Retries <= 0 {
+		return backend
+	}
+	return &retryBackend{Backend: backend, retries: cfg.Retries, baseDelay: baseRetryDelay}
+}
+
+// retry выполняет op, повторяя ее при временных ошибках. Отмена ctx прерывает ожидание повтора
+func (b *retryBackend) retry(ctx context.Context, what string, op func() error) error {
+	delay := b.baseDelay
+	for attempt := 1; ; attempt++ {
+		err := contextError(ctx, op())
+		if err == nil || attempt > b.retries || !isTransient(err) {
+			return err
+		}
+		log.Printf("%s: %v. Повтор через %s (попытка %d из %d)...", what, err, delay, attempt, b.retries)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return contextError(ctx, err)
+		}
+		delay = min(delay*2, maxRetryDelay)
+	}
+}
+
+// UploadFile повторяет загрузку, если данные можно прочитать заново с начала
+func (b *retryBackend) UploadFile(ctx context.Context, fileName string, data io.Reader, size int64) error {
+	seeker, ok := data.(io.Seeker)
+	if !ok {
+		return b.Backend.UploadFile(ctx, fileName, data, size)
+	}
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return b.Backend.UploadFile(ctx, fileName, data, size)
+	}
+	return b.retry(ctx, "Ошибка загрузки "+fileName, func() error {
+		if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+			return err
+		}
+		return b.Backend.UploadFile(ctx, fileName, data, size)
+	})
+}
+
+// DownloadFile повторяет скачивание, продолжая его с уже полученного смещения
+func (b *retryBackend) DownloadFile(ctx context.Context, fileName string, w io.Writer) error {
+	cw := &countingWriter{w: w}
+	return b.retry(ctx, "Ошибка скачивания "+fileName, func() error {
+		if cw.n == 0 {
+			return b.Backend.DownloadFile(ctx, fileName, cw)
+		}
+		if resumable, ok := b.Backend.(resumableBackend); ok {
+			log.Printf("Продолжение скачивания %s с %d байт...", fileName, cw.n)
+			return resumable.DownloadFileFrom(ctx, fileName, cw.n, cw)
+		}
+		return b.Backend.DownloadFile(ctx, fileName, &skipWriter{w: cw, skip: cw.n})
+	})
+}
+
+// List повторяет получение содержимого директории
+func (b *retryBackend) List(ctx context.Context, dir string) ([]FileInfo, error) {
+	var files []FileInfo
+	err := b.retry(ctx, "Ошибка получения списка файлов "+dir, func() error {
+		var err error
+		files, err = b.Backend.List(ctx, dir)
+		return err
+	})
+	return files, err
+}
+
+// Stat повторяет получение информации о файле
+func (b *retryBackend) Stat(ctx context.Context, fileName string) (*FileInfo, error) {
+	var info *FileInfo
+	err := b.retry(ctx, "Ошибка получения информации о "+fileName, func() error {
+		var err error
+		info, err = b.Backend.Stat(ctx, fileName)
+		return err
+	})
+	return info, err
+}
+
+// Delete повторяет удаление файла
+func (b *retryBackend) Delete(ctx context.Context, fileName string) error {
+	return b.retry(ctx, "Ошибка удаления "+fileName, func() error {
+		return b.Backend.Delete(ctx, fileName)
+	})
+}
+
+// Rename повторяет переименование файла
+func (b *retryBackend) Rename(ctx context.Context, oldName, newName string) error {
+	return b.retry(ctx, "Ошибка переименования "+oldName, func() error {
+		return b.Backend.Rename(ctx, oldName, newName)
+	})
+}
+
+// isTransient сообщает, что ошибка вызвана сбоем сети и операцию имеет смысл повторить.
+// Отсутствие файла, запрет доступа и ошибки протокола не повторяются
+func isTransient(err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return false
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, fs.ErrPermission),
+		errors.Is(err, ErrReadOnly), errors.Is(err, ErrOffline):
+		return false
+	case errors.Is(err, ErrTransferTimeout), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, sftp.ErrSSHFxConnectionLost),
+		errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNABORTED),
+		errors.Is(err, syscall.EPIPE), errors.Is(err, syscall.ETIMEDOUT),
+		errors.Is(err, syscall.ENETUNREACH), errors.Is(err, syscall.EHOSTUNREACH):
+		return true
+	}
+	var netErr net.Error
+	var exitMissing *ssh.ExitMissingError
+	var statusErr *httpStatusError
+	switch {
+	case errors.As(err, &netErr), errors.As(err, &exitMissing):
+		return true
+	case errors.As(err, &statusErr):
+		return statusErr.code >= 500 || statusErr.code == 429
+	}
+	return false
+}
+
+// countingWriter считает записанные байты
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// skipWriter отбрасывает первые skip байт: при повторном скачивании с начала они уже записаны
+type skipWriter struct {
+	w    io.Writer
+	skip int64
+}
+
+func (s *skipWriter) Write(p []byte) (int, error) {
+	total := len(p)
+	if s.skip > 0 {
+		n := min(int64(len(p)), s.skip)
+		s.skip -= n
+		p = p[n:]
+	}
+	if len(p) == 0 {
+		return total, nil
+	}
+	if _, err := s.w.Write(p); err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// idleTimer прерывает передачу, если данные не передавались дольше timeout.
+// По истечении времени вызывается abort, который должен закрыть сессию передачи, чтобы
+// заблокированные чтение и запись завершились ошибкой. Нулевой timeout отключает таймер
+type idleTimer struct {
+	timeout time.Duration
+	timer   *time.Timer
+	mu      sync.Mutex
+	expired bool
+}
+
+// startIdleTimer запускает таймер. Возвращает nil, если timeout не задан: методы nil-таймера ничего не делают
+func startIdleTimer(timeout time.Duration, abort func()) *idleTimer {
+	if timeout <= 0 {
+		return nil
+	}
+	t := &idleTimer{timeout: timeout}
+	t.timer = time.AfterFunc(timeout, func() {
+		t.mu.Lock()
+		t.expired = true
+		t.mu.Unlock()
+		abort()
+	})
+	return t
+}
+
+// touch откладывает срабатывание таймера после передачи очередной порции данных
+func (t *idleTimer) touch() {
+	if t != nil {
+		t.timer.Reset(t.timeout)
+	}
+}
+
+// stop останавливает таймер и переводит ошибку прерванной им передачи в ErrTransferTimeout
+func (t *idleTimer) stop(err error) error {
+	if t == nil {
+		return err
+	}
+	t.timer.Stop()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.expired && err != nil {
+		return fmt.Errorf("%w (%s): %v", ErrTransferTimeout, t.timeout, err)
+	}
+	return err
+}
+
+// writer возвращает поток, который откладывает срабатывание таймера при каждой записи
+func (t *idleTimer) writer(w io.Writer) io.Writer {
+	if t == nil {
+		return w
+	}
+	return &idleWriter{w: w, t: t}
+}
+
+// reader возвращает поток, который откладывает срабатывание таймера при каждом чтении
+func (t *idleTimer) reader(r io.Reader) io.Reader {
+	if t == nil {
+		return r
+	}
+	return &idleReader{r: r, t: t}
+}
+
+type idleWriter struct {
+	w io.Writer
+	t *idleTimer
+}
+
+func (w *idleWriter) Write(p []byte) (int, error) {
+	w.t.touch()
+	return w.w.Write(p)
+}
+
+type idleReader struct {
+	r io.Reader
+	t *idleTimer
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	r.t.touch()
+	return r.r.Read(p)
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"package-manager/internal/config"
+)
+
+// TestRetryBackend проверяет повторы при временных ошибках и отказ от повторов при постоянных
+func TestRetryBackend(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 100)
+	remote := map[string][]byte{"pkg/pkg-1.0.zip": data}
+	mockBackend := newMemoryRemote(remote)
+
+	// Соединение рвется на середине файла: хранилище без продолжения скачивает файл заново,
+	// уже записанная часть пропускается
+	var downloads, uploads int
+	mockBackend.DownloadFileFunc = func(fileName string, w io.Writer) error {
+		downloads++
+		data, ok := remote[fileName]
+		if !ok {
+			return fs.ErrNotExist
+		}
+		if downloads == 1 {
+			w.Write(data[:len(data)/2])
+			return io.ErrUnexpectedEOF
+		}
+		_, err := w.Write(data)
+		return err
+	}
+	upload := mockBackend.UploadFileFunc
+	mockBackend.UploadFileFunc = func(fileName string, r io.Reader, size int64) error {
+		uploads++
+		if uploads == 1 {
+			io.CopyN(io.Discard, r, size/2)
+			return io.ErrUnexpectedEOF
+		}
+		return upload(fileName, r, size)
+	}
+	backend := &retryBackend{Backend: mockBackend, retries: 2, baseDelay: time.Millisecond}
+
+	buf, err := downloadBytes(backend, "pkg/pkg-1.0.zip")
+	if err != nil || !bytes.Equal(buf, data) {
+		t.Fatalf("Ожидалось скачивание после повтора, получено %d байт (%v)", len(buf), err)
+	}
+	if err := uploadBytes(backend, "pkg/index.json", data); err != nil {
+		t.Fatalf("Ожидалась загрузка после повтора: %v", err)
+	}
+	if !bytes.Equal(remote["pkg/index.json"], data) {
+		t.Error("Повторная загрузка должна передавать данные с начала")
+	}
+
+	// Отсутствие файла не повторяется
+	downloads = 0
+	if _, err := downloadBytes(backend, "pkg/missing.zip"); !errors.Is(err, fs.ErrNotExist) || downloads != 1 {
+		t.Errorf("Ожидалась одна попытка и fs.ErrNotExist, получено %d попыток (%v)", downloads, err)
+	}
+
+	// Число повторов ограничено
+	mockBackend.StatFunc = func(fileName string) (*FileInfo, error) {
+		downloads++
+		return nil, ErrTransferTimeout
+	}
+	downloads = 0
+	if _, err := backend.Stat(t.Context(), "pkg/index.json"); !errors.Is(err, ErrTransferTimeout) || downloads != 3 {
+		t.Errorf("Ожидалось 3 попытки и ErrTransferTimeout, получено %d попыток (%v)", downloads, err)
+	}
+}
+
+// TestHTTPBackendResume проверяет прерывание зависшей передачи и продолжение скачивания с заголовком Range
+func TestHTTPBackendResume(t *testing.T) {
+	data := bytes.Repeat([]byte("PK\x03\x04\x00"), 4096)
+	var requests atomic.Int32
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			// Первый ответ обрывается на середине: сервер перестает присылать данные
+			w.Header().Set("Content-Length", "20480")
+			w.Write(data[:len(data)/2])
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			return
+		}
+		ranges = append(ranges, r.Header.Get("Range"))
+		http.ServeContent(w, r, "pkg.zip", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{Repository: server.URL, TransferTimeout: 100 * time.Millisecond}
+	_, err := downloadBytes(NewHTTPBackend(cfg), "pkg.zip")
+	if !errors.Is(err, ErrTransferTimeout) {
+		t.Fatalf("Ожидалась ошибка ErrTransferTimeout, получено: %v", err)
+	}
+
+	requests.Store(0)
+	backend := &retryBackend{Backend: NewHTTPBackend(cfg), retries: 1, baseDelay: time.Millisecond}
+	buf, err := downloadBytes(backend, "pkg.zip")
+	if err != nil || !bytes.Equal(buf, data) {
+		t.Fatalf("Ожидалось скачивание после повтора, получено %d байт (%v)", len(buf), err)
+	}
+	if len(ranges) != 1 || !strings.HasPrefix(ranges[0], "bytes=") || ranges[0] == "bytes=0-" {
+		t.Errorf("Ожидалось продолжение скачивания с заголовком Range, получено %q", ranges)
+	}
+}
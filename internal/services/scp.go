@@ -0,0 +1,178 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Байты подтверждения протокола SCP
+const (
+	scpOK      byte = 0
+	scpWarning byte = 1
+	scpFatal   byte = 2
+)
+
+// SCPError - сообщение об ошибке, полученное от удаленной стороны SCP.
+// Fatal различает фатальные ошибки (\x02) и предупреждения (\x01)
+type SCPError struct {
+	Fatal   bool
+	Message string
+}
+
+func (e *SCPError) Error() string {
+	if e.Fatal {
+		return "фатальная ошибка SCP: " + e.Message
+	}
+	return "ошибка SCP: " + e.Message
+}
+
+// Unwrap позволяет проверять отсутствие файла через errors.Is(err, fs.ErrNotExist)
+func (e *SCPError) Unwrap() error {
+	if strings.Contains(e.Message, "No such file or directory") {
+		return fs.ErrNotExist
+	}
+	return nil
+}
+
+// scpHeader - заголовок файла "C<mode> <size> <name>"
+type scpHeader struct {
+	Mode os.FileMode
+	Size int64
+	Name string
+}
+
+// parseSCPHeader разбирает заголовок файла без ведущего 'C' и перевода строки
+func parseSCPHeader(line string) (scpHeader, error) {
+	fields := strings.SplitN(line, " ", 3)
+	if len(fields) != 3 {
+		return scpHeader{}, fmt.Errorf("некорректный заголовок SCP: %q", line)
+	}
+	mode, err := strconv.ParseUint(fields[0], 8, 32)
+	if err != nil {
+		return scpHeader{}, fmt.Errorf("некорректные права в заголовке SCP: %q", line)
+	}
+	size, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || size < 0 {
+		return scpHeader{}, fmt.Errorf("некорректный размер в заголовке SCP: %q", line)
+	}
+	if fields[2] == "" || strings.Contains(fields[2], "/") {
+		return scpHeader{}, fmt.Errorf("некорректное имя файла в заголовке SCP: %q", line)
+	}
+	return scpHeader{Mode: os.FileMode(mode).Perm(), Size: size, Name: fields[2]}, nil
+}
+
+// readSCPMessage читает текст сообщения после байта \x01 или \x02
+func readSCPMessage(r *bufio.Reader, fatal bool) error {
+	msg, err := r.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("ошибка чтения сообщения SCP: %w", err)
+	}
+	return &SCPError{Fatal: fatal, Message: strings.TrimSpace(msg)}
+}
+
+// readSCPAck читает подтверждение удаленной стороны
+func readSCPAck(r *bufio.Reader) error {
+	b, err := r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("не получено подтверждение SCP: %w", err)
+	}
+	switch b {
+	case scpOK:
+		return nil
+	case scpWarning, scpFatal:
+		return readSCPMessage(r, b == scpFatal)
+	default:
+		return fmt.Errorf("неожиданный ответ SCP: %q", b)
+	}
+}
+
+// scpSend передает один файл стороне-приемнику (удаленная команда "scp -t <dir>")
+func scpSend(w io.Writer, r *bufio.Reader, header scpHeader, data io.Reader) error {
+	// Приемник сообщает о готовности до получения заголовка
+	if err := readSCPAck(r); err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(w, "C%04o %d %s\n", header.Mode.Perm(), header.Size, header.Name); err != nil {
+		return fmt.Errorf("ошибка отправки заголовка SCP: %w", err)
+	}
+	if err := readSCPAck(r); err != nil {
+		return err
+	}
+
+	n, err := io.CopyN(w, data, header.Size)
+	if err != nil {
+		return fmt.Errorf("ошибка отправки данных SCP (передано %d из %d байт): %w", n, header.Size, err)
+	}
+	if _, err := w.Write([]byte{scpOK}); err != nil {
+		return fmt.Errorf("ошибка отправки данных SCP: %w", err)
+	}
+	return readSCPAck(r)
+}
+
+// scpReceive принимает один файл от стороны-источника (удаленная команда "scp -f <path>")
+// и записывает его содержимое в dst
+func scpReceive(w io.Writer, r *bufio.Reader, dst io.Writer) (scpHeader, error) {
+	ack := func() error {
+		if _, err := w.Write([]byte{scpOK}); err != nil {
+			return fmt.Errorf("ошибка отправки подтверждения SCP: %w", err)
+		}
+		return nil
+	}
+
+	// Источник начинает передачу только после первого подтверждения
+	if err := ack(); err != nil {
+		return scpHeader{}, err
+	}
+
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return scpHeader{}, fmt.Errorf("не получен заголовок SCP: %w", err)
+		}
+
+		switch b {
+		case scpWarning, scpFatal:
+			return scpHeader{}, readSCPMessage(r, b == scpFatal)
+		case 'T':
+			// Время модификации файла (при scp -p) не используется
+			if _, err := r.ReadString('\n'); err != nil {
+				return scpHeader{}, fmt.Errorf("ошибка чтения заголовка SCP: %w", err)
+			}
+			if err := ack(); err != nil {
+				return scpHeader{}, err
+			}
+		case 'C':
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return scpHeader{}, fmt.Errorf("ошибка чтения заголовка SCP: %w", err)
+			}
+			header, err := parseSCPHeader(strings.TrimSuffix(line, "\n"))
+			if err != nil {
+				return scpHeader{}, err
+			}
+			if err := ack(); err != nil {
+				return scpHeader{}, err
+			}
+
+			n, err := io.CopyN(dst, r, header.Size)
+			if err != nil {
+				return scpHeader{}, fmt.Errorf("ошибка получения данных SCP (получено %d из %d байт): %w", n, header.Size, err)
+			}
+			// После данных источник присылает статус передачи
+			if err := readSCPAck(r); err != nil {
+				return scpHeader{}, err
+			}
+			return header, ack()
+		case 'D', 'E':
+			return scpHeader{}, fmt.Errorf("рекурсивная передача директорий по SCP не поддерживается")
+		default:
+			return scpHeader{}, fmt.Errorf("неожиданный ответ SCP: %q", b)
+		}
+	}
+}
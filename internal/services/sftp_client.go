@@ -0,0 +1,266 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"package-manager/internal/config"
+)
+
+// SFTPClient работает с репозиторием по SFTP поверх SSH-соединения SSHClient.
+// В отличие от SCP поддерживает произвольный корень репозитория (путь из sftp:// URL),
+// создает директории и загружает файлы атомарно через временный файл.
+// Реализует интерфейс Backend
+type SFTPClient struct {
+	ssh    *SSHClient
+	client *sftp.Client
+	mu     sync.Mutex
+	root   string
+}
+
+// NewSFTPClient создает новый экземпляр SFTPClient
+func NewSFTPClient(cfg *config.Config) *SFTPClient {
+	root := "."
+	if u, err := url.Parse(cfg.Repository); err == nil && u.Path != "" {
+		root = u.Path
+	}
+	return &SFTPClient{ssh: NewSSHClient(cfg), root: root}
+}
+
+// connect устанавливает/возвращает SFTP-сессию
+func (c *SFTPClient) connect(ctx context.Context) (*sftp.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.client != nil {
+		// Проверяем, живая ли сессия
+		if _, err := c.client.Getwd(); err == nil {
+			return c.client, nil
+		}
+		c.client.Close()
+		c.client = nil
+	}
+
+	sshClient, err := c.ssh.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	client, err := sftp.NewClient(sshClient)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания SFTP-сессии: %w", err)
+	}
+	c.client = client
+	return client, nil
+}
+
+// watch закрывает SFTP-сессию при отмене ctx, прерывая ее запросы: отдельный запрос SFTP
+// отменить нельзя. Следующий вызов connect откроет новую сессию.
+// Возвращаемую функцию нужно вызвать по завершении операции
+func (c *SFTPClient) watch(ctx context.Context, client *sftp.Client) func() bool {
+	return context.AfterFunc(ctx, func() { client.Close() })
+}
+
+// transfer открывает для передачи файла отдельную SFTP-сессию поверх общего SSH-соединения:
+// закрыть файл во время передачи нельзя, поэтому зависшую передачу прерывает закрытие ее сессии,
+// а параллельные передачи продолжаются. Возвращает функцию прерывания для idleTimer
+// и функцию, которую нужно вызвать по завершении передачи
+func (c *SFTPClient) transfer(ctx context.Context) (*sftp.Client, func(), func(), error) {
+	sshClient, err := c.ssh.connect(ctx)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	client, err := sftp.NewClient(sshClient)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("ошибка создания SFTP-сессии: %w", err)
+	}
+	stop := c.watch(ctx, client)
+	abort := abortTransfer(sshClient, c.ssh.config.TransferTimeout, client.Close)
+	return client, abort, func() {
+		stop()
+		client.Close()
+	}, nil
+}
+
+// removeTemp удаляет временный файл незавершенной загрузки. Сессия могла быть закрыта
+// отменой ctx, поэтому файл удаляется через новую сессию с собственным таймаутом
+func (c *SFTPClient) removeTemp(ctx context.Context, tmp string) {
+	ctx, cancel := cleanupContext(ctx)
+	defer cancel()
+	if client, err := c.connect(ctx); err == nil {
+		client.Remove(tmp)
+	}
+}
+
+// remotePath переводит путь внутри репозитория в путь на сервере
+func (c *SFTPClient) remotePath(name string) string {
+	return path.Join(c.root, cleanRemotePath(name))
+}
+
+// Close закрывает SFTP-сессию и SSH-соединение
+func (c *SFTPClient) Close() error {
+	c.mu.Lock()
+	if c.client != nil {
+		c.client.Close()
+		c.client = nil
+	}
+	c.mu.Unlock()
+	return c.ssh.Close()
+}
+
+// UploadFile загружает файл во временный файл рядом с целевым и переименовывает его на место
+func (c *SFTPClient) UploadFile(ctx context.Context, fileName string, data io.Reader, size int64) error {
+	client, abort, done, err := c.transfer(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	target := c.remotePath(fileName)
+	if err := client.MkdirAll(path.Dir(target)); err != nil {
+		return fmt.Errorf("ошибка создания директории %s: %w", path.Dir(target), err)
+	}
+
+	tmp := path.Join(path.Dir(target), fmt.Sprintf(".%s.tmp-%d", path.Base(target), time.Now().UnixNano()))
+	f, err := client.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("ошибка создания файла %s: %w", tmp, err)
+	}
+	timer := startIdleTimer(c.ssh.config.TransferTimeout, abort)
+	if _, err := io.CopyN(f, timer.reader(data), size); err != nil {
+		err = contextError(ctx, timer.stop(err))
+		f.Close()
+		c.removeTemp(ctx, tmp)
+		return fmt.Errorf("ошибка записи файла %s: %w", tmp, err)
+	}
+	if err := contextError(ctx, timer.stop(f.Close())); err != nil {
+		c.removeTemp(ctx, tmp)
+		return fmt.Errorf("ошибка записи файла %s: %w", tmp, err)
+	}
+	if err := c.rename(client, tmp, target); err != nil {
+		c.removeTemp(ctx, tmp)
+		return contextError(ctx, err)
+	}
+	log.Println("Файл успешно загружен по SFTP.")
+	return nil
+}
+
+// DownloadFile скачивает файл с сервера в w
+func (c *SFTPClient) DownloadFile(ctx context.Context, fileName string, w io.Writer) error {
+	if err := c.DownloadFileFrom(ctx, fileName, 0, w); err != nil {
+		return err
+	}
+	log.Println("Файл успешно скачан по SFTP.")
+	return nil
+}
+
+// DownloadFileFrom скачивает файл с сервера в w начиная с байта offset
+func (c *SFTPClient) DownloadFileFrom(ctx context.Context, fileName string, offset int64, w io.Writer) error {
+	client, abort, done, err := c.transfer(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	f, err := client.Open(c.remotePath(fileName))
+	if err != nil {
+		return fmt.Errorf("ошибка открытия файла %s: %w", fileName, err)
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("ошибка чтения файла %s: %w", fileName, err)
+	}
+
+	timer := startIdleTimer(c.ssh.config.TransferTimeout, abort)
+	_, err = f.WriteTo(timer.writer(w))
+	if err = contextError(ctx, timer.stop(err)); err != nil {
+		return fmt.Errorf("ошибка чтения файла %s: %w", fileName, err)
+	}
+	return nil
+}
+
+// List возвращает содержимое директории на сервере
+func (c *SFTPClient) List(ctx context.Context, dir string) ([]FileInfo, error) {
+	client, err := c.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer c.watch(ctx, client)()
+
+	entries, err := client.ReadDir(c.remotePath(dir))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения директории %s: %w", dir, err)
+	}
+	files := make([]FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		files = append(files, fileInfoFromOS(entry))
+	}
+	return files, nil
+}
+
+// Stat возвращает информацию о файле на сервере
+func (c *SFTPClient) Stat(ctx context.Context, fileName string) (*FileInfo, error) {
+	client, err := c.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer c.watch(ctx, client)()
+
+	info, err := client.Stat(c.remotePath(fileName))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения информации о %s: %w", fileName, err)
+	}
+	fi := fileInfoFromOS(info)
+	return &fi, nil
+}
+
+// Delete удаляет файл на сервере
+func (c *SFTPClient) Delete(ctx context.Context, fileName string) error {
+	client, err := c.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.watch(ctx, client)()
+
+	if err := client.Remove(c.remotePath(fileName)); err != nil {
+		return fmt.Errorf("ошибка удаления %s: %w", fileName, err)
+	}
+	return nil
+}
+
+// Rename атомарно переименовывает файл на сервере, заменяя существующий
+func (c *SFTPClient) Rename(ctx context.Context, oldName, newName string) error {
+	client, err := c.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.watch(ctx, client)()
+
+	target := c.remotePath(newName)
+	if err := client.MkdirAll(path.Dir(target)); err != nil {
+		return fmt.Errorf("ошибка создания директории %s: %w", path.Dir(target), err)
+	}
+	return c.rename(client, c.remotePath(oldName), target)
+}
+
+// rename использует расширение posix-rename@openssh.com, которое заменяет файл атомарно.
+// Без расширения обычный SFTP-rename не перезаписывает файл, поэтому целевой файл сначала удаляется
+func (c *SFTPClient) rename(client *sftp.Client, from, to string) error {
+	if _, ok := client.HasExtension("posix-rename@openssh.com"); ok {
+		if err := client.PosixRename(from, to); err != nil {
+			return fmt.Errorf("ошибка переименования %s: %w", from, err)
+		}
+		return nil
+	}
+	client.Remove(to)
+	if err := client.Rename(from, to); err != nil {
+		return fmt.Errorf("ошибка переименования %s: %w", from, err)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestSFTPClientRepositoryLayout проверяет работу с корнем репозитория и раскладку <name>/<ver>/
+func TestSFTPClientRepositoryLayout(t *testing.T) {
+	cfg, serverRoot := newTestSSHConfig(t, "sftp", "srv/packages")
+	backend, err := NewBackend(cfg)
+	if err != nil {
+		t.Fatalf("Не удалось создать хранилище: %v", err)
+	}
+	client, ok := backend.(*SFTPClient)
+	if !ok {
+		t.Fatalf("Ожидался SFTP-клиент, получено %T", backend)
+	}
+	defer client.Close()
+
+	data := bytes.Repeat([]byte("PK\x03\x04\x00"), 1024)
+	name := archivePath("pkg", "1.2.0", "")
+	if err := uploadBytes(client, name, data); err != nil {
+		t.Fatalf("Ошибка загрузки: %v", err)
+	}
+
+	// Директории созданы автоматически, временные файлы не остались
+	dir := filepath.Join(serverRoot, "srv", "packages", "pkg", "1.2.0")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Ожидалась директория версии на сервере: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "pkg-1.2.0.zip" {
+		t.Errorf("Ожидался только архив в директории версии, получено %v", entries)
+	}
+
+	buf, err := downloadBytes(client, name)
+	if err != nil || !bytes.Equal(buf, data) {
+		t.Fatalf("Скачанные данные не совпадают (%v)", err)
+	}
+	var tail bytes.Buffer
+	if err := client.DownloadFileFrom(t.Context(), name, 1000, &tail); err != nil || !bytes.Equal(tail.Bytes(), data[1000:]) {
+		t.Errorf("Ожидался остаток файла с 1000 байта, получено %d байт (%v)", tail.Len(), err)
+	}
+
+	files, err := client.List(t.Context(), "pkg")
+	if err != nil || len(files) != 1 || !files[0].IsDir || files[0].Name != "1.2.0" {
+		t.Errorf("Неожиданный результат List: %+v (%v)", files, err)
+	}
+	info, err := client.Stat(t.Context(), name)
+	if err != nil || info.Size != int64(len(data)) {
+		t.Errorf("Неожиданный результат Stat: %+v (%v)", info, err)
+	}
+	if _, err := client.Stat(t.Context(), "pkg/missing.zip"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Ожидалась ошибка fs.ErrNotExist, получено: %v", err)
+	}
+
+	// Повторная загрузка заменяет файл
+	if err := uploadBytes(client, name, []byte("v2")); err != nil {
+		t.Fatalf("Ошибка повторной загрузки: %v", err)
+	}
+	if buf, err := downloadBytes(client, name); err != nil || string(buf) != "v2" {
+		t.Errorf("Ожидалось обновленное содержимое, получено %q (%v)", buf, err)
+	}
+
+	if err := client.Rename(t.Context(), name, "pkg/1.2.0/renamed.zip"); err != nil {
+		t.Fatalf("Ошибка переименования: %v", err)
+	}
+	if err := client.Delete(t.Context(), "pkg/1.2.0/renamed.zip"); err != nil {
+		t.Fatalf("Ошибка удаления: %v", err)
+	}
+	if err := client.Delete(t.Context(), "pkg/1.2.0/renamed.zip"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Ожидалась ошибка fs.ErrNotExist при повторном удалении, получено: %v", err)
+	}
+	if strings.Contains(client.remotePath("../../etc/passwd"), "..") {
+		t.Error("Путь не должен выходить за корень репозитория")
+	}
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+
+	"golang.org/x/crypto/ssh"
+	"package-manager/internal/models"
+	"package-manager/internal/signing"
+)
+
+// Политики проверки подписей в файле пакетов
+const (
+	// SignatureRequired - пакет должен быть подписан доверенным ключом (по умолчанию)
+	SignatureRequired = "required"
+	// SignatureOptional - неподписанный пакет допускается, но подпись, если есть, должна быть верной
+	SignatureOptional = "optional"
+	// SignatureNone - подпись не проверяется
+	SignatureNone = "none"
+)
+
+var (
+	// ErrUnsigned сообщает, что пакет не подписан, а политика требует подписи
+	ErrUnsigned = errors.New("пакет не подписан")
+	// ErrUntrustedKey сообщает, что пакет подписан ключом не из списка доверенных
+	ErrUntrustedKey = errors.New("ключ подписи не входит в список доверенных")
+)
+
+// SignatureError сообщает, что подпись архива не прошла проверку. Такой архив не распаковывается
+type SignatureError struct {
+	Archive string
+	Err     error
+}
+
+func (e *SignatureError) Error() string {
+	return fmt.Sprintf("подпись архива %s не принята: %v", e.Archive, e.Err)
+}
+
+func (e *SignatureError) Unwrap() error {
+	return e.Err
+}
+
+// signaturePolicy хранит политики проверки подписей из файла пакетов.
+// Транзитивные зависимости проверяются по общей политике
+type signaturePolicy struct {
+	defaultPolicy string
+	packages      map[string]string
+}
+
+// newSignaturePolicy читает политики из файла пакетов и проверяет их значения
+func newSignaturePolicy(cfg *models.UpdateConfig) (*signaturePolicy, error) {
+	policy := &signaturePolicy{defaultPolicy: SignatureRequired, packages: make(map[string]string)}
+	if cfg.Signature != "" {
+		if err := checkSignaturePolicy(cfg.Signature); err != nil {
+			return nil, err
+		}
+		policy.defaultPolicy = cfg.Signature
+	}
+	for _, pkg := range cfg.Packages {
+		if pkg.Signature == "" {
+			continue
+		}
+		if err := checkSignaturePolicy(pkg.Signature); err != nil {
+			return nil, fmt.Errorf("пакет %s: %w", pkg.Name, err)
+		}
+		policy.packages[pkg.Name] = pkg.Signature
+	}
+	return policy, nil
+}
+
+func checkSignaturePolicy(value string) error {
+	switch value {
+	case SignatureRequired, SignatureOptional, SignatureNone:
+		return nil
+	default:
+		return fmt.Errorf("неизвестная политика подписи %q (ожидалось %s, %s или %s)",
+			value, SignatureRequired, SignatureOptional, SignatureNone)
+	}
+}
+
+// forPackage возвращает политику для пакета
+func (p *signaturePolicy) forPackage(name string) string {
+	if policy, ok := p.packages[name]; ok {
+		return policy
+	}
+	return p.defaultPolicy
+}
+
+// checksSignatures сообщает, нужно ли проверять подпись хотя бы одного из пакетов
+func (p *signaturePolicy) checksSignatures(packages []models.LockedPackage) bool {
+	for _, pkg := range packages {
+		if p.forPackage(pkg.Name) != SignatureNone {
+			return true
+		}
+	}
+	return false
+}
+
+// loadTrustedKeys читает файл доверенных ключей из конфигурации
+func (pm *PackageManager) loadTrustedKeys() (signing.TrustedKeys, error) {
+	if pm.config.TrustedKeys == "" {
+		return nil, errors.New("не задан файл доверенных ключей (PM_TRUSTED_KEYS)")
+	}
+	return signing.LoadTrustedKeys(pm.config.TrustedKeys)
+}
+
+// loadSigner читает ключ для подписи пакетов
+func (pm *PackageManager) loadSigner() (ssh.Signer, error) {
+	if pm.config.SigningKey == "" {
+		return nil, errors.New("не задан ключ подписи (PM_SIGNING_KEY или PM_SSH_KEY)")
+	}
+	// Пароль зашифрованного ключа запрашивается сразу, до упаковки архива
+	return signing.LoadSigner(pm.config.SigningKey, func() (string, error) {
+		return keyPassphrase(pm.config.SigningKey, pm.config.SSHKeyPassphrase)
+	})
+}
+
+// verifySignature проверяет подпись пакета согласно его политике. Подпись покрывает имя, версию
+// и контрольную сумму пакета, поэтому архив должен быть заранее сверен с pkg.Checksum
+func verifySignature(archiveName string, pkg *models.LockedPackage, policy string, keys signing.TrustedKeys) error {
+	if policy == SignatureNone {
+		return nil
+	}
+	if pkg.Signature == "" {
+		if policy == SignatureOptional {
+			log.Printf("Пакет %s не подписан, подпись не проверяется.", archiveName)
+			return nil
+		}
+		return &SignatureError{Archive: archiveName, Err: ErrUnsigned}
+	}
+
+	key, err := signing.Verify(pkg.Signature, bytes.NewReader(signing.Manifest(pkg.Name, pkg.Ver, pkg.Checksum)))
+	if err != nil {
+		return &SignatureError{Archive: archiveName, Err: err}
+	}
+	if !keys.Trusts(pkg.Name, key) {
+		return &SignatureError{Archive: archiveName, Err: fmt.Errorf("%w: %s", ErrUntrustedKey, ssh.FingerprintSHA256(key))}
+	}
+	log.Printf("Подпись пакета %s проверена (ключ %s).", archiveName, ssh.FingerprintSHA256(key))
+	return nil
+}
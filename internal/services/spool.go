@@ -0,0 +1,82 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+)
+
+// spoolFile - временный файл на диске для архива пакета. При записи считает размер и SHA-256,
+// поэтому архив любого размера не держится в памяти, а контрольная сумма не требует повторного чтения.
+// Файл поддерживает произвольный доступ, который нужен ZIP для чтения центрального каталога
+type spoolFile struct {
+	file *os.File
+	hash hash.Hash
+	size int64
+	// keep - файл не временный (архив из кэша) и при закрытии не удаляется
+	keep bool
+}
+
+// newSpoolFile создает временный файл в системной временной директории (учитывает TMPDIR)
+func newSpoolFile() (*spoolFile, error) {
+	f, err := os.CreateTemp("", "pm-spool-*")
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания временного файла: %w", err)
+	}
+	return &spoolFile{file: f, hash: sha256.New()}, nil
+}
+
+// openSpoolFile открывает существующий файл на чтение, вычисляя его размер и контрольную сумму.
+// Файл при закрытии не удаляется
+func openSpoolFile(filePath string) (*spoolFile, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	s := &spoolFile{file: f, hash: sha256.New(), keep: true}
+	if s.size, err = io.Copy(s.hash, f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Write записывает данные в файл и учитывает их в контрольной сумме
+func (s *spoolFile) Write(p []byte) (int, error) {
+	n, err := s.file.Write(p)
+	s.hash.Write(p[:n])
+	s.size += int64(n)
+	return n, err
+}
+
+// ReadAt читает данные из произвольного места файла
+func (s *spoolFile) ReadAt(p []byte, off int64) (int, error) {
+	return s.file.ReadAt(p, off)
+}
+
+// Reader возвращает поток для чтения файла с начала
+func (s *spoolFile) Reader() io.Reader {
+	return io.NewSectionReader(s.file, 0, s.size)
+}
+
+// Size возвращает количество записанных байт
+func (s *spoolFile) Size() int64 {
+	return s.size
+}
+
+// Checksum возвращает контрольную сумму записанных данных в формате "sha256:<hex>"
+func (s *spoolFile) Checksum() string {
+	return "sha256:" + hex.EncodeToString(s.hash.Sum(nil))
+}
+
+// Close закрывает и удаляет временный файл
+func (s *spoolFile) Close() error {
+	err := s.file.Close()
+	if !s.keep {
+		os.Remove(s.file.Name())
+	}
+	return err
+}
@@ -0,0 +1,293 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/term"
+	"package-manager/internal/config"
+)
+
+// ErrNoTerminal возвращается, если пароль нужно запросить, а терминала нет
+var ErrNoTerminal = errors.New("нет терминала для ввода пароля")
+
+// promptSecret запрашивает секрет у пользователя. nil, если stdin не терминал. Подменяется в тестах
+var promptSecret = terminalPrompt()
+
+// terminalPrompt возвращает функцию запроса секрета на терминале или nil, если терминала нет
+func terminalPrompt() func(string) (string, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return nil
+	}
+	return readSecret
+}
+
+// readSecret запрашивает секрет на терминале без отображения ввода
+func readSecret(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	secret, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("ошибка чтения пароля: %w", err)
+	}
+	return string(secret), nil
+}
+
+// askSecret запрашивает секрет у пользователя, если есть терминал
+func askSecret(prompt string) (string, error) {
+	if promptSecret == nil {
+		return "", ErrNoTerminal
+	}
+	return promptSecret(prompt)
+}
+
+// authMethods собирает способы аутентификации в порядке из конфигурации. Ключи из SSH-агента
+// и из файла объединяются в один способ publickey на месте первого из них: библиотека ssh
+// не пробует один и тот же способ дважды. Возвращаемую функцию нужно вызвать после рукопожатия,
+// чтобы закрыть соединение с агентом
+func (c *SSHClient) authMethods(ep sshEndpoint) ([]ssh.AuthMethod, func(), error) {
+	order := c.config.SSHAuth
+	if len(order) == 0 {
+		order = config.SSHAuthMethods
+	}
+
+	var methods []ssh.AuthMethod
+	var sources []func() ([]ssh.Signer, error)
+	publicKeyIndex := -1
+	closeAgent := func() {}
+	for _, method := range order {
+		switch method {
+		case "agent":
+			signers, closeFn, err := dialAgent()
+			if err != nil {
+				log.Printf("SSH-агент недоступен: %v", err)
+				continue
+			}
+			closeAgent = closeFn
+			sources = append(sources, signers)
+		case "key":
+			if ep.key == "" {
+				continue
+			}
+			sources = append(sources, func() ([]ssh.Signer, error) { return c.keySigners(ep.key) })
+		case "password":
+			if c.config.SSHPassword == "" && promptSecret == nil {
+				continue
+			}
+			methods = append(methods, ssh.PasswordCallback(func() (string, error) { return c.password(ep) }))
+			continue
+		case "keyboard-interactive":
+			if c.config.SSHPassword == "" && promptSecret == nil {
+				continue
+			}
+			methods = append(methods, ssh.KeyboardInteractive(c.keyboardInteractive(ep)))
+			continue
+		default:
+			return nil, nil, fmt.Errorf("неизвестный способ SSH-аутентификации: %s", method)
+		}
+		if publicKeyIndex < 0 {
+			publicKeyIndex = len(methods)
+			methods = append(methods, nil)
+		}
+	}
+	if publicKeyIndex >= 0 {
+		methods[publicKeyIndex] = ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			var all []ssh.Signer
+			var errs []error
+			for _, source := range sources {
+				signers, err := source()
+				if err != nil {
+					errs = append(errs, err)
+					continue
+				}
+				all = append(all, signers...)
+			}
+			if len(all) == 0 {
+				return nil, errors.Join(errs...)
+			}
+			for _, err := range errs {
+				log.Printf("Ключ пропущен: %v", err)
+			}
+			return all, nil
+		})
+	}
+	if len(methods) == 0 {
+		closeAgent()
+		return nil, nil, fmt.Errorf("нет доступных способов SSH-аутентификации (%s): задайте PM_SSH_KEY, "+
+			"SSH_AUTH_SOCK или PM_SSH_PASSWORD", strings.Join(order, ", "))
+	}
+	return methods, closeAgent, nil
+}
+
+// dialAgent подключается к SSH-агенту из SSH_AUTH_SOCK и возвращает функцию получения его ключей
+func dialAgent() (func() ([]ssh.Signer, error), func(), error) {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, nil, errors.New("SSH_AUTH_SOCK не задан")
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, nil, err
+	}
+	client := agent.NewClient(conn)
+	signers := func() ([]ssh.Signer, error) {
+		signers, err := client.Signers()
+		if err != nil {
+			return nil, fmt.Errorf("ошибка получения ключей SSH-агента: %w", err)
+		}
+		return signers, nil
+	}
+	return signers, func() { conn.Close() }, nil
+}
+
+// keySigners возвращает ключ из файла keyPath. Ключ читается один раз и переиспользуется
+// при переподключениях, поэтому пароль зашифрованного ключа запрашивается не больше одного раза
+func (c *SSHClient) keySigners(keyPath string) ([]ssh.Signer, error) {
+	signer, ok := c.signers[keyPath]
+	if !ok {
+		var err error
+		if signer, err = loadKey(keyPath, c.config.SSHKeyPassphrase); err != nil {
+			return nil, err
+		}
+		if c.signers == nil {
+			c.signers = map[string]ssh.Signer{}
+		}
+		c.signers[keyPath] = signer
+	}
+	return []ssh.Signer{signer}, nil
+}
+
+// loadKey читает закрытый ключ. Пароль зашифрованного ключа берется из passphrase или запрашивается
+// у пользователя при первой подписи, то есть только если сервер принял открытый ключ
+func loadKey(keyPath, passphrase string) (ssh.Signer, error) {
+	key, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать SSH-ключ: %w", err)
+	}
+
+	signer, err := ssh.ParsePrivateKey(key)
+	var missingErr *ssh.PassphraseMissingError
+	if !errors.As(err, &missingErr) {
+		if err != nil {
+			return nil, fmt.Errorf("не удалось разобрать SSH-ключ: %w", err)
+		}
+		return signer, nil
+	}
+
+	decrypt := func() (ssh.Signer, error) {
+		secret, err := keyPassphrase(keyPath, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := ssh.ParsePrivateKeyWithPassphrase(key, []byte(secret))
+		if err != nil {
+			return nil, fmt.Errorf("не удалось расшифровать SSH-ключ %s: %w", keyPath, err)
+		}
+		return signer, nil
+	}
+	if missingErr.PublicKey == nil {
+		// Открытый ключ зашифрован вместе с закрытым (старый формат PEM): расшифровываем сразу
+		return decrypt()
+	}
+	return &encryptedSigner{publicKey: missingErr.PublicKey, decrypt: decrypt}, nil
+}
+
+// keyPassphrase возвращает пароль зашифрованного ключа: passphrase (PM_SSH_KEY_PASSPHRASE)
+// или введенный на терминале
+func keyPassphrase(keyPath, passphrase string) (string, error) {
+	if passphrase != "" {
+		return passphrase, nil
+	}
+	return askSecret(fmt.Sprintf("Пароль для ключа %s: ", keyPath))
+}
+
+// encryptedSigner - зашифрованный ключ, который расшифровывается при первой подписи
+type encryptedSigner struct {
+	publicKey ssh.PublicKey
+	decrypt   func() (ssh.Signer, error)
+	once      sync.Once
+	signer    ssh.Signer
+	err       error
+}
+
+func (s *encryptedSigner) PublicKey() ssh.PublicKey {
+	return s.publicKey
+}
+
+func (s *encryptedSigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	signer, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	return signer.Sign(rand, data)
+}
+
+// SignWithAlgorithm нужен для ключей RSA: без него библиотека ssh подписывает только устаревшим ssh-rsa
+func (s *encryptedSigner) SignWithAlgorithm(rand io.Reader, data []byte, algorithm string) (*ssh.Signature, error) {
+	signer, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	algorithmSigner, ok := signer.(ssh.AlgorithmSigner)
+	if !ok {
+		return nil, fmt.Errorf("ключ не поддерживает алгоритм подписи %s", algorithm)
+	}
+	return algorithmSigner.SignWithAlgorithm(rand, data, algorithm)
+}
+
+func (s *encryptedSigner) get() (ssh.Signer, error) {
+	s.once.Do(func() { s.signer, s.err = s.decrypt() })
+	return s.signer, s.err
+}
+
+// password возвращает пароль из PM_SSH_PASSWORD или запрашивает его у пользователя.
+// Введенный пароль запоминается до конца работы клиента
+func (c *SSHClient) password(ep sshEndpoint) (string, error) {
+	if c.config.SSHPassword != "" {
+		return c.config.SSHPassword, nil
+	}
+	key := ep.user + "@" + ep.addr
+	if secret, ok := c.passwords[key]; ok {
+		return secret, nil
+	}
+	secret, err := askSecret(fmt.Sprintf("Пароль для %s: ", key))
+	if err != nil {
+		return "", err
+	}
+	if c.passwords == nil {
+		c.passwords = map[string]string{}
+	}
+	c.passwords[key] = secret
+	return secret, nil
+}
+
+// keyboardInteractive возвращает обработчик вопросов сервера. Единственный вопрос без отображения ввода
+// считается запросом пароля, остальные задаются пользователю
+func (c *SSHClient) keyboardInteractive(ep sshEndpoint) ssh.KeyboardInteractiveChallenge {
+	return func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+		if len(questions) == 1 && !echos[0] {
+			secret, err := c.password(ep)
+			return []string{secret}, err
+		}
+		if len(questions) > 0 && instruction != "" && promptSecret != nil {
+			fmt.Fprintln(os.Stderr, instruction)
+		}
+		answers := make([]string, len(questions))
+		for i, question := range questions {
+			answer, err := askSecret(question)
+			if err != nil {
+				return nil, err
+			}
+			answers[i] = answer
+		}
+		return answers, nil
+	}
+}
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"package-manager/internal/config"
+)
+
+// startTestAgent запускает SSH-агент с ключом key и возвращает путь к его сокету
+func startTestAgent(t *testing.T, key ed25519.PrivateKey) string {
+	t.Helper()
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: key}); err != nil {
+		t.Fatalf("Не удалось добавить ключ в агент: %v", err)
+	}
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("Не удалось запустить SSH-агент: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go agent.ServeAgent(keyring, conn)
+		}
+	}()
+	return socket
+}
+
+// TestSSHClientAuthMethods проверяет аутентификацию через агент, зашифрованный ключ, пароль
+// и keyboard-interactive в порядке из конфигурации
+func TestSSHClientAuthMethods(t *testing.T) {
+	agentPub, agentKey, _ := ed25519.GenerateKey(rand.Reader)
+	filePub, fileKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	// Сервер принимает только один открытый ключ и пароль "pw"
+	var accepted atomic.Value
+	accepted.Store(ed25519.PublicKey(nil))
+	serverConfig := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			want, err := ssh.NewPublicKey(accepted.Load().(ed25519.PublicKey))
+			if err == nil && bytes.Equal(key.Marshal(), want.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("ключ не принят")
+		},
+		PasswordCallback: func(_ ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if string(password) == "pw" {
+				return nil, nil
+			}
+			return nil, errors.New("неверный пароль")
+		},
+		KeyboardInteractiveCallback: func(_ ssh.ConnMetadata, challenge ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			answers, err := challenge("", "", []string{"Password: "}, []bool{false})
+			if err == nil && len(answers) == 1 && answers[0] == "pw" {
+				return nil, nil
+			}
+			return nil, errors.New("неверный пароль")
+		},
+	}
+	addr := startTestSSHServerWithConfig(t, t.TempDir(), serverConfig)
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if err := os.MkdirAll(filepath.Join(home, ".ssh"), 0700); err != nil {
+		t.Fatalf("Не удалось создать директорию .ssh: %v", err)
+	}
+	block, err := ssh.MarshalPrivateKeyWithPassphrase(fileKey, "", []byte("secret"))
+	if err != nil {
+		t.Fatalf("Не удалось зашифровать ключ: %v", err)
+	}
+	keyPath := filepath.Join(home, "id_ed25519")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("Не удалось записать ключ: %v", err)
+	}
+	socket := startTestAgent(t, agentKey)
+
+	var prompts int
+	promptSecret = func(prompt string) (string, error) {
+		prompts++
+		return "secret", nil
+	}
+	t.Cleanup(func() { promptSecret = terminalPrompt() })
+
+	newCfg := func(auth ...string) *config.Config {
+		return &config.Config{
+			SSHUser: "pm",
+			SSHHost: addr.IP.String(),
+			SSHPort: addr.Port,
+			SSHKey:  keyPath,
+			SSHAuth: auth,
+			// Неизвестный ключ тестового сервера записывается в known_hosts временного HOME
+			HostKeyPolicy: "accept-new",
+		}
+	}
+	connect := func(cfg *config.Config) (*SSHClient, error) {
+		client := NewSSHClient(cfg)
+		t.Cleanup(func() { client.Close() })
+		_, err := client.connect(t.Context())
+		return client, err
+	}
+
+	// Ключ из агента
+	t.Setenv("SSH_AUTH_SOCK", socket)
+	accepted.Store(ed25519.PublicKey(agentPub))
+	if _, err := connect(newCfg("agent")); err != nil {
+		t.Fatalf("Ожидалась аутентификация ключом агента: %v", err)
+	}
+
+	// Агент и зашифрованный ключ пробуются одним способом publickey: ключ агента отклонен,
+	// пароль ключа берется из конфигурации
+	accepted.Store(ed25519.PublicKey(filePub))
+	cfg := newCfg("agent", "key")
+	cfg.SSHKeyPassphrase = "secret"
+	if _, err := connect(cfg); err != nil || prompts != 0 {
+		t.Fatalf("Ожидалась аутентификация зашифрованным ключом без запроса пароля, запросов %d (%v)", prompts, err)
+	}
+
+	// Пароль ключа запрашивается один раз и не запрашивается повторно при переподключении
+	client, err := connect(newCfg("key"))
+	if err != nil {
+		t.Fatalf("Ожидалась аутентификация ключом с запросом пароля: %v", err)
+	}
+	client.Close()
+	if _, err := client.connect(t.Context()); err != nil || prompts != 1 {
+		t.Errorf("Ожидался один запрос пароля ключа, получено %d (%v)", prompts, err)
+	}
+
+	// Ключ отклонен сервером: пароль ключа не запрашивается, используется пароль пользователя
+	accepted.Store(ed25519.PublicKey(nil))
+	prompts = 0
+	cfg = newCfg("key", "password")
+	cfg.SSHPassword = "pw"
+	if _, err := connect(cfg); err != nil || prompts != 0 {
+		t.Errorf("Ожидалась аутентификация паролем без запроса пароля ключа, запросов %d (%v)", prompts, err)
+	}
+	cfg = newCfg("keyboard-interactive")
+	cfg.SSHPassword = "pw"
+	if _, err := connect(cfg); err != nil {
+		t.Errorf("Ожидалась аутентификация keyboard-interactive: %v", err)
+	}
+	cfg.SSHPassword = "wrong"
+	if _, err := connect(cfg); err == nil {
+		t.Error("Ожидалась ошибка аутентификации с неверным паролем")
+	}
+
+	// Без агента и терминала способов не остается
+	t.Setenv("SSH_AUTH_SOCK", "")
+	promptSecret = nil
+	if _, err := connect(newCfg("agent", "password")); err == nil || !strings.Contains(err.Error(), "нет доступных способов") {
+		t.Errorf("Ожидалась ошибка об отсутствии способов аутентификации, получено: %v", err)
+	}
+}
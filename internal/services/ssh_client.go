@@ -1,195 +1,503 @@
 package services
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"net"
+	"net/url"
 	"os"
-	"path/filepath"
+	"path"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"golang.org/x/crypto/ssh"
-	"golang.org/x/crypto/ssh/knownhosts"
 	"package-manager/internal/config"
 )
 
+// notExistStatus - код выхода удаленной команды, означающий отсутствие файла
+const notExistStatus = 44
+
 // SSHClient инкапсулирует логику для работы с SSH-соединением
-// Реализует интерфейс SSHClientInterface
+// Реализует интерфейс Backend
 type SSHClient struct {
 	config *config.Config
 	client *ssh.Client
-	mu     sync.Mutex
+	// jumps - соединения с промежуточными хостами (ProxyJump), через которые установлено client
+	jumps []*ssh.Client
+	mu    sync.Mutex
+	// root - корень репозитория на сервере (путь из ssh:// URL, по умолчанию домашняя директория)
+	root string
+	// signers - прочитанные ключи по путям, passwords - введенные пользователем пароли по user@host:port.
+	// Сохраняются между переподключениями, чтобы не запрашивать пароли повторно
+	signers   map[string]ssh.Signer
+	passwords map[string]string
+}
+
+// sshEndpoint - хост, к которому устанавливается SSH-соединение: основной или промежуточный
+type sshEndpoint struct {
+	user string
+	addr string
+	key  string
+	// fingerprint - закрепленный отпечаток ключа сервера. Задается только для основного хоста:
+	// промежуточные хосты проверяются по known_hosts
+	fingerprint string
 }
 
 // NewSSHClient создает новый экземпляр SSHClient
 func NewSSHClient(cfg *config.Config) *SSHClient {
-	return &SSHClient{config: cfg}
+	root := "."
+	if u, err := url.Parse(cfg.Repository); err == nil && u.Scheme == "ssh" && u.Path != "" {
+		root = u.Path
+	}
+	return &SSHClient{config: cfg, root: root}
+}
+
+// remotePath переводит путь внутри репозитория в путь на сервере
+func (c *SSHClient) remotePath(name string) string {
+	return path.Join(c.root, cleanRemotePath(name))
 }
 
 // connect устанавливает/возвращает SSH-соединение
-func (c *SSHClient) connect() (*ssh.Client, error) {
+func (c *SSHClient) connect(ctx context.Context) (*ssh.Client, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	if c.client != nil {
 		// Проверяем, живое ли соединение
-		_, err := c.client.NewSession()
+		session, err := c.client.NewSession()
 		if err == nil {
+			session.Close()
 			return c.client, nil // Живое - возвращаем
 		}
 		// Если нет, закрываем и переподключаемся
-		c.client.Close()
-		c.client = nil
+		c.closeLocked()
 	}
 
-	// Чтение ключа
-	key, err := os.ReadFile(c.config.SSHKey)
+	// Промежуточные хосты проходятся по порядку: каждый следующий доступен через предыдущий
+	var via *ssh.Client
+	for _, jump := range c.config.SSHJumps {
+		ep := sshEndpoint{user: jump.User, addr: net.JoinHostPort(jump.Host, strconv.Itoa(jump.Port)), key: jump.Key}
+		client, err := c.dial(ctx, via, ep)
+		if err != nil {
+			c.closeLocked()
+			return nil, fmt.Errorf("ошибка SSH-соединения с промежуточным хостом %s: %w", ep.addr, err)
+		}
+		c.jumps = append(c.jumps, client)
+		via = client
+	}
+
+	ep := sshEndpoint{
+		user:        c.config.SSHUser,
+		addr:        net.JoinHostPort(c.config.SSHHost, strconv.Itoa(c.config.SSHPort)),
+		key:         c.config.SSHKey,
+		fingerprint: c.config.HostKeyFingerprint,
+	}
+	client, err := c.dial(ctx, via, ep)
 	if err != nil {
-		return nil, fmt.Errorf("не удалось прочитать SSH-ключ: %w", err)
+		c.closeLocked()
+		return nil, fmt.Errorf("ошибка SSH-соединения: %w", err)
 	}
 
-	signer, err := ssh.ParsePrivateKey(key)
+	c.client = client
+	return client, nil
+}
+
+// dial устанавливает SSH-соединение с хостом ep напрямую или, если via не nil, через промежуточный хост
+func (c *SSHClient) dial(ctx context.Context, via *ssh.Client, ep sshEndpoint) (*ssh.Client, error) {
+	auth, closeAgent, err := c.authMethods(ep)
 	if err != nil {
-		return nil, fmt.Errorf("не удалось разобрать SSH-ключ: %w", err)
+		return nil, err
 	}
+	defer closeAgent()
 
-	// Получаем домашнюю директорию
-	homeDir, err := os.UserHomeDir()
+	hostKeys, err := newHostKeyCheck(c.config, ep.fingerprint)
 	if err != nil {
-		return nil, fmt.Errorf("не удалось определить домашнюю директорию: %w", err)
+		return nil, err
+	}
+	sshConfig := &ssh.ClientConfig{
+		User:              ep.user,
+		Auth:              auth,
+		HostKeyCallback:   hostKeys.callback,
+		HostKeyAlgorithms: hostKeys.algorithms(ep.addr),
 	}
-	knownHostsPath := filepath.Join(homeDir, ".ssh", "known_hosts")
+	return dialSSH(ctx, via, ep.addr, sshConfig, c.config.ConnectTimeout)
+}
 
-	// Вспомогательная функция для добавления ключа хоста в known_hosts
-	addHostKeyToFile := func(path, addr string, key ssh.PublicKey) error {
-		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
-		if err != nil {
-			return err
+// dialSSH устанавливает SSH-соединение. timeout ограничивает и TCP-подключение, и SSH-рукопожатие
+// с аутентификацией: на обрывающихся каналах сервер может перестать отвечать уже после подключения.
+// Через промежуточный хост TCP-соединение открывается каналом direct-tcpip уже установленного соединения via
+func dialSSH(ctx context.Context, via *ssh.Client, addr string, sshConfig *ssh.ClientConfig, timeout time.Duration) (*ssh.Client, error) {
+	var conn net.Conn
+	var err error
+	if via != nil {
+		dialCtx := ctx
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			dialCtx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
 		}
-		defer file.Close()
-
-		line := knownhosts.Line([]string{addr}, key)
-		_, err = fmt.Fprintln(file, line)
-		return err
+		conn, err = via.DialContext(dialCtx, "tcp", addr)
+		if err != nil && dialCtx.Err() != nil && ctx.Err() == nil {
+			err = fmt.Errorf("%w (%s): %v", os.ErrDeadlineExceeded, timeout, err)
+		}
+	} else {
+		dialer := net.Dialer{Timeout: timeout}
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, contextError(ctx, err)
 	}
 
-	// Новый колбэк, который проверяет ключ и добавляет его, если он неизвестен
-	hostKeyCallback := func(hostname string, remote net.Addr, key ssh.PublicKey) error {
-		knownHostsChecker, err := knownhosts.New(knownHostsPath)
-		if err != nil {
-			if os.IsNotExist(err) {
-				// Файл не существует, создаем его и добавляем ключ
-				return addHostKeyToFile(knownHostsPath, hostname, key)
-			}
-			return err
+	// Каналы SSH не поддерживают deadline, поэтому рукопожатие через промежуточный хост
+	// ограничивается таймером, закрывающим соединение
+	var expired atomic.Bool
+	if timeout > 0 {
+		if conn.SetDeadline(time.Now().Add(timeout)) != nil {
+			timer := time.AfterFunc(timeout, func() {
+				expired.Store(true)
+				conn.Close()
+			})
+			defer timer.Stop()
 		}
-
-		err = knownHostsChecker(hostname, remote, key)
-		if knownErr, ok := err.(*knownhosts.KeyError); ok && len(knownErr.Want) == 0 {
-			// Ключ неизвестен (это 1яя попытка), добавляем его
-			return addHostKeyToFile(knownHostsPath, hostname, key)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, sshConfig)
+	if err != nil {
+		conn.Close()
+		if expired.Load() {
+			err = fmt.Errorf("%w (%s): %v", os.ErrDeadlineExceeded, timeout, err)
 		}
-		return err
+		return nil, contextError(ctx, err)
 	}
+	conn.SetDeadline(time.Time{})
+	return ssh.NewClient(sshConn, chans, reqs), nil
+}
 
-	sshConfig := &ssh.ClientConfig{
-		User:            c.config.SSHUser,
-		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
-		HostKeyCallback: hostKeyCallback,
+// closeLocked закрывает соединение и промежуточные хосты в обратном порядке. Вызывается под c.mu
+func (c *SSHClient) closeLocked() error {
+	var err error
+	if c.client != nil {
+		err = c.client.Close()
+		c.client = nil
 	}
+	for i := len(c.jumps) - 1; i >= 0; i-- {
+		c.jumps[i].Close()
+	}
+	c.jumps = nil
+	return err
+}
 
-	addr := fmt.Sprintf("%s:%d", c.config.SSHHost, c.config.SSHPort)
-	client, err := ssh.Dial("tcp", addr, sshConfig)
+// openSession открывает сессию на соединении. Отмена ctx закрывает сессию и прерывает
+// удаленную команду; возвращаемую функцию нужно вызвать по завершении работы с сессией
+func (c *SSHClient) openSession(ctx context.Context) (*ssh.Client, *ssh.Session, func(), error) {
+	client, err := c.connect(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка SSH-соединения: %w", err)
+		return nil, nil, nil, err
 	}
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("ошибка создания SSH-сессии: %w", err)
+	}
+	stop := context.AfterFunc(ctx, func() { session.Close() })
+	return client, session, func() {
+		stop()
+		session.Close()
+	}, nil
+}
 
-	c.client = client
-	return client, nil
+// abortTransfer возвращает функцию прерывания зависшей передачи для idleTimer. Закрывается только
+// сессия передачи: остальные передачи по общему соединению продолжаются. Если сервер не ответил
+// на keepalive-запрос за timeout, соединение потеряно и закрывается целиком; следующий connect установит новое
+func abortTransfer(client *ssh.Client, timeout time.Duration, closeSession func() error) func() {
+	return func() {
+		go closeSession()
+		replied := make(chan struct{})
+		go func() {
+			client.SendRequest("keepalive@openssh.com", true, nil)
+			close(replied)
+		}()
+		select {
+		case <-replied:
+		case <-time.After(timeout):
+			client.Close()
+		}
+	}
 }
 
 // Close закрывает SSH-клиент (вызывать при shutdown сервиса)
 func (c *SSHClient) Close() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	if c.client != nil {
-		err := c.client.Close()
-		c.client = nil
+	return c.closeLocked()
+}
+
+// UploadFile загружает файл на удаленный сервер по протоколу SCP
+func (c *SSHClient) UploadFile(ctx context.Context, fileName string, data io.Reader, size int64) error {
+	client, session, closeSession, err := c.openSession(ctx)
+	if err != nil {
 		return err
 	}
-	return nil
-}
+	defer closeSession()
 
-// UploadFile загружает файл на удаленный сервер, используя SCP для более простой и быстрой реализации
-func (c *SSHClient) UploadFile(fileName string, data *bytes.Buffer) error {
-	client, err := c.connect()
+	w, err := session.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("ошибка получения StdinPipe: %w", err)
+	}
+	stdout, err := session.StdoutPipe()
 	if err != nil {
+		return fmt.Errorf("ошибка получения stdout: %w", err)
+	}
+	var stderr bytes.Buffer
+	session.Stderr = &stderr
+
+	// Директория на сервере создается при необходимости, SCP получает только имя файла
+	dir := path.Dir(c.remotePath(fileName))
+	cmd := fmt.Sprintf("mkdir -p %s && scp -t %s", shellQuote(dir), shellQuote(dir))
+	if err := session.Start(cmd); err != nil {
+		return contextError(ctx, fmt.Errorf("ошибка запуска SCP: %w", err))
+	}
+
+	timer := startIdleTimer(c.config.TransferTimeout, abortTransfer(client, c.config.TransferTimeout, session.Close))
+	header := scpHeader{Mode: 0644, Size: size, Name: path.Base(fileName)}
+	sendErr := scpSend(w, bufio.NewReader(stdout), header, timer.reader(data))
+	w.Close()
+	if err := contextError(ctx, timer.stop(waitSCP(session, &stderr, sendErr))); err != nil {
 		return err
 	}
+	log.Println("Файл успешно загружен по SCP.")
+	return nil
+}
 
-	session, err := client.NewSession()
+// DownloadFile скачивает файл с удаленного сервера по протоколу SCP и записывает его в dst
+func (c *SSHClient) DownloadFile(ctx context.Context, fileName string, dst io.Writer) error {
+	client, session, closeSession, err := c.openSession(ctx)
 	if err != nil {
-		return fmt.Errorf("ошибка создания SSH-сессии: %w", err)
+		return err
 	}
-	defer session.Close()
+	defer closeSession()
 
 	w, err := session.StdinPipe()
 	if err != nil {
 		return fmt.Errorf("ошибка получения StdinPipe: %w", err)
 	}
+	reader, err := session.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("ошибка получения stdout: %w", err)
+	}
+	var stderr bytes.Buffer
+	session.Stderr = &stderr
 
-	go func() {
-		defer w.Close()
-		fmt.Fprintf(w, "C0644 %d %s\n", data.Len(), fileName)
-		io.Copy(w, data)
-		fmt.Fprint(w, "\x00")
-	}()
+	cmd := fmt.Sprintf("scp -f %s", shellQuote(c.remotePath(fileName)))
+	if err := session.Start(cmd); err != nil {
+		return contextError(ctx, fmt.Errorf("ошибка запуска SCP: %w", err))
+	}
 
-	cmd := "scp -t ."
-	if err := session.Run(cmd); err != nil {
-		return fmt.Errorf("ошибка выполнения SCP: %w", err)
+	timer := startIdleTimer(c.config.TransferTimeout, abortTransfer(client, c.config.TransferTimeout, session.Close))
+	_, recvErr := scpReceive(w, bufio.NewReader(reader), timer.writer(dst))
+	w.Close()
+	if err := contextError(ctx, timer.stop(waitSCP(session, &stderr, recvErr))); err != nil {
+		return err
 	}
-	log.Println("Файл успешно загружен по SCP.")
+
+	log.Println("Файл успешно скачан по SCP.")
 	return nil
 }
 
-// DownloadFile скачивает файл с удаленного сервера, используя SCP
-func (c *SSHClient) DownloadFile(fileName string) (*bytes.Buffer, error) {
-	client, err := c.connect()
+// DownloadFileFrom скачивает файл начиная с байта offset. SCP не умеет передавать часть файла,
+// поэтому данные читаются удаленной командой tail -c
+func (c *SSHClient) DownloadFileFrom(ctx context.Context, fileName string, offset int64, dst io.Writer) error {
+	if offset == 0 {
+		return c.DownloadFile(ctx, fileName, dst)
+	}
+	client, session, closeSession, err := c.openSession(ctx)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	defer closeSession()
 
-	session, err := client.NewSession()
+	timer := startIdleTimer(c.config.TransferTimeout, abortTransfer(client, c.config.TransferTimeout, session.Close))
+	var stderr bytes.Buffer
+	session.Stdout = timer.writer(dst)
+	session.Stderr = &stderr
+
+	p := shellQuote(c.remotePath(fileName))
+	err = session.Run(fmt.Sprintf("[ -f %s ] || exit %d; tail -c +%d %s", p, notExistStatus, offset+1, p))
+	if err = contextError(ctx, timer.stop(err)); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		return c.wrapNotExist(err, fileName, "ошибка скачивания файла")
+	}
+	return nil
+}
+
+// waitSCP дожидается завершения удаленной команды SCP. Ошибка протокола важнее кода выхода,
+// так как содержит сообщение удаленной стороны
+func waitSCP(session *ssh.Session, stderr *bytes.Buffer, protoErr error) error {
+	waitErr := session.Wait()
+	if protoErr != nil {
+		var scpErr *SCPError
+		if !errors.As(protoErr, &scpErr) {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return fmt.Errorf("%w (%s)", protoErr, msg)
+			}
+		}
+		return protoErr
+	}
+	if waitErr != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("ошибка выполнения SCP: %w: %s", waitErr, msg)
+		}
+		return fmt.Errorf("ошибка выполнения SCP: %w", waitErr)
+	}
+	return nil
+}
+
+// List возвращает содержимое директории на сервере
+func (c *SSHClient) List(ctx context.Context, dir string) ([]FileInfo, error) {
+	p := shellQuote(c.remotePath(dir))
+	out, err := c.run(ctx, fmt.Sprintf("[ -d %s ] || exit %d\n", p, notExistStatus)+
+		findOrStat(p, "-mindepth 1 -maxdepth 1", `cd `+p+` || exit 1
+for f in * .[!.]* ..?*; do
+	[ -e "$f" ] || [ -L "$f" ] || continue
+	entry "$f" "$f"
+done`))
 	if err != nil {
-		return nil, fmt.Errorf("ошибка создания SSH-сессии: %w", err)
+		return nil, c.wrapNotExist(err, dir, "ошибка получения списка файлов")
 	}
-	defer session.Close()
 
-	reader, err := session.StdoutPipe()
+	var files []FileInfo
+	for _, line := range strings.Split(string(out), "\n") {
+		if line == "" {
+			continue
+		}
+		info, err := parseFindLine(line)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, info)
+	}
+	return files, nil
+}
+
+// Stat возвращает информацию о файле на сервере
+func (c *SSHClient) Stat(ctx context.Context, fileName string) (*FileInfo, error) {
+	p := shellQuote(c.remotePath(fileName))
+	out, err := c.run(ctx, fmt.Sprintf("[ -e %s ] || exit %d\n", p, notExistStatus)+
+		findOrStat(p, "-maxdepth 0", `entry `+p+` "$(basename `+p+`)"`))
+	if err != nil {
+		return nil, c.wrapNotExist(err, fileName, "ошибка получения информации о файле")
+	}
+	info, err := parseFindLine(strings.TrimSpace(string(out)))
 	if err != nil {
-		return nil, fmt.Errorf("ошибка получения stdout: %w", err)
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Delete удаляет файл на сервере
+func (c *SSHClient) Delete(ctx context.Context, fileName string) error {
+	p := shellQuote(c.remotePath(fileName))
+	if _, err := c.run(ctx, fmt.Sprintf("[ -e %s ] || exit %d; rm -f %s", p, notExistStatus, p)); err != nil {
+		return c.wrapNotExist(err, fileName, "ошибка удаления файла")
 	}
+	return nil
+}
 
-	errChan := make(chan error, 1)
-	go func() {
-		defer close(errChan)
-		cmd := fmt.Sprintf("scp -f %s", fileName)
-		errChan <- session.Run(cmd)
-	}()
+// Rename атомарно переименовывает файл на сервере
+func (c *SSHClient) Rename(ctx context.Context, oldName, newName string) error {
+	oldPath, newPath := c.remotePath(oldName), c.remotePath(newName)
+	cmd := fmt.Sprintf("mkdir -p %s && mv -f %s %s", shellQuote(path.Dir(newPath)), shellQuote(oldPath), shellQuote(newPath))
+	if _, err := c.run(ctx, cmd); err != nil {
+		return fmt.Errorf("ошибка переименования %s: %w", oldName, err)
+	}
+	return nil
+}
 
-	var buf bytes.Buffer
-	_, err = io.Copy(&buf, reader)
+// run выполняет команду на удаленном сервере в отдельной сессии и возвращает ее вывод
+func (c *SSHClient) run(ctx context.Context, cmd string) ([]byte, error) {
+	_, session, closeSession, err := c.openSession(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка чтения данных: %w", err)
+		return nil, err
+	}
+	defer closeSession()
+
+	var stdout, stderr bytes.Buffer
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+	if err := contextError(ctx, session.Run(cmd)); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
 	}
+	return stdout.Bytes(), nil
+}
 
-	if err := <-errChan; err != nil {
-		return nil, fmt.Errorf("ошибка выполнения SCP: %w", err)
+// wrapNotExist переводит код выхода notExistStatus в fs.ErrNotExist
+func (c *SSHClient) wrapNotExist(err error, name, msg string) error {
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitStatus() == notExistStatus {
+		return fmt.Errorf("%s: %w", name, fs.ErrNotExist)
 	}
+	return fmt.Errorf("%s %s: %w", msg, name, err)
+}
 
-	log.Println("Файл успешно скачан по SCP.")
-	return &buf, nil
+// findOrStat возвращает команду, которая выводит строки в формате find -printf '%y %s %T@ %f' для
+// файлов find p depth. Ключ -printf есть только в GNU find; в BSD и busybox find (macOS, FreeBSD,
+// Alpine) его нет, и тогда выполняется fallback: в нем функция entry путь имя выводит такую же строку,
+// определяя тип через test, а размер и время изменения - через stat -c (GNU, busybox) или stat -f (BSD)
+func findOrStat(p, depth, fallback string) string {
+	return `if find ` + p + ` -maxdepth 0 -printf '' >/dev/null 2>&1; then
+	exec find ` + p + ` ` + depth + ` -printf '%y %s %T@ %f\n'
+fi
+if stat -c %s / >/dev/null 2>&1; then
+	st() { stat -c '%s %Y' -- "$1"; }
+else
+	st() { stat -f '%z %m' -- "$1"; }
+fi
+entry() {
+	t=f
+	if [ -d "$1" ] && [ ! -L "$1" ]; then t=d; fi
+	s=$(st "$1") || exit 1
+	printf '%s %s %s\n' "$t" "$s" "$2"
+}
+` + fallback
+}
+
+// parseFindLine разбирает строку вывода find -printf '%y %s %T@ %f' (или fallback из findOrStat)
+func parseFindLine(line string) (FileInfo, error) {
+	fields := strings.SplitN(line, " ", 4)
+	if len(fields) != 4 {
+		return FileInfo{}, fmt.Errorf("неожиданный вывод find: %q", line)
+	}
+	size, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return FileInfo{}, fmt.Errorf("неожиданный размер файла в выводе find: %q", line)
+	}
+	mtime, err := strconv.ParseFloat(fields[2], 64)
+	if err != nil {
+		return FileInfo{}, fmt.Errorf("неожиданное время изменения в выводе find: %q", line)
+	}
+	return FileInfo{
+		Name:    fields[3],
+		Size:    size,
+		ModTime: time.Unix(0, int64(mtime*float64(time.Second))),
+		IsDir:   fields[0] == "d",
+	}, nil
+}
+
+// shellQuote экранирует аргумент для передачи в удаленную командную оболочку
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
 }
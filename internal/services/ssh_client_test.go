@@ -0,0 +1,553 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"package-manager/internal/config"
+)
+
+// startTestSSHServer запускает SSH-сервер в процессе теста. Команды exec выполняются
+// через sh в директории root, поэтому используются настоящие scp, find и mv
+func startTestSSHServer(t *testing.T, root string) *net.TCPAddr {
+	t.Helper()
+	return startTestSSHServerWithConfig(t, root, &ssh.ServerConfig{
+		PublicKeyCallback: func(ssh.ConnMetadata, ssh.PublicKey) (*ssh.Permissions, error) {
+			return nil, nil
+		},
+	})
+}
+
+// startTestSSHServerWithConfig запускает тестовый SSH-сервер с заданными способами аутентификации
+func startTestSSHServerWithConfig(t *testing.T, root string, serverConfig *ssh.ServerConfig) *net.TCPAddr {
+	t.Helper()
+
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Не удалось создать ключ сервера: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatalf("Не удалось создать ключ сервера: %v", err)
+	}
+	serverConfig.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Не удалось запустить SSH-сервер: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveTestSSHConn(conn, serverConfig, root)
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr)
+}
+
+func serveTestSSHConn(conn net.Conn, serverConfig *ssh.ServerConfig, root string) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, serverConfig)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() == "direct-tcpip" {
+			go serveTestSSHTunnel(newChannel)
+			continue
+		}
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go serveTestSSHSession(channel, requests, root)
+	}
+}
+
+// testTunnels считает туннели direct-tcpip, открытые через тестовые серверы
+var testTunnels atomic.Int32
+
+// serveTestSSHTunnel пробрасывает канал direct-tcpip (ProxyJump) на запрошенный адрес
+func serveTestSSHTunnel(newChannel ssh.NewChannel) {
+	var target struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &target); err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	conn, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	testTunnels.Add(1)
+	go ssh.DiscardRequests(requests)
+	go func() {
+		io.Copy(conn, channel)
+		conn.Close()
+	}()
+	io.Copy(channel, conn)
+	channel.Close()
+}
+
+func serveTestSSHSession(channel ssh.Channel, requests <-chan *ssh.Request, root string) {
+	defer channel.Close()
+	for req := range requests {
+		var payload struct{ Command string }
+		if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+			req.Reply(false, nil)
+			continue
+		}
+		if req.Type == "subsystem" && payload.Command == "sftp" {
+			req.Reply(true, nil)
+			server, err := sftp.NewServer(channel, sftp.WithServerWorkingDirectory(root))
+			if err != nil {
+				return
+			}
+			server.Serve()
+			return
+		}
+		if req.Type != "exec" {
+			req.Reply(false, nil)
+			continue
+		}
+		req.Reply(true, nil)
+
+		cmd := exec.Command("sh", "-c", payload.Command)
+		cmd.Dir = root
+		cmd.Stdout = channel
+		cmd.Stderr = channel.Stderr()
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return
+		}
+		// Stdin копируется отдельно: иначе Wait ждал бы закрытия канала клиентом
+		go func() {
+			io.Copy(stdin, channel)
+			stdin.Close()
+		}()
+
+		status := uint32(0)
+		if err := cmd.Run(); err != nil {
+			status = 255
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				status = uint32(exitErr.ExitCode())
+			}
+		}
+		exitStatus := make([]byte, 4)
+		binary.BigEndian.PutUint32(exitStatus, status)
+		channel.SendRequest("exit-status", false, exitStatus)
+		return
+	}
+}
+
+// newTestSSHConfig запускает тестовый сервер и возвращает конфигурацию для подключения к нему.
+// Непустой repoDir задает корень репозитория (поддиректорию сервера) через URL со схемой scheme
+func newTestSSHConfig(t *testing.T, scheme, repoDir string) (*config.Config, string) {
+	t.Helper()
+
+	serverRoot := t.TempDir()
+	addr := startTestSSHServer(t, serverRoot)
+
+	// known_hosts записывается в домашнюю директорию, поэтому подменяем ее
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	_, clientKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Не удалось создать ключ клиента: %v", err)
+	}
+	block, err := ssh.MarshalPrivateKey(clientKey, "")
+	if err != nil {
+		t.Fatalf("Не удалось сериализовать ключ клиента: %v", err)
+	}
+	keyPath := filepath.Join(home, "id_ed25519")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("Не удалось записать ключ клиента: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(home, ".ssh"), 0700); err != nil {
+		t.Fatalf("Не удалось создать директорию .ssh: %v", err)
+	}
+
+	repository := ""
+	if repoDir != "" {
+		repository = scheme + "://pm@" + addr.String() + filepath.ToSlash(filepath.Join(serverRoot, repoDir))
+	}
+	return &config.Config{
+		SSHUser:       "pm",
+		SSHHost:       addr.IP.String(),
+		SSHPort:       addr.Port,
+		SSHKey:        keyPath,
+		Repository:    repository,
+		HostKeyPolicy: "accept-new",
+	}, serverRoot
+}
+
+// newTestSSHClient создает SSHClient, подключенный к тестовому серверу
+func newTestSSHClient(t *testing.T, repoDir string) (*SSHClient, string) {
+	t.Helper()
+	if _, err := exec.LookPath("scp"); err != nil {
+		t.Skip("scp не установлен")
+	}
+
+	cfg, serverRoot := newTestSSHConfig(t, "ssh", repoDir)
+	client := NewSSHClient(cfg)
+	t.Cleanup(func() { client.Close() })
+	return client, serverRoot
+}
+
+// TestSSHClientSCPRoundTrip проверяет загрузку и скачивание по SCP через настоящий scp на сервере
+func TestSSHClientSCPRoundTrip(t *testing.T) {
+	client, serverRoot := newTestSSHClient(t, "")
+
+	// Бинарные данные с нулевыми байтами и переводами строк проверяют отсутствие искажений
+	data := bytes.Repeat([]byte("PK\x03\x04\x00\n\x01\x02"), 4096)
+	if err := uploadBytes(client, "pkg/pkg-1.0.zip", data); err != nil {
+		t.Fatalf("Ошибка загрузки: %v", err)
+	}
+	onServer, err := os.ReadFile(filepath.Join(serverRoot, "pkg", "pkg-1.0.zip"))
+	if err != nil || !bytes.Equal(onServer, data) {
+		t.Fatalf("Файл на сервере не совпадает с загруженным (%v)", err)
+	}
+
+	buf, err := downloadBytes(client, "pkg/pkg-1.0.zip")
+	if err != nil {
+		t.Fatalf("Ошибка скачивания: %v", err)
+	}
+	if !bytes.Equal(buf, data) {
+		t.Errorf("Скачанные данные не совпадают: получено %d байт, ожидалось %d", len(buf), len(data))
+	}
+
+	// Продолжение скачивания со смещения
+	var tail bytes.Buffer
+	if err := client.DownloadFileFrom(t.Context(), "pkg/pkg-1.0.zip", 1000, &tail); err != nil || !bytes.Equal(tail.Bytes(), data[1000:]) {
+		t.Errorf("Ожидался остаток файла с 1000 байта, получено %d байт (%v)", tail.Len(), err)
+	}
+	if err := client.DownloadFileFrom(t.Context(), "pkg/missing.zip", 1000, io.Discard); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Ожидалась ошибка fs.ErrNotExist, получено: %v", err)
+	}
+
+	// Отмененная операция прерывается
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	if err := client.DownloadFile(ctx, "pkg/pkg-1.0.zip", io.Discard); !errors.Is(err, context.Canceled) {
+		t.Errorf("Ожидалась ошибка context.Canceled, получено: %v", err)
+	}
+
+	// Пустой файл передается корректно
+	if err := uploadBytes(client, "empty.txt", nil); err != nil {
+		t.Fatalf("Ошибка загрузки пустого файла: %v", err)
+	}
+	if buf, err := downloadBytes(client, "empty.txt"); err != nil || len(buf) != 0 {
+		t.Errorf("Ожидался пустой файл, получено %d байт (%v)", len(buf), err)
+	}
+}
+
+// TestSSHClientSCPErrors проверяет передачу сообщений об ошибках сервера в виде SCPError
+func TestSSHClientSCPErrors(t *testing.T) {
+	client, serverRoot := newTestSSHClient(t, "")
+
+	_, err := downloadBytes(client, "missing.zip")
+	var scpErr *SCPError
+	if !errors.As(err, &scpErr) {
+		t.Fatalf("Ожидалась ошибка SCPError, получено: %v", err)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Ожидалась ошибка, совместимая с fs.ErrNotExist: %v", err)
+	}
+
+	// Приемник отклоняет запись поверх директории и сообщает об этом через \x01
+	if err := os.Mkdir(filepath.Join(serverRoot, "pkg.zip"), 0755); err != nil {
+		t.Fatalf("Не удалось создать директорию: %v", err)
+	}
+	err = uploadBytes(client, "pkg.zip", []byte("data"))
+	if !errors.As(err, &scpErr) {
+		t.Errorf("Ожидалась ошибка SCPError, получено: %v", err)
+	}
+}
+
+// TestSSHClientFileOperations проверяет Stat, List, Rename и Delete в корне из ssh:// URL
+func TestSSHClientFileOperations(t *testing.T) {
+	client, serverRoot := newTestSSHClient(t, "repo")
+
+	if err := uploadBytes(client, "pkg/.index.json.tmp", []byte("{}")); err != nil {
+		t.Fatalf("Ошибка загрузки: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(serverRoot, "repo", "pkg", ".index.json.tmp")); err != nil {
+		t.Fatalf("Ожидался файл в корне репозитория на сервере: %v", err)
+	}
+	if err := client.Rename(t.Context(), "pkg/.index.json.tmp", "pkg/index.json"); err != nil {
+		t.Fatalf("Ошибка переименования: %v", err)
+	}
+
+	info, err := client.Stat(t.Context(), "pkg/index.json")
+	if err != nil || info.Size != 2 || info.IsDir {
+		t.Errorf("Неожиданный результат Stat: %+v (%v)", info, err)
+	}
+	if _, err := client.Stat(t.Context(), "pkg/missing.json"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Ожидалась ошибка fs.ErrNotExist, получено: %v", err)
+	}
+
+	files, err := client.List(t.Context(), "pkg")
+	if err != nil || len(files) != 1 || files[0].Name != "index.json" {
+		t.Errorf("Неожиданный результат List: %+v (%v)", files, err)
+	}
+
+	if err := client.Delete(t.Context(), "pkg/index.json"); err != nil {
+		t.Fatalf("Ошибка удаления: %v", err)
+	}
+	if err := client.Delete(t.Context(), "pkg/index.json"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Ожидалась ошибка fs.ErrNotExist при повторном удалении, получено: %v", err)
+	}
+}
+
+// TestSSHClientListWithoutFindPrintf проверяет List и Stat на сервере, где find не поддерживает -printf
+// (BSD, busybox): результат должен совпадать с результатом GNU find
+func TestSSHClientListWithoutFindPrintf(t *testing.T) {
+	for _, portable := range []bool{false, true} {
+		t.Run(fmt.Sprintf("portable=%v", portable), func(t *testing.T) {
+			client, serverRoot := newTestSSHClient(t, "")
+			if portable {
+				// Команды тестового сервера наследуют PATH процесса теста
+				bin := t.TempDir()
+				script := "#!/bin/sh\necho 'find: unrecognized: -printf' >&2\nexit 1\n"
+				if err := os.WriteFile(filepath.Join(bin, "find"), []byte(script), 0755); err != nil {
+					t.Fatalf("Не удалось создать find: %v", err)
+				}
+				t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+			}
+			writeTestTree(t, filepath.Join(serverRoot, "pkg"), map[string]string{
+				"index.json":      "{}",
+				".hidden":         "abc",
+				"with space.zip":  "data",
+				"1.0/pkg-1.0.zip": "zip",
+			})
+			modTime := time.Unix(1700000000, 0)
+			if err := os.Chtimes(filepath.Join(serverRoot, "pkg", "index.json"), modTime, modTime); err != nil {
+				t.Fatalf("Не удалось изменить время файла: %v", err)
+			}
+
+			files, err := client.List(t.Context(), "pkg")
+			if err != nil {
+				t.Fatalf("Ошибка List: %v", err)
+			}
+			got := map[string]FileInfo{}
+			for _, file := range files {
+				got[file.Name] = file
+			}
+			if len(got) != 4 || !got["1.0"].IsDir || got["with space.zip"].Size != 4 || got[".hidden"].Size != 3 ||
+				!got["index.json"].ModTime.Equal(modTime) {
+				t.Errorf("Неожиданный результат List: %+v", files)
+			}
+			if _, err := client.List(t.Context(), "missing"); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("Ожидалась ошибка fs.ErrNotExist для List, получено: %v", err)
+			}
+
+			info, err := client.Stat(t.Context(), "pkg/with space.zip")
+			if err != nil || info.Name != "with space.zip" || info.Size != 4 || info.IsDir {
+				t.Errorf("Неожиданный результат Stat: %+v (%v)", info, err)
+			}
+			if info, err := client.Stat(t.Context(), "pkg/1.0"); err != nil || !info.IsDir {
+				t.Errorf("Ожидалась директория, получено: %+v (%v)", info, err)
+			}
+			if _, err := client.Stat(t.Context(), "pkg/missing"); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("Ожидалась ошибка fs.ErrNotExist для Stat, получено: %v", err)
+			}
+		})
+	}
+}
+
+// TestSCPReceiveProtocol проверяет разбор потока источника: время, заголовок, данные и статус
+func TestSCPReceiveProtocol(t *testing.T) {
+	stream := "T1700000000 0 1700000000 0\nC0640 5 pkg.zip\nhello\x00"
+	var acks, data bytes.Buffer
+	header, err := scpReceive(&acks, bufio.NewReader(strings.NewReader(stream)), &data)
+	if err != nil {
+		t.Fatalf("Ошибка приема: %v", err)
+	}
+	if header.Name != "pkg.zip" || header.Mode != 0640 || header.Size != 5 || data.String() != "hello" {
+		t.Errorf("Неожиданный результат приема: %+v, %q", header, data.String())
+	}
+	// Подтверждения: начальное, после T, после C, после данных
+	if acks.Len() != 4 {
+		t.Errorf("Ожидалось 4 подтверждения, отправлено %d", acks.Len())
+	}
+
+	_, err = scpReceive(io.Discard, bufio.NewReader(strings.NewReader("\x02scp: disk full\n")), io.Discard)
+	var scpErr *SCPError
+	if !errors.As(err, &scpErr) || !scpErr.Fatal || scpErr.Message != "scp: disk full" {
+		t.Errorf("Ожидалась фатальная ошибка SCP, получено: %v", err)
+	}
+
+	_, err = scpReceive(io.Discard, bufio.NewReader(strings.NewReader("C0644 10 pkg.zip\nshort")), io.Discard)
+	if err == nil {
+		t.Error("Ожидалась ошибка для усеченных данных")
+	}
+}
+
+// TestSSHClientProxyJump проверяет подключение к серверу через цепочку промежуточных хостов
+func TestSSHClientProxyJump(t *testing.T) {
+	client, serverRoot := newTestSSHClient(t, "")
+	cfg := client.config
+	for range 2 {
+		jump := startTestSSHServer(t, t.TempDir())
+		cfg.SSHJumps = append(cfg.SSHJumps, config.SSHJump{
+			Host: jump.IP.String(),
+			Port: jump.Port,
+			User: "pm",
+			Key:  cfg.SSHKey,
+		})
+	}
+	tunnels := testTunnels.Load()
+
+	if err := uploadBytes(client, "pkg.zip", []byte("data")); err != nil {
+		t.Fatalf("Ошибка загрузки через промежуточные хосты: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(serverRoot, "pkg.zip")); err != nil || string(data) != "data" {
+		t.Errorf("Неожиданное содержимое файла на сервере: %q (%v)", data, err)
+	}
+	// Первый хост пробрасывает соединение ко второму, второй - к целевому серверу
+	if got := testTunnels.Load() - tunnels; got != 2 || len(client.jumps) != 2 {
+		t.Errorf("Ожидалось 2 туннеля и 2 промежуточных соединения, получено %d и %d", got, len(client.jumps))
+	}
+
+	// Закрепленный отпечаток относится только к целевому серверу: промежуточные хосты
+	// проверяются по known_hosts, куда они записаны при первом подключении
+	home, _ := os.UserHomeDir()
+	checker, err := knownhosts.New(filepath.Join(home, ".ssh", "known_hosts"))
+	if err != nil {
+		t.Fatalf("Не удалось прочитать known_hosts: %v", err)
+	}
+	target := net.JoinHostPort(cfg.SSHHost, strconv.Itoa(cfg.SSHPort))
+	var keyErr *knownhosts.KeyError
+	if !errors.As(checker(target, &net.TCPAddr{}, probeKey{}), &keyErr) || len(keyErr.Want) == 0 {
+		t.Fatalf("Ключ целевого сервера не записан в known_hosts")
+	}
+	client.Close()
+	cfg.HostKeyPolicy = "strict"
+	cfg.HostKeyFingerprint = ssh.FingerprintSHA256(keyErr.Want[0].Key)
+	if err := uploadBytes(client, "pkg.zip", []byte("data")); err != nil {
+		t.Errorf("Ожидалось подключение по закрепленному отпечатку через промежуточные хосты: %v", err)
+	}
+	client.Close()
+	cfg.HostKeyFingerprint = "SHA256:AAAA"
+	err = uploadBytes(client, "pkg.zip", []byte("data"))
+	var hostKeyErr *HostKeyError
+	if !errors.As(err, &hostKeyErr) || hostKeyErr.Host != target || strings.Contains(err.Error(), "промежуточным хостом") {
+		t.Errorf("Ожидалась ошибка несовпадения отпечатка целевого сервера, получено: %v", err)
+	}
+	cfg.HostKeyFingerprint = ""
+
+	// Недоступный промежуточный хост указывается в ошибке
+	client.Close()
+	cfg.SSHJumps[1].Port = 1
+	if err := uploadBytes(client, "pkg.zip", []byte("data")); err == nil || !strings.Contains(err.Error(), "промежуточным хостом") {
+		t.Errorf("Ожидалась ошибка подключения к промежуточному хосту, получено: %v", err)
+	}
+}
+
+// stalledWriter задерживает первую запись: передача простаивает, хотя соединение исправно
+type stalledWriter struct {
+	w     io.Writer
+	delay time.Duration
+	once  sync.Once
+}
+
+func (s *stalledWriter) Write(p []byte) (int, error) {
+	s.once.Do(func() { time.Sleep(s.delay) })
+	return s.w.Write(p)
+}
+
+// TestTransferTimeoutKeepsConnection проверяет, что таймаут зависшей передачи закрывает только ее сессию:
+// параллельная передача по тому же SSH-соединению завершается, соединение не переустанавливается
+func TestTransferTimeoutKeepsConnection(t *testing.T) {
+	for _, scheme := range []string{"ssh", "sftp"} {
+		t.Run(scheme, func(t *testing.T) {
+			if _, err := exec.LookPath("scp"); err != nil && scheme == "ssh" {
+				t.Skip("scp не установлен")
+			}
+			cfg, serverRoot := newTestSSHConfig(t, scheme, "")
+			cfg.TransferTimeout = 200 * time.Millisecond
+			// Файл больше окна SSH-канала: к срабатыванию таймера он не успевает попасть в буферы клиента
+			data := bytes.Repeat([]byte("0123456789abcdef"), 1<<19)
+			if err := os.WriteFile(filepath.Join(serverRoot, "big.bin"), data, 0644); err != nil {
+				t.Fatalf("Не удалось создать файл: %v", err)
+			}
+
+			var (
+				backend Backend
+				conn    func() *ssh.Client
+			)
+			if scheme == "ssh" {
+				client := NewSSHClient(cfg)
+				backend, conn = client, func() *ssh.Client { return client.client }
+			} else {
+				client := NewSFTPClient(cfg)
+				backend, conn = client, func() *ssh.Client { return client.ssh.client }
+			}
+			defer backend.Close()
+			if _, err := backend.Stat(t.Context(), "big.bin"); err != nil {
+				t.Fatalf("Не удалось подключиться: %v", err)
+			}
+			before := conn()
+
+			stalled := make(chan error, 1)
+			go func() {
+				stalled <- backend.DownloadFile(t.Context(), "big.bin", &stalledWriter{w: io.Discard, delay: time.Second})
+			}()
+			var buf bytes.Buffer
+			if err := backend.DownloadFile(t.Context(), "big.bin", &buf); err != nil || !bytes.Equal(buf.Bytes(), data) {
+				t.Errorf("Параллельная передача не завершилась: %d байт (%v)", buf.Len(), err)
+			}
+			if err := <-stalled; !errors.Is(err, ErrTransferTimeout) {
+				t.Errorf("Ожидалась ошибка ErrTransferTimeout для зависшей передачи, получено: %v", err)
+			}
+			if _, err := backend.Stat(t.Context(), "big.bin"); err != nil || conn() != before {
+				t.Errorf("Ожидалось то же SSH-соединение после таймаута передачи (%v)", err)
+			}
+		})
+	}
+}
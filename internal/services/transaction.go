@@ -0,0 +1,341 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"package-manager/internal/models"
+)
+
+const (
+	// stagingDirName - директория незавершенных установок в директории состояния
+	stagingDirName = "staging"
+	// backupDirName - директория с файлами предыдущих версий пакетов в директории состояния
+	backupDirName = "backup"
+)
+
+// stagingPath возвращает директорию установки пакета, которая еще не перенесена на место
+func stagingPath(root, name string) string {
+	return filepath.Join(root, stateDirName, stagingDirName, name)
+}
+
+// backupPath возвращает директорию с файлами предыдущей версии пакета
+func backupPath(root, name string) string {
+	return filepath.Join(root, stateDirName, backupDirName, name)
+}
+
+// fileMove - перемещение файла, выполненное при переносе установки
+type fileMove struct {
+	from, to string
+}
+
+// fileSwap переносит файлы в корень установки и запоминает перемещения и созданные директории,
+// чтобы их можно было отменить
+type fileSwap struct {
+	root    string
+	r       *os.Root
+	moves   []fileMove
+	created []string
+}
+
+// mkdirAll создает директорию dir (путь относительно корня установки) внутри root.
+// Существующие ссылки, ведущие за пределы корня установки, не используются
+func (s *fileSwap) mkdirAll(dir string) error {
+	if dir == "." {
+		return nil
+	}
+	parts := strings.Split(dir, "/")
+	for i := range parts {
+		current := strings.Join(parts[:i+1], "/")
+		info, err := s.r.Stat(current)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("%s не является директорией", current)
+			}
+			continue
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		if err := s.r.Mkdir(current, 0755); err != nil {
+			return err
+		}
+		s.created = append(s.created, current)
+	}
+	return nil
+}
+
+// move перемещает файл и создает недостающие директории назначения
+func (s *fileSwap) move(from, to string) error {
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(from, to); err != nil {
+		return err
+	}
+	s.moves = append(s.moves, fileMove{from: from, to: to})
+	return nil
+}
+
+// undo возвращает перемещенные файлы на прежние места и удаляет созданные директории
+func (s *fileSwap) undo() {
+	for i := len(s.moves) - 1; i >= 0; i-- {
+		m := s.moves[i]
+		if err := os.Rename(m.to, m.from); err != nil {
+			log.Printf("Не удалось вернуть %s на место: %v", m.from, err)
+		}
+	}
+	for i := len(s.created) - 1; i >= 0; i-- {
+		s.r.Remove(s.created[i])
+	}
+	s.moves, s.created = nil, nil
+}
+
+// swapInstall переносит файлы pkg из staging в корень установки. Заменяемые файлы и файлы
+// установленной версии, которых нет в новой, переносятся в backup. При ошибке все изменения отменяются
+func swapInstall(root string, r *os.Root, staging, backup string, pkg models.InstalledPackage, stale []string) (*fileSwap, error) {
+	s := &fileSwap{root: root, r: r}
+	for _, file := range pkg.Files {
+		name := strings.TrimSuffix(file, "/")
+		if name != file {
+			if err := s.mkdirAll(name); err != nil {
+				s.undo()
+				return nil, fmt.Errorf("ошибка создания директории %s: %w", name, err)
+			}
+			continue
+		}
+		if err := s.replace(staging, backup, name); err != nil {
+			s.undo()
+			return nil, err
+		}
+	}
+	for _, file := range stale {
+		if strings.HasSuffix(file, "/") {
+			continue
+		}
+		target := filepath.Join(root, filepath.FromSlash(file))
+		if _, err := os.Lstat(target); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err := s.move(target, filepath.Join(backup, filepath.FromSlash(file))); err != nil {
+			s.undo()
+			return nil, fmt.Errorf("ошибка сохранения файла %s: %w", file, err)
+		}
+	}
+	return s, nil
+}
+
+// replace переносит файл name из staging на место, сохраняя существующий файл в backup.
+// Файл, которого нет в staging, но который уже лежит на месте, не трогается
+func (s *fileSwap) replace(staging, backup, name string) error {
+	source := filepath.Join(staging, filepath.FromSlash(name))
+	target := filepath.Join(s.root, filepath.FromSlash(name))
+	if _, err := os.Lstat(source); errors.Is(err, fs.ErrNotExist) {
+		if _, err := os.Lstat(target); err == nil {
+			return nil
+		}
+		return fmt.Errorf("файл %s не найден", name)
+	}
+	if err := s.mkdirAll(path.Dir(name)); err != nil {
+		return fmt.Errorf("ошибка создания директории %s: %w", path.Dir(name), err)
+	}
+	if info, err := os.Lstat(target); err == nil {
+		if info.IsDir() {
+			return fmt.Errorf("на месте файла %s находится директория", name)
+		}
+		if err := s.move(target, filepath.Join(backup, filepath.FromSlash(name))); err != nil {
+			return fmt.Errorf("ошибка сохранения файла %s: %w", name, err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := s.move(source, target); err != nil {
+		return fmt.Errorf("ошибка установки файла %s: %w", name, err)
+	}
+	return nil
+}
+
+// commitInstall переносит подготовленные в staging файлы пакета в корень установки (или в dest пакета)
+// и записывает пакет в базу. Файлы заменяемой версии сохраняются для pm rollback.
+// Если перенос или запись базы не удались, корень установки возвращается в прежнее состояние
+func commitInstall(root, staging string, pkg models.InstalledPackage) error {
+	db, err := readInstalledDB(root)
+	if err != nil {
+		return err
+	}
+	var previous *models.InstalledPackage
+	i := findInstalled(db, pkg.Name)
+	if i >= 0 {
+		previous = &db.Packages[i]
+	}
+	// Версия из другой директории установки не заменяется файл за файлом: ее файлы удаляются
+	// после установки новой, и откат к ней недоступен
+	var moved *models.InstalledPackage
+	if previous != nil && previous.Dest != pkg.Dest {
+		prev := *previous
+		moved = &prev
+	}
+
+	var stale []string
+	if previous != nil && moved == nil {
+		current := make(map[string]bool, len(pkg.Files))
+		for _, file := range pkg.Files {
+			current[file] = true
+		}
+		owned := ownedByOthers(db, pkg.Name, pkg.Dest)
+		for _, file := range previous.Files {
+			if !current[file] && !owned[file] {
+				stale = append(stale, file)
+			}
+		}
+	}
+
+	base := installedBase(root, &pkg)
+	r, err := os.OpenRoot(base)
+	if err != nil {
+		return fmt.Errorf("не удалось открыть корень установки %s: %w", base, err)
+	}
+	defer r.Close()
+
+	// Файлы заменяемой версии собираются рядом с staging и заменяют прежнюю копию только после записи базы
+	newBackup := staging + ".backup"
+	if err := os.RemoveAll(newBackup); err != nil {
+		return fmt.Errorf("ошибка подготовки копии пакета %s: %w", pkg.Name, err)
+	}
+	swap, err := swapInstall(base, r, staging, newBackup, pkg, stale)
+	if err != nil {
+		os.RemoveAll(newBackup)
+		return fmt.Errorf("установка пакета %s отменена: %w", pkg.Name, err)
+	}
+
+	pkg.Installed = time.Now().UTC()
+	pkg.Previous = nil
+	if moved != nil {
+		db.Packages[i] = pkg
+	} else if previous != nil {
+		prev := *previous
+		prev.Previous = nil
+		pkg.Previous = &prev
+		db.Packages[i] = pkg
+	} else {
+		db.Packages = append(db.Packages, pkg)
+	}
+	if err := writeInstalledDB(root, db); err != nil {
+		swap.undo()
+		os.RemoveAll(newBackup)
+		return fmt.Errorf("установка пакета %s отменена: %w", pkg.Name, err)
+	}
+
+	if moved != nil {
+		movedBase := installedBase(root, moved)
+		owned := ownedByOthers(db, moved.Name, moved.Dest)
+		var files []string
+		for _, file := range moved.Files {
+			if !owned[file] {
+				files = append(files, file)
+			}
+		}
+		removeInstalledFiles(movedBase, files)
+		os.RemoveAll(backupPath(movedBase, moved.Name))
+		log.Printf("Пакет %s перенесен из %s: файлы версии %s удалены, откат к ней недоступен.", pkg.Name, movedBase, moved.Ver)
+	}
+
+	backup := backupPath(base, pkg.Name)
+	if err := os.RemoveAll(backup); err != nil {
+		log.Printf("Не удалось удалить прежнюю копию пакета %s: %v", pkg.Name, err)
+	}
+	if _, err := os.Stat(newBackup); err == nil {
+		err = os.MkdirAll(filepath.Dir(backup), 0755)
+		if err == nil {
+			err = os.Rename(newBackup, backup)
+		}
+		if err != nil {
+			log.Printf("Не удалось сохранить файлы предыдущей версии пакета %s: %v", pkg.Name, err)
+		}
+	}
+	removeEmptyDirs(r, stale)
+	return nil
+}
+
+// installArchive распаковывает архив пакета в staging и переносит его в корень установки.
+// Ошибка или отмена ctx до переноса оставляют установленные файлы без изменений
+func (pm *PackageManager) installArchive(ctx context.Context, root, archiveName string, spool *spoolFile, target installTarget, pkg models.LockedPackage) error {
+	// Для dest вне корня установки staging лежит в самом dest: перенос файлов не пересекает файловые системы
+	staging := stagingPath(target.base(root), pkg.Name)
+	if err := os.RemoveAll(staging); err != nil {
+		return fmt.Errorf("ошибка подготовки директории %s: %w", staging, err)
+	}
+	defer os.RemoveAll(staging)
+
+	stagedTarget := target
+	stagedTarget.dir = filepath.Join(staging, filepath.FromSlash(target.subdir))
+	files, err := pm.extractArchive(ctx, archiveName, spool, stagedTarget)
+	if err != nil {
+		return err
+	}
+	// Перенос не прерывается: после него пакет установлен целиком
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var dest string
+	if target.outside {
+		dest = target.dir
+	}
+	return commitInstall(root, staging, models.InstalledPackage{
+		Name:         pkg.Name,
+		Ver:          pkg.Ver,
+		Checksum:     pkg.Checksum,
+		Dest:         dest,
+		Files:        target.rootPaths(files),
+		Dependencies: pkg.Dependencies,
+	})
+}
+
+// RollbackPackage возвращает предыдущую установленную версию пакета из сохраненной копии.
+// Заменяемая версия в свою очередь сохраняется, поэтому повторный откат возвращает ее
+func RollbackPackage(prefix, name string) error {
+	root := installRoot(prefix)
+	db, err := readInstalledDB(root)
+	if err != nil {
+		return err
+	}
+	i := findInstalled(db, name)
+	if i < 0 {
+		return fmt.Errorf("пакет %s не установлен", name)
+	}
+	previous := db.Packages[i].Previous
+	if previous == nil {
+		return fmt.Errorf("у пакета %s нет предыдущей версии", name)
+	}
+
+	log.Printf("Откат пакета %s с версии %s на %s...", name, db.Packages[i].Ver, previous.Ver)
+	base := installedBase(root, &db.Packages[i])
+	staging := stagingPath(base, name)
+	if err := os.RemoveAll(staging); err != nil {
+		return fmt.Errorf("ошибка подготовки директории %s: %w", staging, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(staging), 0755); err != nil {
+		return fmt.Errorf("ошибка подготовки директории %s: %w", staging, err)
+	}
+	backup := backupPath(base, name)
+	if err := os.Rename(backup, staging); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("ошибка чтения копии пакета %s: %w", name, err)
+	}
+	// Файлы, общие с другими пакетами, в копию не попадают: они остались на месте
+	if err := commitInstall(root, staging, *previous); err != nil {
+		// Копия возвращается на место, чтобы откат можно было повторить
+		os.Rename(staging, backup)
+		return err
+	}
+	os.RemoveAll(staging)
+	log.Printf("Пакет %s возвращен к версии %s.", name, previous.Ver)
+	return nil
+}
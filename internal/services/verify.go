@@ -0,0 +1,29 @@
+package services
+
+import "fmt"
+
+// ChecksumError сообщает, что скачанный архив не совпадает с опубликованной контрольной суммой.
+// Такой архив не распаковывается
+type ChecksumError struct {
+	Archive  string
+	Expected string
+	Actual   string
+	// Source - откуда взята ожидаемая сумма: индекс пакета или lock-файл
+	Source string
+}
+
+func (e *ChecksumError) Error() string {
+	if e.Expected == "" {
+		return fmt.Sprintf("для архива %s нет контрольной суммы (%s), установка отклонена", e.Archive, e.Source)
+	}
+	return fmt.Sprintf("контрольная сумма архива %s (%s) не совпадает с %s (%s), установка отклонена",
+		e.Archive, e.Actual, e.Source, e.Expected)
+}
+
+// verifyChecksum сравнивает контрольную сумму скачанного архива с ожидаемой
+func verifyChecksum(archive, expected, actual, source string) error {
+	if expected == "" || expected != actual {
+		return &ChecksumError{Archive: archive, Expected: expected, Actual: actual, Source: source}
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// newEd25519Signer создает ключ Ed25519 и записывает закрытую часть в файл в формате OpenSSH
+func newEd25519Signer(t *testing.T, dir string) (ssh.Signer, string) {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Не удалось создать ключ: %v", err)
+	}
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		t.Fatalf("Не удалось сериализовать ключ: %v", err)
+	}
+	keyPath := filepath.Join(dir, "id_ed25519")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("Не удалось записать ключ: %v", err)
+	}
+	signer, err := LoadSigner(keyPath, nil)
+	if err != nil {
+		t.Fatalf("Не удалось загрузить ключ: %v", err)
+	}
+	return signer, keyPath
+}
+
+// TestLoadSignerEncrypted проверяет загрузку ключа подписи, защищенного паролем
+func TestLoadSignerEncrypted(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Не удалось создать ключ: %v", err)
+	}
+	block, err := ssh.MarshalPrivateKeyWithPassphrase(priv, "", []byte("secret"))
+	if err != nil {
+		t.Fatalf("Не удалось сериализовать ключ: %v", err)
+	}
+	keyPath := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("Не удалось записать ключ: %v", err)
+	}
+
+	if _, err := LoadSigner(keyPath, nil); err == nil {
+		t.Error("Ожидалась ошибка загрузки зашифрованного ключа без пароля")
+	}
+	passphrase := func(secret string) func() (string, error) {
+		return func() (string, error) { return secret, nil }
+	}
+	if _, err := LoadSigner(keyPath, passphrase("wrong")); err == nil {
+		t.Error("Ожидалась ошибка для неверного пароля")
+	}
+	signer, err := LoadSigner(keyPath, passphrase("secret"))
+	if err != nil {
+		t.Fatalf("Не удалось загрузить ключ: %v", err)
+	}
+	public, err := ssh.NewPublicKey(priv.Public())
+	if err != nil {
+		t.Fatalf("Не удалось получить открытый ключ: %v", err)
+	}
+	if ssh.FingerprintSHA256(signer.PublicKey()) != ssh.FingerprintSHA256(public) {
+		t.Error("Загружен ключ, не совпадающий с исходным")
+	}
+}
+
+// TestSignVerify проверяет подпись и проверку данных ключами Ed25519 и RSA
+func TestSignVerify(t *testing.T) {
+	edSigner, _ := newEd25519Signer(t, t.TempDir())
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Не удалось создать ключ RSA: %v", err)
+	}
+	rsaSigner, err := ssh.NewSignerFromKey(rsaKey)
+	if err != nil {
+		t.Fatalf("Не удалось создать подписчика RSA: %v", err)
+	}
+
+	for _, signer := range []ssh.Signer{edSigner, rsaSigner} {
+		keyType := signer.PublicKey().Type()
+		signature, err := Sign(signer, strings.NewReader("archive"))
+		if err != nil {
+			t.Fatalf("%s: ошибка подписи: %v", keyType, err)
+		}
+		if !strings.HasPrefix(signature, sigBeginArmor) {
+			t.Errorf("%s: подпись не в формате ssh-keygen: %q", keyType, signature)
+		}
+
+		key, err := Verify(signature, strings.NewReader("archive"))
+		if err != nil {
+			t.Fatalf("%s: ожидалась корректная подпись, получено: %v", keyType, err)
+		}
+		if string(key.Marshal()) != string(signer.PublicKey().Marshal()) {
+			t.Errorf("%s: Verify вернул чужой ключ", keyType)
+		}
+
+		if _, err := Verify(signature, strings.NewReader("tampered")); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: ожидалась ErrInvalidSignature для измененных данных, получено: %v", keyType, err)
+		}
+	}
+
+	if _, err := Verify("not a signature", strings.NewReader("archive")); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Ожидалась ErrInvalidSignature для мусора, получено: %v", err)
+	}
+}
+
+// TestManifest проверяет канонический вид подписываемого описания пакета
+func TestManifest(t *testing.T) {
+	got := string(Manifest("app", "1.0.0", "sha256:00"))
+	if want := `{"name":"app","ver":"1.0.0","checksum":"sha256:00"}`; got != want {
+		t.Errorf("Ожидалось описание %s, получено %s", want, got)
+	}
+}
+
+// TestSSHKeygenCompatibility проверяет совместимость подписей с ssh-keygen -Y
+func TestSSHKeygenCompatibility(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen не найден")
+	}
+	dir := t.TempDir()
+	signer, keyPath := newEd25519Signer(t, dir)
+	dataPath := filepath.Join(dir, "archive.zip")
+	if err := os.WriteFile(dataPath, []byte("archive"), 0644); err != nil {
+		t.Fatalf("Не удалось записать данные: %v", err)
+	}
+
+	// Подпись ssh-keygen принимается Verify
+	if out, err := exec.Command("ssh-keygen", "-Y", "sign", "-f", keyPath, "-n", Namespace, dataPath).CombinedOutput(); err != nil {
+		t.Fatalf("ssh-keygen -Y sign: %v\n%s", err, out)
+	}
+	sigData, err := os.ReadFile(dataPath + ".sig")
+	if err != nil {
+		t.Fatalf("Не удалось прочитать подпись: %v", err)
+	}
+	data, _ := os.Open(dataPath)
+	defer data.Close()
+	if _, err := Verify(string(sigData), data); err != nil {
+		t.Errorf("Подпись ssh-keygen не прошла проверку: %v", err)
+	}
+
+	// Подпись Sign принимается ssh-keygen
+	signature, err := Sign(signer, strings.NewReader("archive"))
+	if err != nil {
+		t.Fatalf("Ошибка подписи: %v", err)
+	}
+	sigPath := filepath.Join(dir, "pm.sig")
+	signersPath := filepath.Join(dir, "allowed_signers")
+	if err := os.WriteFile(sigPath, []byte(signature), 0644); err != nil {
+		t.Fatalf("Не удалось записать подпись: %v", err)
+	}
+	signers := "app " + string(ssh.MarshalAuthorizedKey(signer.PublicKey()))
+	if err := os.WriteFile(signersPath, []byte(signers), 0644); err != nil {
+		t.Fatalf("Не удалось записать список ключей: %v", err)
+	}
+	cmd := exec.Command("ssh-keygen", "-Y", "verify", "-f", signersPath, "-I", "app", "-n", Namespace, "-s", sigPath)
+	cmd.Stdin = strings.NewReader("archive")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("ssh-keygen не принял подпись: %v\n%s", err, out)
+	}
+}
+
+// TestTrustedKeys проверяет разбор списка доверенных ключей и сопоставление имен пакетов
+func TestTrustedKeys(t *testing.T) {
+	appSigner, _ := newEd25519Signer(t, t.TempDir())
+	otherSigner, _ := newEd25519Signer(t, t.TempDir())
+	appKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(appSigner.PublicKey())))
+	otherKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(otherSigner.PublicKey())))
+
+	data := "# доверенные ключи\n" +
+		"app,lib-* " + appKey + " release@example\n" +
+		"*\tnamespaces=\"git\" " + otherKey + "\n"
+	keys, err := ParseTrustedKeys([]byte(data))
+	if err != nil {
+		t.Fatalf("Ошибка разбора: %v", err)
+	}
+	if len(keys) != 2 || keys[0].Comment != "release@example" {
+		t.Fatalf("Неожиданный список ключей: %+v", keys)
+	}
+
+	tests := []struct {
+		name string
+		key  ssh.PublicKey
+		want bool
+	}{
+		{"app", appSigner.PublicKey(), true},
+		{"lib-net", appSigner.PublicKey(), true},
+		{"tool", appSigner.PublicKey(), false},
+		// Ключ разрешен только для подписей git
+		{"app", otherSigner.PublicKey(), false},
+	}
+	for _, tt := range tests {
+		if got := keys.Trusts(tt.name, tt.key); got != tt.want {
+			t.Errorf("Trusts(%s, %s) = %v, ожидалось %v", tt.name, ssh.FingerprintSHA256(tt.key), got, tt.want)
+		}
+	}
+
+	if _, err := ParseTrustedKeys([]byte("app cert-authority " + appKey + "\n")); err == nil {
+		t.Error("Ожидалась ошибка для неподдерживаемой опции")
+	}
+	if _, err := ParseTrustedKeys([]byte(appKey + "\n")); err == nil {
+		t.Error("Ожидалась ошибка для строки без имен пакетов")
+	}
+}
@@ -0,0 +1,216 @@
+// Package signing реализует подписи пакетов в формате SSH-подписей (SSHSIG), совместимом
+// с ssh-keygen -Y sign / ssh-keygen -Y verify, и список доверенных ключей
+package signing
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Namespace - пространство имен подписей пакетов (ssh-keygen -Y ... -n pm-package).
+// Подписывается не архив, а его описание Manifest
+const Namespace = "pm-package"
+
+const (
+	sigMagic      = "SSHSIG"
+	sigVersion    = 1
+	sigBeginArmor = "-----BEGIN SSH SIGNATURE-----"
+	sigEndArmor   = "-----END SSH SIGNATURE-----"
+	sigLineWidth  = 70
+)
+
+// ErrInvalidSignature сообщает, что подпись не соответствует данным или повреждена
+var ErrInvalidSignature = errors.New("недействительная подпись")
+
+// sigBlob - содержимое SSH-подписи после заголовка SSHSIG
+type sigBlob struct {
+	Version   uint32
+	PublicKey []byte
+	Namespace string
+	Reserved  string
+	HashAlg   string
+	Signature []byte
+}
+
+// signedData - структура, которая подписывается закрытым ключом
+type signedData struct {
+	Namespace string
+	Reserved  string
+	HashAlg   string
+	Hash      []byte
+}
+
+// manifest - подписываемое описание версии пакета
+type manifest struct {
+	Name     string `json:"name"`
+	Ver      string `json:"ver"`
+	Checksum string `json:"checksum"`
+}
+
+// Manifest возвращает подписываемое описание версии пакета: JSON без пробелов с полями
+// name, ver и checksum в этом порядке. Архив покрывается контрольной суммой, а имя и версия
+// не позволяют выдать подписанный архив за другую версию или за другой пакет
+func Manifest(name, ver, checksum string) []byte {
+	data, _ := json.Marshal(manifest{Name: name, Ver: ver, Checksum: checksum})
+	return data
+}
+
+// LoadSigner читает закрытый SSH-ключ для подписи пакетов. Для зашифрованного ключа пароль
+// возвращает passphrase; если passphrase равен nil, зашифрованный ключ не загружается
+func LoadSigner(keyPath string, passphrase func() (string, error)) (ssh.Signer, error) {
+	key, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать ключ подписи: %w", err)
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	var missingErr *ssh.PassphraseMissingError
+	if errors.As(err, &missingErr) && passphrase != nil {
+		secret, err := passphrase()
+		if err != nil {
+			return nil, err
+		}
+		if signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(secret)); err != nil {
+			return nil, fmt.Errorf("не удалось расшифровать ключ подписи %s: %w", keyPath, err)
+		}
+		return signer, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("не удалось разобрать ключ подписи %s: %w", keyPath, err)
+	}
+	return signer, nil
+}
+
+// Sign подписывает данные из r и возвращает подпись в текстовом (armored) виде
+func Sign(signer ssh.Signer, r io.Reader) (string, error) {
+	digest, err := hashMessage("sha512", r)
+	if err != nil {
+		return "", err
+	}
+	message := marshalSigned(signedData{Namespace: Namespace, HashAlg: "sha512", Hash: digest})
+
+	var sig *ssh.Signature
+	algSigner, isAlgSigner := signer.(ssh.AlgorithmSigner)
+	if signer.PublicKey().Type() == ssh.KeyAlgoRSA && isAlgSigner {
+		// SHA-1 подписи RSA не принимаются ssh-keygen
+		sig, err = algSigner.SignWithAlgorithm(rand.Reader, message, ssh.KeyAlgoRSASHA512)
+	} else {
+		sig, err = signer.Sign(rand.Reader, message)
+	}
+	if err != nil {
+		return "", fmt.Errorf("ошибка подписи: %w", err)
+	}
+
+	blob := append([]byte(sigMagic), ssh.Marshal(sigBlob{
+		Version:   sigVersion,
+		PublicKey: signer.PublicKey().Marshal(),
+		Namespace: Namespace,
+		HashAlg:   "sha512",
+		Signature: ssh.Marshal(sig),
+	})...)
+	return armor(blob), nil
+}
+
+// Verify проверяет подпись данных из r и возвращает открытый ключ, которым они подписаны.
+// Доверие к ключу проверяется отдельно через TrustedKeys
+func Verify(signature string, r io.Reader) (ssh.PublicKey, error) {
+	raw, err := unarmor(signature)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(raw, []byte(sigMagic)) {
+		return nil, fmt.Errorf("%w: нет заголовка %s", ErrInvalidSignature, sigMagic)
+	}
+	var blob sigBlob
+	if err := ssh.Unmarshal(raw[len(sigMagic):], &blob); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	if blob.Version != sigVersion {
+		return nil, fmt.Errorf("%w: неподдерживаемая версия %d", ErrInvalidSignature, blob.Version)
+	}
+	if blob.Namespace != Namespace {
+		return nil, fmt.Errorf("%w: пространство имен %q вместо %q", ErrInvalidSignature, blob.Namespace, Namespace)
+	}
+
+	pub, err := ssh.ParsePublicKey(blob.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	var sig ssh.Signature
+	if err := ssh.Unmarshal(blob.Signature, &sig); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	if sig.Format == ssh.KeyAlgoRSA {
+		return nil, fmt.Errorf("%w: подписи RSA/SHA-1 не поддерживаются", ErrInvalidSignature)
+	}
+
+	digest, err := hashMessage(blob.HashAlg, r)
+	if err != nil {
+		return nil, err
+	}
+	message := marshalSigned(signedData{Namespace: blob.Namespace, Reserved: blob.Reserved, HashAlg: blob.HashAlg, Hash: digest})
+	if err := pub.Verify(message, &sig); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	return pub, nil
+}
+
+// hashMessage вычисляет хеш подписываемых данных алгоритмом, указанным в подписи
+func hashMessage(alg string, r io.Reader) ([]byte, error) {
+	var h hash.Hash
+	switch alg {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return nil, fmt.Errorf("%w: неподдерживаемый алгоритм хеширования %q", ErrInvalidSignature, alg)
+	}
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, fmt.Errorf("ошибка чтения подписываемых данных: %w", err)
+	}
+	return h.Sum(nil), nil
+}
+
+func marshalSigned(data signedData) []byte {
+	return append([]byte(sigMagic), ssh.Marshal(data)...)
+}
+
+// armor оборачивает подпись в текстовый формат ssh-keygen
+func armor(blob []byte) string {
+	encoded := base64.StdEncoding.EncodeToString(blob)
+	var b strings.Builder
+	b.WriteString(sigBeginArmor + "\n")
+	for len(encoded) > sigLineWidth {
+		b.WriteString(encoded[:sigLineWidth] + "\n")
+		encoded = encoded[sigLineWidth:]
+	}
+	b.WriteString(encoded + "\n")
+	b.WriteString(sigEndArmor + "\n")
+	return b.String()
+}
+
+// unarmor извлекает двоичную подпись из текстового формата
+func unarmor(signature string) ([]byte, error) {
+	text := strings.TrimSpace(signature)
+	if !strings.HasPrefix(text, sigBeginArmor) || !strings.HasSuffix(text, sigEndArmor) {
+		return nil, fmt.Errorf("%w: неверный формат SSH-подписи", ErrInvalidSignature)
+	}
+	body := strings.TrimSuffix(strings.TrimPrefix(text, sigBeginArmor), sigEndArmor)
+	raw, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(body), ""))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	return raw, nil
+}
@@ -0,0 +1,108 @@
+package signing
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// TrustedKey - доверенный ключ и пакеты, подписи которых он может ставить
+type TrustedKey struct {
+	// Principals - шаблоны имен пакетов (path.Match), "*" - любой пакет
+	Principals []string
+	// Namespaces - разрешенные пространства имен подписей; пустой список разрешает любые
+	Namespaces []string
+	Key        ssh.PublicKey
+	Comment    string
+}
+
+// TrustedKeys - список доверенных ключей
+type TrustedKeys []TrustedKey
+
+// LoadTrustedKeys читает файл доверенных ключей
+func LoadTrustedKeys(filePath string) (TrustedKeys, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать файл доверенных ключей: %w", err)
+	}
+	keys, err := ParseTrustedKeys(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+	return keys, nil
+}
+
+// ParseTrustedKeys разбирает список доверенных ключей в формате allowed_signers из ssh-keygen:
+//
+//	имена-пакетов [namespaces="pm"] тип-ключа ключ [комментарий]
+//
+// Имена пакетов перечисляются через запятую и могут содержать шаблоны
+func ParseTrustedKeys(data []byte) (TrustedKeys, error) {
+	var keys TrustedKeys
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sep := strings.IndexAny(line, " \t")
+		if sep < 0 {
+			return nil, fmt.Errorf("строка %d: ожидались имена пакетов и ключ", lineNum)
+		}
+		principals, rest := line[:sep], line[sep+1:]
+		key, comment, options, _, err := ssh.ParseAuthorizedKey([]byte(strings.TrimSpace(rest)))
+		if err != nil {
+			return nil, fmt.Errorf("строка %d: %w", lineNum, err)
+		}
+		trusted := TrustedKey{Principals: strings.Split(principals, ","), Key: key, Comment: comment}
+		for _, pattern := range trusted.Principals {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("строка %d: некорректный шаблон %q: %w", lineNum, pattern, err)
+			}
+		}
+		for _, option := range options {
+			name, value, _ := strings.Cut(option, "=")
+			if !strings.EqualFold(name, "namespaces") {
+				return nil, fmt.Errorf("строка %d: неподдерживаемая опция %q", lineNum, name)
+			}
+			trusted.Namespaces = strings.Split(strings.Trim(value, `"`), ",")
+		}
+		keys = append(keys, trusted)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Trusts сообщает, может ли ключ подписывать пакет с указанным именем
+func (keys TrustedKeys) Trusts(packageName string, key ssh.PublicKey) bool {
+	marshaled := key.Marshal()
+	for _, trusted := range keys {
+		if !bytes.Equal(trusted.Key.Marshal(), marshaled) {
+			continue
+		}
+		if len(trusted.Namespaces) > 0 && !matchAny(trusted.Namespaces, Namespace) {
+			continue
+		}
+		if matchAny(trusted.Principals, packageName) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAny проверяет имя по списку шаблонов
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
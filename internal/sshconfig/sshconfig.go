@@ -0,0 +1,333 @@
+// Package sshconfig читает файл настроек клиента OpenSSH (~/.ssh/config) в объеме,
+// нужном для подключения: HostName, Port, User, IdentityFile и ProxyJump
+package sshconfig
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// maxIncludeDepth ограничивает вложенность директив Include
+const maxIncludeDepth = 16
+
+// Config - разобранный файл настроек
+type Config struct {
+	blocks []*block
+}
+
+// block - секция Host (или Match all) со своими параметрами.
+// Параметры до первой секции относятся ко всем хостам
+type block struct {
+	patterns []string
+	options  []option
+}
+
+type option struct {
+	key   string
+	value string
+}
+
+// Host - параметры подключения к хосту после применения всех подходящих секций
+type Host struct {
+	// HostName - настоящее имя хоста (по умолчанию - сам псевдоним)
+	HostName string
+	// Port - 0, если не задан
+	Port          int
+	User          string
+	IdentityFiles []string
+	// ProxyJump - цепочка промежуточных хостов через запятую, пустая строка - без них
+	ProxyJump string
+}
+
+// DefaultPath возвращает путь к пользовательскому файлу настроек (~/.ssh/config)
+func DefaultPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".ssh", "config")
+}
+
+// Load читает файл настроек. Отсутствующий файл считается пустым
+func Load(path string) (*Config, error) {
+	c := &Config{blocks: []*block{{patterns: []string{"*"}}}}
+	if path == "" {
+		return c, nil
+	}
+	if err := c.parseFile(path, 0); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return c, nil
+}
+
+// parseFile добавляет секции из файла. Параметры до первой секции Host попадают в текущую секцию,
+// поэтому Include внутри секции Host действует только для нее
+func (c *Config) parseFile(name string, depth int) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		key, args, err := splitLine(scanner.Text())
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", name, lineNum, err)
+		}
+		if key == "" {
+			continue
+		}
+		if len(args) == 0 {
+			return fmt.Errorf("%s:%d: не указано значение %s", name, lineNum, key)
+		}
+		switch key {
+		case "host":
+			c.blocks = append(c.blocks, &block{patterns: args})
+		case "match":
+			// Из условий Match поддерживается только all, остальные секции пропускаются
+			var patterns []string
+			if len(args) == 1 && strings.EqualFold(args[0], "all") {
+				patterns = []string{"*"}
+			}
+			c.blocks = append(c.blocks, &block{patterns: patterns})
+		case "include":
+			if depth >= maxIncludeDepth {
+				return fmt.Errorf("%s:%d: слишком глубокая вложенность Include", name, lineNum)
+			}
+			for _, pattern := range args {
+				if err := c.include(pattern, depth+1); err != nil {
+					return fmt.Errorf("%s:%d: %w", name, lineNum, err)
+				}
+			}
+		default:
+			current := c.blocks[len(c.blocks)-1]
+			current.options = append(current.options, option{key: key, value: strings.Join(args, " ")})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("ошибка чтения %s: %w", name, err)
+	}
+	return nil
+}
+
+// include читает файлы по маске. Относительные пути отсчитываются от ~/.ssh
+func (c *Config) include(pattern string, depth int) error {
+	pattern = expandHome(pattern)
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(filepath.Dir(DefaultPath()), pattern)
+	}
+	names, err := filepath.Glob(pattern)
+	if err != nil {
+		return fmt.Errorf("некорректная маска Include %q: %w", pattern, err)
+	}
+	for _, name := range names {
+		if err := c.parseFile(name, depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitLine разбирает строку "Keyword value ..." или "Keyword=value". Ключевое слово
+// возвращается в нижнем регистре, пустые строки и комментарии дают пустое ключевое слово
+func splitLine(line string) (string, []string, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", nil, nil
+	}
+	end := strings.IndexAny(line, " \t=")
+	if end < 0 {
+		return strings.ToLower(line), nil, nil
+	}
+	key := strings.ToLower(line[:end])
+	rest := strings.TrimLeft(line[end:], " \t")
+	rest = strings.TrimLeft(strings.TrimPrefix(rest, "="), " \t")
+
+	var args []string
+	for rest != "" {
+		var arg string
+		if rest[0] == '"' {
+			closing := strings.IndexByte(rest[1:], '"')
+			if closing < 0 {
+				return "", nil, errors.New("незакрытая кавычка")
+			}
+			arg, rest = rest[1:closing+1], rest[closing+2:]
+		} else {
+			end := strings.IndexAny(rest, " \t")
+			if end < 0 {
+				end = len(rest)
+			}
+			arg, rest = rest[:end], rest[end:]
+		}
+		args = append(args, arg)
+		rest = strings.TrimLeft(rest, " \t")
+	}
+	return key, args, nil
+}
+
+// Lookup возвращает параметры подключения к хосту alias. Как и в OpenSSH, действует первое
+// найденное значение параметра, а IdentityFile накапливаются из всех подходящих секций
+func (c *Config) Lookup(alias string) (Host, error) {
+	host := Host{}
+	var hostName, port string
+	for _, b := range c.blocks {
+		if !b.matches(alias) {
+			continue
+		}
+		for _, opt := range b.options {
+			switch opt.key {
+			case "hostname":
+				if hostName == "" {
+					hostName = opt.value
+				}
+			case "port":
+				if port == "" {
+					port = opt.value
+				}
+			case "user":
+				if host.User == "" {
+					host.User = opt.value
+				}
+			case "identityfile":
+				host.IdentityFiles = append(host.IdentityFiles, opt.value)
+			case "proxyjump":
+				if host.ProxyJump == "" {
+					host.ProxyJump = opt.value
+				}
+			}
+		}
+	}
+
+	host.HostName = alias
+	if hostName != "" {
+		host.HostName = expandTokens(hostName, alias, "", "")
+	}
+	if port != "" {
+		p, err := strconv.Atoi(port)
+		if err != nil || p < 1 || p > 65535 {
+			return Host{}, fmt.Errorf("некорректный порт %q для хоста %s", port, alias)
+		}
+		host.Port = p
+	}
+	for i, identity := range host.IdentityFiles {
+		host.IdentityFiles[i] = expandHome(expandTokens(identity, host.HostName, host.User, strconv.Itoa(host.Port)))
+	}
+	if strings.EqualFold(host.ProxyJump, "none") {
+		host.ProxyJump = ""
+	}
+	return host, nil
+}
+
+// matches проверяет, что хост подходит под маски секции: хотя бы одна маска совпадает
+// и ни одна маска с ! не совпадает
+func (b *block) matches(alias string) bool {
+	alias = strings.ToLower(alias)
+	matched := false
+	for _, pattern := range b.patterns {
+		for _, p := range strings.Split(pattern, ",") {
+			negated := strings.HasPrefix(p, "!")
+			ok, _ := path.Match(strings.ToLower(strings.TrimPrefix(p, "!")), alias)
+			if ok && negated {
+				return false
+			}
+			matched = matched || ok
+		}
+	}
+	return matched
+}
+
+// expandTokens раскрывает токены %h, %r, %p, %u, %d и %% в значении параметра
+func expandTokens(value, host, remoteUser, port string) string {
+	if !strings.Contains(value, "%") {
+		return value
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '%' || i+1 == len(value) {
+			b.WriteByte(value[i])
+			continue
+		}
+		i++
+		switch value[i] {
+		case 'h':
+			b.WriteString(host)
+		case 'r':
+			b.WriteString(remoteUser)
+		case 'p':
+			b.WriteString(port)
+		case 'u':
+			if u, err := user.Current(); err == nil {
+				b.WriteString(u.Username)
+			}
+		case 'd':
+			home, _ := os.UserHomeDir()
+			b.WriteString(home)
+		case '%':
+			b.WriteByte('%')
+		default:
+			b.WriteByte('%')
+			b.WriteByte(value[i])
+		}
+	}
+	return b.String()
+}
+
+// expandHome раскрывает ~/ в начале пути в домашнюю директорию пользователя
+func expandHome(p string) string {
+	if p != "~" && !strings.HasPrefix(p, "~/") {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return p
+	}
+	return filepath.Join(home, p[1:])
+}
+
+// Jump - промежуточный хост из ProxyJump
+type Jump struct {
+	User string
+	Host string
+	// Port - 0, если не задан
+	Port int
+}
+
+// ParseProxyJump разбирает цепочку промежуточных хостов: [user@]host[:port] или
+// ssh://[user@]host[:port] через запятую
+func ParseProxyJump(spec string) ([]Jump, error) {
+	if spec == "" || strings.EqualFold(spec, "none") {
+		return nil, nil
+	}
+	var jumps []Jump
+	for _, hop := range strings.Split(spec, ",") {
+		hop = strings.TrimSpace(hop)
+		if !strings.HasPrefix(hop, "ssh://") {
+			hop = "ssh://" + hop
+		}
+		u, err := url.Parse(hop)
+		if err != nil || u.Hostname() == "" || (u.Path != "" && u.Path != "/") {
+			return nil, fmt.Errorf("некорректный промежуточный хост %q", strings.TrimPrefix(hop, "ssh://"))
+		}
+		jump := Jump{Host: u.Hostname()}
+		if u.User != nil {
+			jump.User = u.User.Username()
+		}
+		if u.Port() != "" {
+			if jump.Port, err = strconv.Atoi(u.Port()); err != nil || jump.Port < 1 || jump.Port > 65535 {
+				return nil, fmt.Errorf("некорректный порт промежуточного хоста %q", hop)
+			}
+		}
+		jumps = append(jumps, jump)
+	}
+	return jumps, nil
+}
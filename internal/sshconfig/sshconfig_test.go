@@ -0,0 +1,128 @@
+package sshconfig
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// writeConfig записывает файл настроек в dir и возвращает путь к нему
+func writeConfig(t *testing.T, dir, name, data string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatalf("Не удалось записать %s: %v", name, err)
+	}
+	return path
+}
+
+// TestLookup проверяет приоритет первого значения, накопление IdentityFile, маски с отрицанием,
+// токены и Include
+func TestLookup(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	dir := t.TempDir()
+	writeConfig(t, dir, "extra.conf", "Host db\n  HostName db.internal\n  Port 2201\n")
+	path := writeConfig(t, dir, "config", `
+# Параметры до первой секции действуют для всех хостов
+IdentityFile ~/.ssh/common
+
+Host web web-*
+    HostName %h.example.com
+    User=web
+    IdentityFile "~/.ssh/%h %r"
+
+Host *.example.com !legacy.example.com
+    Port 2222
+    ProxyJump bastion
+
+Match exec "true"
+    User ignored
+
+Include `+filepath.Join(dir, "*.conf")+`
+
+Host *
+    User default
+    Port 22
+    ProxyJump none
+`)
+
+	c, err := Load(path)
+	if err != nil {
+		t.Fatalf("Ошибка чтения настроек: %v", err)
+	}
+	tests := []struct {
+		alias string
+		want  Host
+	}{
+		{"web", Host{HostName: "web.example.com", Port: 22, User: "web",
+			IdentityFiles: []string{filepath.Join(home, ".ssh", "common"), filepath.Join(home, ".ssh", "web.example.com web")}}},
+		{"app.example.com", Host{HostName: "app.example.com", Port: 2222, User: "default",
+			IdentityFiles: []string{filepath.Join(home, ".ssh", "common")}, ProxyJump: "bastion"}},
+		{"legacy.example.com", Host{HostName: "legacy.example.com", Port: 22, User: "default",
+			IdentityFiles: []string{filepath.Join(home, ".ssh", "common")}}},
+		{"DB", Host{HostName: "db.internal", Port: 2201, User: "default",
+			IdentityFiles: []string{filepath.Join(home, ".ssh", "common")}}},
+	}
+	for _, tt := range tests {
+		got, err := c.Lookup(tt.alias)
+		if err != nil {
+			t.Errorf("Lookup(%s): %v", tt.alias, err)
+			continue
+		}
+		if got.HostName != tt.want.HostName || got.Port != tt.want.Port || got.User != tt.want.User ||
+			got.ProxyJump != tt.want.ProxyJump || !slices.Equal(got.IdentityFiles, tt.want.IdentityFiles) {
+			t.Errorf("Lookup(%s) = %+v, ожидалось %+v", tt.alias, got, tt.want)
+		}
+	}
+
+	// Отсутствующий файл считается пустым
+	c, err = Load(filepath.Join(dir, "missing"))
+	if err != nil {
+		t.Fatalf("Отсутствующий файл должен считаться пустым: %v", err)
+	}
+	if got, err := c.Lookup("web"); err != nil || got.HostName != "web" || got.Port != 0 {
+		t.Errorf("Ожидались параметры по умолчанию, получено %+v (%v)", got, err)
+	}
+}
+
+// TestLoadInvalid проверяет ошибки разбора с указанием строки
+func TestLoadInvalid(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"no-value": "Host a\n  HostName\n",
+		"quote":    "Host a\n  IdentityFile \"~/key\n",
+		"include":  "Include " + filepath.Join(dir, "include") + "\n",
+	} {
+		path := writeConfig(t, dir, name, data)
+		if _, err := Load(path); err == nil {
+			t.Errorf("Ожидалась ошибка разбора файла %s", name)
+		}
+	}
+
+	c, err := Load(writeConfig(t, dir, "port", "Host a\n  Port ssh\n"))
+	if err != nil {
+		t.Fatalf("Ошибка чтения настроек: %v", err)
+	}
+	if _, err := c.Lookup("a"); err == nil {
+		t.Error("Ожидалась ошибка некорректного порта")
+	}
+}
+
+// TestParseProxyJump проверяет формы записи промежуточных хостов
+func TestParseProxyJump(t *testing.T) {
+	jumps, err := ParseProxyJump("gate, admin@bastion:2200,ssh://root@[::1]:22")
+	want := []Jump{{Host: "gate"}, {User: "admin", Host: "bastion", Port: 2200}, {User: "root", Host: "::1", Port: 22}}
+	if err != nil || !slices.Equal(jumps, want) {
+		t.Errorf("ParseProxyJump = %+v (%v), ожидалось %+v", jumps, err, want)
+	}
+	if jumps, err := ParseProxyJump("none"); err != nil || jumps != nil {
+		t.Errorf("none должен означать отсутствие промежуточных хостов: %+v (%v)", jumps, err)
+	}
+	for _, spec := range []string{"host:99999", "user@", "a,,b", "host/path"} {
+		if _, err := ParseProxyJump(spec); err == nil {
+			t.Errorf("Ожидалась ошибка разбора %q", spec)
+		}
+	}
+}